@@ -1,43 +1,204 @@
 package main
 
 import (
+	"bufio"
 	"flag"
+	"fmt"
 	"log"
+	"log/slog"
 	"os"
+	"os/signal"
+	"strings"
 	"sync"
+	"syscall"
 
 	"github.com/NewFuture/CloudDDNS/pkg/config"
+	"github.com/NewFuture/CloudDDNS/pkg/guard"
+	"github.com/NewFuture/CloudDDNS/pkg/logging"
 	"github.com/NewFuture/CloudDDNS/pkg/server"
+	"github.com/NewFuture/CloudDDNS/pkg/server/mode"
+	"github.com/NewFuture/CloudDDNS/pkg/state"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "freedns-token" {
+		if err := runFreeDNSToken(os.Args[2:]); err != nil {
+			log.Fatalf("freedns-token: %v", err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "hash-password" {
+		if err := runHashPassword(os.Args[2:]); err != nil {
+			log.Fatalf("hash-password: %v", err)
+		}
+		return
+	}
+
 	// Allow config path to be specified via flag or environment variable
 	configPath := flag.String("config", getEnvOrDefault("CONFIG_PATH", "config.yaml"), "Path to configuration file")
-	debug := flag.Bool("debug", false, "Enable debug logging to print full request parameters and step-by-step status")
+	debug := flag.Bool("debug", false, "Enable debug logging (overrides log_level) to print request parameters and step-by-step status")
+	unredacted := flag.Bool("debug-unredacted", false, "Log passwords, tokens and hashes in debug output without masking (unsafe)")
 	flag.Parse()
 
 	if err := config.LoadConfig(*configPath); err != nil {
 		log.Fatalf("Config Load Error: %v", err)
 	}
+	cfg := config.Current()
+	if err := logging.Setup(os.Stderr, cfg.Server.LogLevel, cfg.Server.LogFormat); err != nil {
+		log.Fatalf("Logging Setup Error: %v", err)
+	}
+
+	store, err := state.Open(cfg.Server.StatePath())
+	if err != nil {
+		log.Fatalf("State Load Error: %v", err)
+	}
+	state.SetDefault(store)
+
+	guard.SetDefault(guard.New(authGuardPolicy(cfg.Server.AuthGuard)))
 
 	server.SetDebug(*debug)
+	server.SetDebugUnredacted(*unredacted)
+	if *debug && *unredacted {
+		slog.Warn("Debug logs are unredacted and will contain credentials")
+	}
+	go reloadOnSignal(*configPath)
 
 	var wg sync.WaitGroup
 	wg.Add(2)
 
 	go func() {
 		defer wg.Done()
-		server.StartTCP(config.GlobalConfig.Server.TCPPort)
+		server.StartTCP(cfg.Server.TCPPort)
 	}()
 
 	go func() {
 		defer wg.Done()
-		server.StartHTTP(config.GlobalConfig.Server.HTTPPort)
+		server.StartHTTP(cfg.Server.HTTPPort)
 	}()
 
 	wg.Wait()
 }
 
+// reloadOnSignal re-reads the configuration on SIGHUP so that rotated
+// secrets (environment variables, *_file references) take effect without a
+// restart, and applies the new auth_guard policy while keeping current bans.
+// A failed reload keeps the previous configuration. Listener ports,
+// connection limits and log settings are only applied at startup.
+func reloadOnSignal(path string) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGHUP)
+	for range sig {
+		if err := config.LoadConfig(path); err != nil {
+			slog.Error("Config reload failed, keeping previous configuration", "error", err)
+			continue
+		}
+		guard.Default().SetPolicy(authGuardPolicy(config.Current().Server.AuthGuard))
+		slog.Info("Config reloaded", "path", path)
+	}
+}
+
+// authGuardPolicy converts the auth_guard settings into a guard policy.
+func authGuardPolicy(ag config.AuthGuardConfig) guard.Policy {
+	return guard.Policy{
+		MaxFailures: ag.MaxFailures,
+		Ban:         ag.BanDuration(),
+		MaxBan:      ag.MaxBanDuration(),
+		Window:      ag.WindowDuration(),
+	}
+}
+
+// runFreeDNSToken issues a FreeDNS update token for a user's host, revokes
+// it with -revoke, or lists the issued tokens with -list. Tokens are only
+// issued for hosts matching the user's owned_hosts or hosts patterns.
+func runFreeDNSToken(args []string) error {
+	fs := flag.NewFlagSet("freedns-token", flag.ExitOnError)
+	configPath := fs.String("config", getEnvOrDefault("CONFIG_PATH", "config.yaml"), "Path to configuration file")
+	username := fs.String("user", "", "User that owns the host")
+	host := fs.String("host", "", "Hostname the token updates")
+	list := fs.Bool("list", false, "List issued tokens instead of creating one")
+	revoke := fs.Bool("revoke", false, "Revoke the token of -user and -host instead of creating one")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if err := config.LoadConfig(*configPath); err != nil {
+		return err
+	}
+	store, err := state.Open(config.Current().Server.StatePath())
+	if err != nil {
+		return err
+	}
+
+	if *list {
+		for _, e := range store.FreeDNSTokens() {
+			fmt.Printf("%s\t%s\t%s\n", e.Username, e.Host, e.Token)
+		}
+		return nil
+	}
+
+	if *username == "" || *host == "" {
+		return fmt.Errorf("-user and -host are required")
+	}
+	domain, err := mode.NormalizeHostname(*host)
+	if err != nil {
+		return fmt.Errorf("invalid host %q: %v", *host, err)
+	}
+	if *revoke {
+		revoked, err := store.RevokeFreeDNSToken(*username, domain)
+		if err != nil {
+			return err
+		}
+		if !revoked {
+			return fmt.Errorf("no token issued to user %q for host %q", *username, domain)
+		}
+		fmt.Printf("Revoked the token of %s for %s\n", *username, domain)
+		return nil
+	}
+
+	u := config.GetUser(*username)
+	if u == nil {
+		return fmt.Errorf("unknown user %q", *username)
+	}
+	if !u.ListsHost(domain) {
+		return fmt.Errorf("host %q does not match the owned_hosts or hosts patterns of user %q", domain, *username)
+	}
+	token, err := store.IssueFreeDNSToken(*username, domain)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s\n", token)
+	fmt.Printf("Update URLs: /dynamic/update.php?%s  or  %s%s/\n", token, mode.FreeDNSV2Prefix, token)
+	return nil
+}
+
+// runHashPassword prints the password_hash (or gnudip_md5) value for a
+// password given as an argument or read from the first line of stdin.
+func runHashPassword(args []string) error {
+	fs := flag.NewFlagSet("hash-password", flag.ExitOnError)
+	scheme := fs.String("scheme", config.SchemeBcrypt, "Hash scheme: bcrypt, argon2id, or gnudip for the gnudip_md5 value")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	password := fs.Arg(0)
+	if fs.NArg() == 0 {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return fmt.Errorf("reading password from stdin: %v", err)
+		}
+		password = strings.TrimRight(line, "\r\n")
+	}
+	if password == "" {
+		return fmt.Errorf("password must not be empty")
+	}
+	hash, err := mode.HashPassword(*scheme, password)
+	if err != nil {
+		return err
+	}
+	fmt.Println(hash)
+	return nil
+}
+
 func getEnvOrDefault(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
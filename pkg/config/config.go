@@ -1,8 +1,21 @@
 package config
 
 import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net"
 	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
 
+	"github.com/NewFuture/CloudDDNS/pkg/logging"
+	"golang.org/x/crypto/argon2"
 	"gopkg.in/yaml.v3"
 )
 
@@ -12,31 +25,612 @@ type Config struct {
 }
 
 type ServerConfig struct {
-	TCPPort  int `yaml:"tcp_port"`
-	HTTPPort int `yaml:"http_port"`
+	TCPPort          int    `yaml:"tcp_port"`
+	HTTPPort         int    `yaml:"http_port"`
+	RequireUserAgent bool   `yaml:"require_user_agent"` // DynDNS 请求缺少 User-Agent 时返回 badagent
+	StateFile        string `yaml:"state_file"`         // 运行时状态 (FreeDNS token 等) 的 JSON 文件，留空为 state.json
+	// GnuDIP HTTP 挑战 (salt/time) 的有效期与允许的时钟偏差 (秒)，留空分别为 60 与 30
+	GnuDIPChallengeTTL int `yaml:"gnudip_challenge_ttl"`
+	GnuDIPClockSkew    int `yaml:"gnudip_clock_skew"`
+	// GnuDIP TCP 会话：单个连接最多处理的请求行数 (留空为 1，即处理一次后关闭) 与等待下一行的空闲超时 (秒，留空为 30)
+	GnuDIPTCPMaxRequests int `yaml:"gnudip_tcp_max_requests"`
+	GnuDIPTCPIdleTimeout int `yaml:"gnudip_tcp_idle_timeout"`
+	// TCP 监听的并发与速率限制 (0 为不限制)：全局连接数、单个源 IP 连接数、每秒接受的新连接数
+	TCPMaxConns      int     `yaml:"tcp_max_conns"`
+	TCPMaxConnsPerIP int     `yaml:"tcp_max_conns_per_ip"`
+	TCPAcceptRate    float64 `yaml:"tcp_accept_rate"`
+	// 发送 salt 后等待第一行请求的超时 (秒)，留空为 10
+	TCPHandshakeTimeout int `yaml:"tcp_handshake_timeout"`
+	// 认证失败的封禁策略 (max_failures 为 0 时关闭)
+	AuthGuard AuthGuardConfig `yaml:"auth_guard"`
+	// 访问 /admin/ 管理接口使用的 Bearer token，留空则关闭管理接口
+	AdminToken string `yaml:"admin_token"`
+	// 日志级别 debug/info/warn/error，留空为 info；-debug 启动参数会强制 debug
+	LogLevel string `yaml:"log_level"`
+	// 日志格式 text 或 json，留空为 text
+	LogFormat string `yaml:"log_format"`
+}
+
+// AuthGuardConfig 按用户名与源 IP 统计认证失败：连续失败 max_failures 次后封禁 ban 秒，
+// 之后每次失败翻倍直至 max_ban 秒；封禁结束后 window 秒内没有新的失败则清零
+type AuthGuardConfig struct {
+	MaxFailures int `yaml:"max_failures"`
+	Ban         int `yaml:"ban"`
+	MaxBan      int `yaml:"max_ban"`
+	Window      int `yaml:"window"`
+}
+
+// 认证失败封禁的默认时长
+const (
+	DefaultAuthBan    = time.Minute
+	DefaultAuthMaxBan = time.Hour
+	DefaultAuthWindow = 15 * time.Minute
+)
+
+// BanDuration 返回首次封禁的时长
+func (g AuthGuardConfig) BanDuration() time.Duration {
+	if g.Ban > 0 {
+		return time.Duration(g.Ban) * time.Second
+	}
+	return DefaultAuthBan
+}
+
+// MaxBanDuration 返回封禁时长的上限
+func (g AuthGuardConfig) MaxBanDuration() time.Duration {
+	if g.MaxBan > 0 {
+		return time.Duration(g.MaxBan) * time.Second
+	}
+	return DefaultAuthMaxBan
+}
+
+// WindowDuration 返回失败计数在封禁结束后保留的时长
+func (g AuthGuardConfig) WindowDuration() time.Duration {
+	if g.Window > 0 {
+		return time.Duration(g.Window) * time.Second
+	}
+	return DefaultAuthWindow
+}
+
+// GnuDIP HTTP 挑战有效期与时钟偏差的默认值
+const (
+	DefaultChallengeTTL = 60 * time.Second
+	DefaultClockSkew    = 30 * time.Second
+)
+
+// ChallengeTTL 返回 GnuDIP HTTP 挑战的有效期
+func (s ServerConfig) ChallengeTTL() time.Duration {
+	if s.GnuDIPChallengeTTL > 0 {
+		return time.Duration(s.GnuDIPChallengeTTL) * time.Second
+	}
+	return DefaultChallengeTTL
+}
+
+// ClockSkew 返回校验 GnuDIP 挑战时间时允许的时钟偏差
+func (s ServerConfig) ClockSkew() time.Duration {
+	if s.GnuDIPClockSkew > 0 {
+		return time.Duration(s.GnuDIPClockSkew) * time.Second
+	}
+	return DefaultClockSkew
+}
+
+// GnuDIP TCP 会话的默认请求上限与空闲超时
+const (
+	DefaultTCPMaxRequests = 1
+	DefaultTCPIdleTimeout = 30 * time.Second
+)
+
+// TCPMaxRequests 返回单个 GnuDIP TCP 连接最多处理的请求数
+func (s ServerConfig) TCPMaxRequests() int {
+	if s.GnuDIPTCPMaxRequests > 0 {
+		return s.GnuDIPTCPMaxRequests
+	}
+	return DefaultTCPMaxRequests
+}
+
+// TCPIdleTimeout 返回 GnuDIP TCP 连接等待下一行请求的超时时间
+func (s ServerConfig) TCPIdleTimeout() time.Duration {
+	if s.GnuDIPTCPIdleTimeout > 0 {
+		return time.Duration(s.GnuDIPTCPIdleTimeout) * time.Second
+	}
+	return DefaultTCPIdleTimeout
+}
+
+// DefaultTCPHandshakeTimeout 未配置 tcp_handshake_timeout 时等待首行请求的时长
+const DefaultTCPHandshakeTimeout = 10 * time.Second
+
+// HandshakeTimeout 返回 GnuDIP TCP 连接发送 salt 后等待首行请求的超时时间
+func (s ServerConfig) HandshakeTimeout() time.Duration {
+	if s.TCPHandshakeTimeout > 0 {
+		return time.Duration(s.TCPHandshakeTimeout) * time.Second
+	}
+	return DefaultTCPHandshakeTimeout
+}
+
+// DefaultStateFile 未配置 state_file 时使用的状态文件
+const DefaultStateFile = "state.json"
+
+// StatePath 返回状态文件路径
+func (s ServerConfig) StatePath() string {
+	if s.StateFile != "" {
+		return s.StateFile
+	}
+	return DefaultStateFile
+}
+
+// 离线请求 (GnuDIP reqc=1) 的处理策略
+const (
+	OfflineZero   = "zero"   // 写入 0.0.0.0 (默认)
+	OfflineDelete = "delete" // 删除记录
+	OfflinePause  = "pause"  // 暂停记录，下次正常更新时自动恢复
+	OfflinePark   = "park"   // 指向 parking_ip
+)
+
+// RecordConfig 解析记录的可选属性，留空时使用服务商默认值
+type RecordConfig struct {
+	TTL    int    `yaml:"ttl"`
+	Line   string `yaml:"line"`   // 线路：阿里云 Line (如 telecom)，腾讯云 RecordLine (如 电信)
+	Remark string `yaml:"remark"` // 记录备注
+}
+
+// DuckDNSConfig DuckDNS 兼容接口的 token 与短域名所属 zone
+type DuckDNSConfig struct {
+	Token string `yaml:"token"` // 客户端提交的 token，映射到当前用户
+	Zone  string `yaml:"zone"`  // 短域名展开的 zone，如 "home.example.com"
+}
+
+// HostConfig 按主机名匹配的记录属性，覆盖用户级默认值
+type HostConfig struct {
+	Pattern      string `yaml:"pattern"` // path.Match 通配，如 "*.home.example.com"
+	RecordConfig `yaml:",inline"`
+}
+
+// HostKeyConfig 单个主机的独立更新密钥 (Hurricane Electric 风格)，只能更新该主机的记录
+type HostKeyConfig struct {
+	Host string `yaml:"host"` // 完整主机名，IDN 使用 punycode 形式
+	Key  string `yaml:"key"`
 }
 
 type UserConfig struct {
-	Username string `yaml:"username"`
-	Password string `yaml:"password"` // 用作 API SecretKey
-	Provider string `yaml:"provider"`
+	Username      string `yaml:"username"`
+	Password      string `yaml:"password"` // 用作 API SecretKey
+	Provider      string `yaml:"provider"`
+	Offline       string `yaml:"offline"`    // 离线策略：zero/delete/pause/park，留空等同 zero
+	ParkingIP     string `yaml:"parking_ip"` // offline=park 时使用的停放 IP
+	RecordConfig  `yaml:",inline"`
+	Hosts         []HostConfig    `yaml:"hosts"`
+	AllowApex     *bool           `yaml:"allow_apex"`     // 是否允许更新 zone 根 (@)，留空默认允许
+	AllowWildcard bool            `yaml:"allow_wildcard"` // 是否允许更新泛解析记录 (*.example.com)，默认禁止
+	Blocked       bool            `yaml:"blocked"`        // 封禁用户，认证通过后返回 abuse
+	DuckDNS       DuckDNSConfig   `yaml:"duckdns"`
+	HostKeys      []HostKeyConfig `yaml:"host_keys"` // 按主机的更新密钥，用户名为主机名 (或不带用户名) 时使用
+	// CloudflareTokens Cloudflare 兼容 API (/client/v4) 的 Bearer token，映射到当前用户
+	CloudflareTokens []string `yaml:"cloudflare_tokens"`
+	// PasswordHash 客户端密码的 bcrypt/argon2id 哈希，设置后替代 password 校验客户端 (password 仍作 API SecretKey)
+	PasswordHash string `yaml:"password_hash"`
+	// PasswordSchemes 允许的密码校验方式，留空时按存储的密码自动选择
+	PasswordSchemes []string `yaml:"password_schemes"`
+	// GnuDIPMD5 GnuDIP 挑战使用的登录密码 MD5 (32 位十六进制)，登录密码与 password 不同时配置
+	GnuDIPMD5 string `yaml:"gnudip_md5"`
+	// OwnedHosts 账号拥有的主机名通配 (path.Match)，DtDNS / Namecheap 请求不带用户名时据此定位账号
+	OwnedHosts []string `yaml:"owned_hosts"`
 }
 
-var GlobalConfig Config
+// 客户端密码的校验方式
+const (
+	SchemePlain        = "plain"         // 明文相等
+	SchemeMD5          = "md5"           // 客户端提交 md5(password) 的十六进制
+	SchemeSHA256       = "sha256"        // 客户端提交 sha256(password) 的十六进制
+	SchemeBase64       = "base64"        // 客户端提交 base64(password)
+	SchemeStoredMD5    = "stored-md5"    // 配置中保存的是客户端密码的 md5 十六进制
+	SchemeStoredSHA256 = "stored-sha256" // 配置中保存的是客户端密码的 sha256 十六进制
+	SchemeStoredBase64 = "stored-base64" // 配置中保存的是客户端密码的 base64
+	SchemeGnuDIP       = "gnudip"        // GnuDIP 加盐挑战 (HTTP salt/sign 与 TCP 哈希)
+	SchemeBcrypt       = "bcrypt"        // 配置中保存 bcrypt 哈希 ($2a$/$2b$/$2y$)
+	SchemeArgon2id     = "argon2id"      // 配置中保存 PHC 格式的 argon2id 哈希
+)
+
+// legacySchemes 未配置 password_schemes 且存储的不是慢哈希时接受的方式 (兼容旧版本)
+var legacySchemes = []string{
+	SchemePlain, SchemeMD5, SchemeSHA256, SchemeBase64,
+	SchemeStoredMD5, SchemeStoredSHA256, SchemeStoredBase64, SchemeGnuDIP,
+}
+
+// IsBcryptHash 判断字符串是否为 bcrypt 哈希
+func IsBcryptHash(s string) bool {
+	return strings.HasPrefix(s, "$2a$") || strings.HasPrefix(s, "$2b$") || strings.HasPrefix(s, "$2y$")
+}
 
+// IsArgon2Hash 判断字符串是否为 PHC 格式的 argon2id 哈希
+func IsArgon2Hash(s string) bool {
+	return strings.HasPrefix(s, "$argon2id$")
+}
+
+// maxArgon2Memory argon2id 哈希允许的最大内存参数 (KiB)，即 1 GiB
+const maxArgon2Memory = 1024 * 1024
+
+// Argon2Hash 解析后的 PHC 格式 argon2id 哈希
+type Argon2Hash struct {
+	Memory  uint32 // 内存 (KiB)
+	Time    uint32 // 迭代次数
+	Threads uint8  // 并行度
+	Salt    []byte
+	Key     []byte
+}
+
+// ParseArgon2Hash 解析 $argon2id$v=19$m=<KiB>,t=<迭代>,p=<并行>$<salt>$<hash>，
+// 拒绝会让 argon2.IDKey panic 或占用过多内存的参数
+func ParseArgon2Hash(encoded string) (*Argon2Hash, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[0] != "" || parts[1] != "argon2id" {
+		return nil, fmt.Errorf("invalid argon2id hash")
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, fmt.Errorf("unsupported argon2id version %q", parts[2])
+	}
+	h := &Argon2Hash{}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &h.Memory, &h.Time, &h.Threads); err != nil {
+		return nil, fmt.Errorf("invalid argon2id parameters %q: %w", parts[3], err)
+	}
+	switch {
+	case h.Time < 1:
+		return nil, fmt.Errorf("argon2id iterations t must be at least 1")
+	case h.Threads < 1:
+		return nil, fmt.Errorf("argon2id parallelism p must be at least 1")
+	case h.Memory > maxArgon2Memory:
+		return nil, fmt.Errorf("argon2id memory m=%d exceeds the %d KiB limit", h.Memory, maxArgon2Memory)
+	}
+	var err error
+	if h.Salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, fmt.Errorf("invalid argon2id salt: %w", err)
+	}
+	if len(h.Salt) == 0 {
+		return nil, fmt.Errorf("argon2id salt must not be empty")
+	}
+	if h.Key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return nil, fmt.Errorf("invalid argon2id hash: %w", err)
+	}
+	if len(h.Key) == 0 {
+		return nil, fmt.Errorf("argon2id hash must not be empty")
+	}
+	return h, nil
+}
+
+// DefaultPasswordSchemes 返回未配置 password_schemes 时对 stored 接受的校验方式：
+// 慢哈希只按对应算法校验，其他情况沿用旧版本的全部方式
+func DefaultPasswordSchemes(stored string) []string {
+	switch {
+	case IsBcryptHash(stored):
+		return []string{SchemeBcrypt}
+	case IsArgon2Hash(stored):
+		return []string{SchemeArgon2id}
+	default:
+		return legacySchemes
+	}
+}
+
+// AuthSecret 返回校验客户端密码时使用的存储值：password_hash 优先，否则为 password
+func (u *UserConfig) AuthSecret() string {
+	if u.PasswordHash != "" {
+		return u.PasswordHash
+	}
+	return u.Password
+}
+
+// SchemesFor 返回校验存储值 stored 时允许的方式；未配置 password_schemes 时，
+// 慢哈希用户配置了 gnudip_md5 即同时允许 GnuDIP 挑战
+func (u *UserConfig) SchemesFor(stored string) []string {
+	if len(u.PasswordSchemes) > 0 {
+		return u.PasswordSchemes
+	}
+	schemes := DefaultPasswordSchemes(stored)
+	if u.GnuDIPMD5 != "" && (IsBcryptHash(stored) || IsArgon2Hash(stored)) {
+		schemes = append(schemes, SchemeGnuDIP)
+	}
+	return schemes
+}
+
+// GnuDIPPasswordMD5 返回 GnuDIP 挑战使用的密码 MD5 十六进制：gnudip_md5 优先，否则为 md5(password)
+func (u *UserConfig) GnuDIPPasswordMD5() string {
+	if u.GnuDIPMD5 != "" {
+		return strings.ToLower(u.GnuDIPMD5)
+	}
+	sum := md5.Sum([]byte(u.Password))
+	return hex.EncodeToString(sum[:])
+}
+
+// AllowsScheme 返回用户是否允许使用指定的校验方式
+func (u *UserConfig) AllowsScheme(scheme string) bool {
+	for _, s := range u.SchemesFor(u.AuthSecret()) {
+		if s == scheme {
+			return true
+		}
+	}
+	return false
+}
+
+// ApexAllowed 返回用户是否可以更新 zone 根记录
+func (u *UserConfig) ApexAllowed() bool {
+	return u.AllowApex == nil || *u.AllowApex
+}
+
+// current 为服务使用的配置。重新加载时整体替换指针而不修改已发布的配置，
+// 处理中的请求继续使用已取得的快照，因此 SIGHUP 重新加载与请求处理之间没有数据竞争
+var current atomic.Pointer[Config]
+
+// Current 返回当前配置，未加载时为空配置；返回值只读，修改配置需构造新值并调用 SetCurrent
+func Current() *Config {
+	if c := current.Load(); c != nil {
+		return c
+	}
+	return &Config{}
+}
+
+// SetCurrent 替换当前配置
+func SetCurrent(cfg *Config) {
+	current.Store(cfg)
+}
+
+// LoadConfig 读取并校验配置文件，成功后才替换当前配置，重新加载失败时沿用原配置
 func LoadConfig(path string) error {
-	data, err := os.ReadFile(path)
+	cfg, err := readConfig(path)
 	if err != nil {
 		return err
 	}
-	return yaml.Unmarshal(data, &GlobalConfig)
+	SetCurrent(cfg)
+	return nil
+}
+
+// readConfig 解析配置文件，展开 ${ENV_VAR} 与 *_file 引用后解码并校验
+func readConfig(file string) (*Config, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+	cfg := &Config{}
+	if root.Kind != 0 {
+		if err := resolveSecrets(&root, filepath.Dir(file)); err != nil {
+			return nil, err
+		}
+		if err := root.Decode(cfg); err != nil {
+			return nil, err
+		}
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// validate 检查用户配置中的策略取值
+func (c *Config) validate() error {
+	if c.Server.GnuDIPChallengeTTL < 0 || c.Server.GnuDIPClockSkew < 0 {
+		return fmt.Errorf("server: gnudip_challenge_ttl and gnudip_clock_skew must not be negative")
+	}
+	if c.Server.GnuDIPTCPMaxRequests < 0 || c.Server.GnuDIPTCPIdleTimeout < 0 {
+		return fmt.Errorf("server: gnudip_tcp_max_requests and gnudip_tcp_idle_timeout must not be negative")
+	}
+	if c.Server.TCPMaxConns < 0 || c.Server.TCPMaxConnsPerIP < 0 || c.Server.TCPAcceptRate < 0 || c.Server.TCPHandshakeTimeout < 0 {
+		return fmt.Errorf("server: tcp_max_conns, tcp_max_conns_per_ip, tcp_accept_rate and tcp_handshake_timeout must not be negative")
+	}
+	if g := c.Server.AuthGuard; g.MaxFailures < 0 || g.Ban < 0 || g.MaxBan < 0 || g.Window < 0 {
+		return fmt.Errorf("server: auth_guard values must not be negative")
+	}
+	if _, err := logging.ParseLevel(c.Server.LogLevel); err != nil {
+		return fmt.Errorf("server: log_level: %v", err)
+	}
+	if _, err := logging.ParseFormat(c.Server.LogFormat); err != nil {
+		return fmt.Errorf("server: log_format: %v", err)
+	}
+	duckTokens := make(map[string]string)
+	hostKeys := make(map[string]string)
+	cfTokens := make(map[string]string)
+	for _, u := range c.Users {
+		for _, scheme := range u.PasswordSchemes {
+			switch scheme {
+			case SchemePlain, SchemeMD5, SchemeSHA256, SchemeBase64, SchemeStoredMD5, SchemeStoredSHA256,
+				SchemeStoredBase64, SchemeGnuDIP, SchemeBcrypt, SchemeArgon2id:
+			default:
+				return fmt.Errorf("user %q: unknown password scheme %q", u.Username, scheme)
+			}
+		}
+		if u.PasswordHash != "" && !IsBcryptHash(u.PasswordHash) && !IsArgon2Hash(u.PasswordHash) {
+			return fmt.Errorf("user %q: password_hash must be a bcrypt or argon2id hash", u.Username)
+		}
+		if IsArgon2Hash(u.PasswordHash) {
+			if _, err := ParseArgon2Hash(u.PasswordHash); err != nil {
+				return fmt.Errorf("user %q: password_hash: %w", u.Username, err)
+			}
+		}
+		if u.GnuDIPMD5 != "" {
+			if b, err := hex.DecodeString(u.GnuDIPMD5); err != nil || len(b) != md5.Size {
+				return fmt.Errorf("user %q: gnudip_md5 must be 32 hexadecimal characters", u.Username)
+			}
+		}
+		// 客户端密码以 password_hash 校验时，password 只是云厂商 SecretKey，GnuDIP 挑战必须基于 gnudip_md5
+		if u.PasswordHash != "" && u.GnuDIPMD5 == "" && slices.Contains(u.PasswordSchemes, SchemeGnuDIP) {
+			return fmt.Errorf("user %q: password scheme %q with password_hash requires gnudip_md5", u.Username, SchemeGnuDIP)
+		}
+		for _, token := range u.CloudflareTokens {
+			if token == "" {
+				return fmt.Errorf("user %q: cloudflare_tokens must not contain empty tokens", u.Username)
+			}
+			if owner, ok := cfTokens[token]; ok {
+				return fmt.Errorf("user %q: cloudflare token already used by user %q", u.Username, owner)
+			}
+			cfTokens[token] = u.Username
+		}
+		for _, hk := range u.HostKeys {
+			host := normalizeHost(hk.Host)
+			if host == "" || hk.Key == "" {
+				return fmt.Errorf("user %q: host_keys entries require host and key", u.Username)
+			}
+			if owner, ok := hostKeys[host]; ok {
+				return fmt.Errorf("user %q: host key for %q already defined by user %q", u.Username, hk.Host, owner)
+			}
+			hostKeys[host] = u.Username
+		}
+		if u.DuckDNS.Token != "" {
+			if u.DuckDNS.Zone == "" {
+				return fmt.Errorf("user %q: duckdns.token requires duckdns.zone", u.Username)
+			}
+			if owner, ok := duckTokens[u.DuckDNS.Token]; ok {
+				return fmt.Errorf("user %q: duckdns.token already used by user %q", u.Username, owner)
+			}
+			duckTokens[u.DuckDNS.Token] = u.Username
+		}
+		switch u.Offline {
+		case "", OfflineZero, OfflineDelete, OfflinePause:
+		case OfflinePark:
+			if net.ParseIP(u.ParkingIP) == nil {
+				return fmt.Errorf("user %q: offline=park requires a valid parking_ip, got %q", u.Username, u.ParkingIP)
+			}
+		default:
+			return fmt.Errorf("user %q: unknown offline policy %q", u.Username, u.Offline)
+		}
+		if u.TTL < 0 {
+			return fmt.Errorf("user %q: ttl must not be negative", u.Username)
+		}
+		for _, h := range u.Hosts {
+			if _, err := path.Match(h.Pattern, ""); err != nil || h.Pattern == "" {
+				return fmt.Errorf("user %q: invalid host pattern %q", u.Username, h.Pattern)
+			}
+			if h.TTL < 0 {
+				return fmt.Errorf("user %q: host %q ttl must not be negative", u.Username, h.Pattern)
+			}
+		}
+		for _, pattern := range u.OwnedHosts {
+			if _, err := path.Match(pattern, ""); err != nil || pattern == "" {
+				return fmt.Errorf("user %q: invalid owned_hosts pattern %q", u.Username, pattern)
+			}
+		}
+	}
+	return nil
+}
+
+// RecordFor 返回 domain 适用的记录属性：首个匹配的 hosts 规则逐项覆盖用户级默认值
+func (u *UserConfig) RecordFor(domain string) RecordConfig {
+	rc := u.RecordConfig
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	for _, h := range u.Hosts {
+		if ok, _ := path.Match(strings.ToLower(h.Pattern), domain); !ok {
+			continue
+		}
+		if h.TTL != 0 {
+			rc.TTL = h.TTL
+		}
+		if h.Line != "" {
+			rc.Line = h.Line
+		}
+		if h.Remark != "" {
+			rc.Remark = h.Remark
+		}
+		break
+	}
+	return rc
+}
+
+// OwnsHost 返回 domain 是否匹配用户的任一 owned_hosts 规则
+func (u *UserConfig) OwnsHost(domain string) bool {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	for _, pattern := range u.OwnedHosts {
+		if ok, _ := path.Match(strings.ToLower(pattern), domain); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ListsHost 返回 domain 是否匹配用户的 owned_hosts 或 hosts 规则，
+// 用于为指定主机签发凭据 (如 FreeDNS token) 前确认主机属于该用户
+func (u *UserConfig) ListsHost(domain string) bool {
+	if u.OwnsHost(domain) {
+		return true
+	}
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	for _, h := range u.Hosts {
+		if ok, _ := path.Match(strings.ToLower(h.Pattern), domain); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// GetUsersByHost 返回 owned_hosts 匹配 domain 的用户，供只提交主机名与密码的协议 (如 DtDNS) 定位账号。
+// hosts 只用于覆盖记录属性，不作为账号归属依据
+func GetUsersByHost(domain string) []*UserConfig {
+	var users []*UserConfig
+	all := Current().Users
+	for i := range all {
+		if all[i].OwnsHost(domain) {
+			users = append(users, &all[i])
+		}
+	}
+	return users
+}
+
+// GetUserByDuckDNSToken 根据 DuckDNS token 查找配置
+func GetUserByDuckDNSToken(token string) *UserConfig {
+	if token == "" {
+		return nil
+	}
+	users := Current().Users
+	for i := range users {
+		if users[i].DuckDNS.Token == token {
+			return &users[i]
+		}
+	}
+	return nil
+}
+
+// GetUserByCloudflareToken 根据 Cloudflare 兼容 API 的 Bearer token 查找配置
+func GetUserByCloudflareToken(token string) *UserConfig {
+	if token == "" {
+		return nil
+	}
+	users := Current().Users
+	for i := range users {
+		for _, t := range users[i].CloudflareTokens {
+			if t == token {
+				return &users[i]
+			}
+		}
+	}
+	return nil
+}
+
+// LookupHostKey 查找 domain 的独立更新密钥及所属用户，未配置时返回 nil
+func LookupHostKey(domain string) (*UserConfig, string) {
+	domain = normalizeHost(domain)
+	if domain == "" {
+		return nil, ""
+	}
+	users := Current().Users
+	for i := range users {
+		for _, hk := range users[i].HostKeys {
+			if normalizeHost(hk.Host) == domain {
+				return &users[i], hk.Key
+			}
+		}
+	}
+	return nil, ""
+}
+
+// normalizeHost 统一主机名的大小写与末尾的点
+func normalizeHost(host string) string {
+	return strings.ToLower(strings.TrimSuffix(strings.TrimSpace(host), "."))
 }
 
 // GetUser 根据用户名查找配置
 func GetUser(username string) *UserConfig {
-	for i := range GlobalConfig.Users {
-		if GlobalConfig.Users[i].Username == username {
-			return &GlobalConfig.Users[i]
+	users := Current().Users
+	for i := range users {
+		if users[i].Username == username {
+			return &users[i]
 		}
 	}
 	return nil
@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -22,6 +23,8 @@ users:
   - username: "user2"
     password: "pass2"
     provider: "tencent"
+    allow_apex: false
+    allow_wildcard: true
 `
 
 	err := os.WriteFile(configPath, []byte(configContent), 0644)
@@ -36,23 +39,29 @@ users:
 	}
 
 	// Verify server config
-	if GlobalConfig.Server.TCPPort != 3495 {
-		t.Errorf("Expected TCP port 3495, got %d", GlobalConfig.Server.TCPPort)
+	if Current().Server.TCPPort != 3495 {
+		t.Errorf("Expected TCP port 3495, got %d", Current().Server.TCPPort)
 	}
-	if GlobalConfig.Server.HTTPPort != 8080 {
-		t.Errorf("Expected HTTP port 8080, got %d", GlobalConfig.Server.HTTPPort)
+	if Current().Server.HTTPPort != 8080 {
+		t.Errorf("Expected HTTP port 8080, got %d", Current().Server.HTTPPort)
 	}
 
 	// Verify users
-	if len(GlobalConfig.Users) != 2 {
-		t.Errorf("Expected 2 users, got %d", len(GlobalConfig.Users))
+	if len(Current().Users) != 2 {
+		t.Errorf("Expected 2 users, got %d", len(Current().Users))
 	}
 
-	if GlobalConfig.Users[0].Username != "test_user" {
-		t.Errorf("Expected username 'test_user', got '%s'", GlobalConfig.Users[0].Username)
+	if Current().Users[0].Username != "test_user" {
+		t.Errorf("Expected username 'test_user', got '%s'", Current().Users[0].Username)
 	}
-	if GlobalConfig.Users[0].Provider != "aliyun" {
-		t.Errorf("Expected provider 'aliyun', got '%s'", GlobalConfig.Users[0].Provider)
+	if Current().Users[0].Provider != "aliyun" {
+		t.Errorf("Expected provider 'aliyun', got '%s'", Current().Users[0].Provider)
+	}
+	if !Current().Users[0].ApexAllowed() || Current().Users[0].AllowWildcard {
+		t.Errorf("Expected apex allowed and wildcard denied by default for user 1")
+	}
+	if Current().Users[1].ApexAllowed() || !Current().Users[1].AllowWildcard {
+		t.Errorf("Expected apex denied and wildcard allowed for user 2")
 	}
 }
 
@@ -85,16 +94,16 @@ func TestLoadConfigInvalidYAML(t *testing.T) {
 
 func TestGetUser(t *testing.T) {
 	// Save original config and restore after test
-	originalConfig := GlobalConfig
-	defer func() { GlobalConfig = originalConfig }()
+	originalConfig := Current()
+	defer SetCurrent(originalConfig)
 
 	// Setup test config
-	GlobalConfig = Config{
+	SetCurrent(&Config{
 		Users: []UserConfig{
 			{Username: "user1", Password: "pass1", Provider: "aliyun"},
 			{Username: "user2", Password: "pass2", Provider: "tencent"},
 		},
-	}
+	})
 
 	// Test finding existing user
 	user := GetUser("user1")
@@ -126,13 +135,234 @@ func TestGetUser(t *testing.T) {
 
 func TestGetUserEmptyConfig(t *testing.T) {
 	// Save original config and restore after test
-	originalConfig := GlobalConfig
-	defer func() { GlobalConfig = originalConfig }()
+	originalConfig := Current()
+	defer SetCurrent(originalConfig)
 
-	GlobalConfig = Config{Users: []UserConfig{}}
+	SetCurrent(&Config{Users: []UserConfig{}})
 
 	user := GetUser("anyuser")
 	if user != nil {
 		t.Errorf("Expected nil for empty config, got %v", user)
 	}
 }
+
+func TestLoadConfigUserValidation(t *testing.T) {
+	originalConfig := Current()
+	defer SetCurrent(originalConfig)
+
+	tests := []struct {
+		name    string
+		user    string
+		wantErr bool
+	}{
+		{name: "delete policy", user: "offline: delete", wantErr: false},
+		{name: "park with IP", user: "offline: park\n    parking_ip: 192.0.2.1", wantErr: false},
+		{name: "park without IP", user: "offline: park", wantErr: true},
+		{name: "unknown policy", user: "offline: vanish", wantErr: true},
+		{name: "host overrides", user: "ttl: 600\n    hosts:\n      - pattern: \"*.example.com\"\n        line: telecom", wantErr: false},
+		{name: "invalid host pattern", user: "hosts:\n      - pattern: \"[\"", wantErr: true},
+		{name: "invalid owned host pattern", user: "owned_hosts: [\"[\"]", wantErr: true},
+		{name: "negative ttl", user: "ttl: -1", wantErr: true},
+		{name: "duckdns token with zone", user: "duckdns:\n      token: \"t\"\n      zone: \"ddns.example.com\"", wantErr: false},
+		{name: "duckdns token without zone", user: "duckdns:\n      token: \"t\"", wantErr: true},
+		{name: "host key", user: "host_keys:\n      - host: \"dyn.example.com\"\n        key: \"k\"", wantErr: false},
+		{name: "host key without key", user: "host_keys:\n      - host: \"dyn.example.com\"", wantErr: true},
+		{name: "cloudflare tokens", user: "cloudflare_tokens: [\"a\", \"b\"]", wantErr: false},
+		{name: "empty cloudflare token", user: "cloudflare_tokens: [\"\"]", wantErr: true},
+		{name: "password schemes", user: "password_schemes: [plain, gnudip]", wantErr: false},
+		{name: "unknown password scheme", user: "password_schemes: [rot13]", wantErr: true},
+		{name: "bcrypt password hash", user: "password_hash: \"$2a$10$abcdefghijklmnopqrstuuABCDEFGHIJKLMNOPQRSTUVWXYZ01234\"", wantErr: false},
+		{name: "argon2id password hash", user: "password_hash: \"$argon2id$v=19$m=1024,t=1,p=1$MDEyMzQ1Njc4OWFiY2RlZg$YWJjZGVmZ2hpamtsbW5vcHFyc3R1dnd4eXoxMjM0NTY\"", wantErr: false},
+		{name: "argon2id zero iterations", user: "password_hash: \"$argon2id$v=19$m=1024,t=0,p=1$MDEyMzQ1Njc4OWFiY2RlZg$YWJjZGVmZ2hpamtsbW5vcHFyc3R1dnd4eXoxMjM0NTY\"", wantErr: true},
+		{name: "argon2id zero parallelism", user: "password_hash: \"$argon2id$v=19$m=1024,t=1,p=0$MDEyMzQ1Njc4OWFiY2RlZg$YWJjZGVmZ2hpamtsbW5vcHFyc3R1dnd4eXoxMjM0NTY\"", wantErr: true},
+		{name: "argon2id huge memory", user: "password_hash: \"$argon2id$v=19$m=4194304,t=1,p=1$MDEyMzQ1Njc4OWFiY2RlZg$YWJjZGVmZ2hpamtsbW5vcHFyc3R1dnd4eXoxMjM0NTY\"", wantErr: true},
+		{name: "argon2id empty salt", user: "password_hash: \"$argon2id$v=19$m=1024,t=1,p=1$$YWJjZGVmZ2hpamtsbW5vcHFyc3R1dnd4eXoxMjM0NTY\"", wantErr: true},
+		{name: "argon2id empty hash", user: "password_hash: \"$argon2id$v=19$m=1024,t=1,p=1$MDEyMzQ1Njc4OWFiY2RlZg$\"", wantErr: true},
+		{name: "gnudip md5", user: "gnudip_md5: \"5EBE2294ECD0E0F08EAB7690D2A6EE69\"", wantErr: false},
+		{name: "gnudip md5 wrong length", user: "gnudip_md5: \"5ebe2294\"", wantErr: true},
+		{name: "password hash not a slow hash", user: "password_hash: \"5ebe2294ecd0e0f08eab7690d2a6ee69\"", wantErr: true},
+		{name: "gnudip scheme with password hash needs gnudip md5", user: "password_hash: \"$2a$10$abcdefghijklmnopqrstuuABCDEFGHIJKLMNOPQRSTUVWXYZ01234\"\n    password_schemes: [bcrypt, gnudip]", wantErr: true},
+		{name: "gnudip scheme with password hash and gnudip md5", user: "password_hash: \"$2a$10$abcdefghijklmnopqrstuuABCDEFGHIJKLMNOPQRSTUVWXYZ01234\"\n    gnudip_md5: \"5ebe2294ecd0e0f08eab7690d2a6ee69\"\n    password_schemes: [bcrypt, gnudip]", wantErr: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "config.yaml")
+			content := "users:\n  - username: \"u\"\n    password: \"p\"\n    provider: \"aliyun\"\n    " + tt.user + "\n"
+			if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+				t.Fatalf("Failed to create test config: %v", err)
+			}
+			err := LoadConfig(configPath)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGetUserByDuckDNSToken(t *testing.T) {
+	originalConfig := Current()
+	defer SetCurrent(originalConfig)
+
+	SetCurrent(&Config{Users: []UserConfig{
+		{Username: "a", DuckDNS: DuckDNSConfig{Token: "token-a", Zone: "a.example.com"}},
+		{Username: "b"},
+	}})
+	if u := GetUserByDuckDNSToken("token-a"); u == nil || u.Username != "a" {
+		t.Fatalf("GetUserByDuckDNSToken(token-a) = %v, want user a", u)
+	}
+	if u := GetUserByDuckDNSToken(""); u != nil {
+		t.Fatalf("empty token should not match, got %q", u.Username)
+	}
+
+	dup := &Config{Users: []UserConfig{
+		{Username: "a", DuckDNS: DuckDNSConfig{Token: "token-a", Zone: "a.example.com"}},
+		{Username: "b", DuckDNS: DuckDNSConfig{Token: "token-a", Zone: "b.example.com"}},
+	}}
+	if err := dup.validate(); err == nil {
+		t.Fatal("duplicate duckdns token should be rejected")
+	}
+}
+
+func TestGetUserByCloudflareToken(t *testing.T) {
+	originalConfig := Current()
+	defer SetCurrent(originalConfig)
+
+	SetCurrent(&Config{Users: []UserConfig{
+		{Username: "a", CloudflareTokens: []string{"token-a1", "token-a2"}},
+		{Username: "b"},
+	}})
+	if u := GetUserByCloudflareToken("token-a2"); u == nil || u.Username != "a" {
+		t.Fatalf("GetUserByCloudflareToken(token-a2) = %v, want user a", u)
+	}
+	if u := GetUserByCloudflareToken(""); u != nil {
+		t.Fatalf("empty token should not match, got %q", u.Username)
+	}
+
+	dup := &Config{Users: []UserConfig{
+		{Username: "a", CloudflareTokens: []string{"token-a1", "token-a2"}},
+		{Username: "b", CloudflareTokens: []string{"token-a1"}},
+	}}
+	if err := dup.validate(); err == nil {
+		t.Fatal("duplicate cloudflare token should be rejected")
+	}
+}
+
+func TestLookupHostKey(t *testing.T) {
+	originalConfig := Current()
+	defer SetCurrent(originalConfig)
+
+	SetCurrent(&Config{Users: []UserConfig{
+		{Username: "a", HostKeys: []HostKeyConfig{{Host: "Dyn.Example.com.", Key: "key-a"}}},
+		{Username: "b", HostKeys: []HostKeyConfig{{Host: "nas.example.com", Key: "key-b"}}},
+	}})
+	tests := []struct {
+		domain   string
+		wantUser string
+		wantKey  string
+	}{
+		{domain: "dyn.example.com", wantUser: "a", wantKey: "key-a"},
+		{domain: "NAS.example.com.", wantUser: "b", wantKey: "key-b"},
+		{domain: "www.example.com"},
+		{domain: ""},
+	}
+	for _, tt := range tests {
+		u, key := LookupHostKey(tt.domain)
+		gotUser := ""
+		if u != nil {
+			gotUser = u.Username
+		}
+		if gotUser != tt.wantUser || key != tt.wantKey {
+			t.Errorf("LookupHostKey(%q) = %q, %q, want %q, %q", tt.domain, gotUser, key, tt.wantUser, tt.wantKey)
+		}
+	}
+
+	dup := &Config{Users: []UserConfig{
+		{Username: "a", HostKeys: []HostKeyConfig{{Host: "Dyn.Example.com.", Key: "key-a"}}},
+		{Username: "b", HostKeys: []HostKeyConfig{{Host: "nas.example.com", Key: "key-b"}, {Host: "dyn.example.com", Key: "other"}}},
+	}}
+	if err := dup.validate(); err == nil {
+		t.Fatal("duplicate host key should be rejected")
+	}
+}
+
+func TestRecordFor(t *testing.T) {
+	u := UserConfig{
+		RecordConfig: RecordConfig{TTL: 600, Line: "默认", Remark: "ddns"},
+		Hosts: []HostConfig{
+			{Pattern: "nas.example.com", RecordConfig: RecordConfig{Line: "电信"}},
+			{Pattern: "*.Office.example.com", RecordConfig: RecordConfig{TTL: 120, Remark: "office"}},
+			{Pattern: "*.example.com", RecordConfig: RecordConfig{TTL: 300}},
+		},
+	}
+
+	tests := []struct {
+		domain string
+		want   RecordConfig
+	}{
+		{domain: "nas.example.com", want: RecordConfig{TTL: 600, Line: "电信", Remark: "ddns"}},
+		{domain: "cam.office.example.com.", want: RecordConfig{TTL: 120, Line: "默认", Remark: "office"}},
+		{domain: "www.example.com", want: RecordConfig{TTL: 300, Line: "默认", Remark: "ddns"}},
+		{domain: "example.org", want: RecordConfig{TTL: 600, Line: "默认", Remark: "ddns"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.domain, func(t *testing.T) {
+			if got := u.RecordFor(tt.domain); got != tt.want {
+				t.Errorf("RecordFor(%q) = %+v, want %+v", tt.domain, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetUsersByHost(t *testing.T) {
+	original := Current()
+	defer SetCurrent(original)
+	SetCurrent(&Config{Users: []UserConfig{
+		{Username: "home", OwnedHosts: []string{"*.home.example.com"}},
+		{Username: "office", OwnedHosts: []string{"*.office.example.com", "vpn.example.com"}},
+		// hosts only overrides record settings and does not claim ownership.
+		{Username: "records", Hosts: []HostConfig{{Pattern: "*.example.com"}}},
+		{Username: "plain"},
+	}})
+
+	tests := []struct {
+		domain string
+		want   []string
+	}{
+		{domain: "nas.home.example.com", want: []string{"home"}},
+		{domain: "VPN.example.com.", want: []string{"office"}},
+		{domain: "www.example.com", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.domain, func(t *testing.T) {
+			var got []string
+			for _, u := range GetUsersByHost(tt.domain) {
+				got = append(got, u.Username)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("GetUsersByHost(%q) = %v, want %v", tt.domain, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestListsHost(t *testing.T) {
+	u := UserConfig{
+		OwnedHosts: []string{"*.home.example.com"},
+		Hosts:      []HostConfig{{Pattern: "vpn.example.com"}},
+	}
+	tests := []struct {
+		domain string
+		want   bool
+	}{
+		{domain: "nas.home.example.com", want: true},
+		{domain: "VPN.example.com.", want: true},
+		{domain: "www.example.com", want: false},
+	}
+	for _, tt := range tests {
+		if got := u.ListsHost(tt.domain); got != tt.want {
+			t.Errorf("ListsHost(%q) = %v, want %v", tt.domain, got, tt.want)
+		}
+	}
+}
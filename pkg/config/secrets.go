@@ -0,0 +1,122 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// envPattern 匹配配置值中的 ${ENV_VAR} 引用，以及转义写法 $${ENV_VAR} (展开为字面量 ${ENV_VAR})
+var envPattern = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// secretFileKeys 可以改用 <key>_file 从文件读取的字段；username 可保存云厂商 AccessKey ID
+var secretFileKeys = map[string]bool{
+	"username":      true,
+	"password":      true,
+	"password_hash": true,
+	"gnudip_md5":    true,
+	"token":         true,
+	"key":           true,
+	"admin_token":   true,
+}
+
+// secretListFileKeys 可以改用 <key>_file 从文件按行读取的列表字段 (忽略空行)
+var secretListFileKeys = map[string]bool{
+	"cloudflare_tokens": true,
+}
+
+// resolveSecrets 在解码前处理配置树：展开标量值中的 ${ENV_VAR}，并把 password_file 等
+// 引用替换为文件内容 (去掉末尾换行)。相对路径相对于配置文件所在目录
+func resolveSecrets(n *yaml.Node, baseDir string) error {
+	switch n.Kind {
+	case yaml.DocumentNode, yaml.SequenceNode:
+		for _, c := range n.Content {
+			if err := resolveSecrets(c, baseDir); err != nil {
+				return err
+			}
+		}
+	case yaml.MappingNode:
+		for i := 1; i < len(n.Content); i += 2 {
+			if err := resolveSecrets(n.Content[i], baseDir); err != nil {
+				return err
+			}
+		}
+		return resolveSecretFiles(n, baseDir)
+	case yaml.ScalarNode:
+		return expandEnv(n)
+	}
+	return nil
+}
+
+// expandEnv 展开标量中的 ${ENV_VAR}，未设置的变量视为错误；$${ENV_VAR} 保留为字面量 ${ENV_VAR}
+func expandEnv(n *yaml.Node) error {
+	if !strings.Contains(n.Value, "${") {
+		return nil
+	}
+	var missing string
+	n.Value = envPattern.ReplaceAllStringFunc(n.Value, func(ref string) string {
+		if strings.HasPrefix(ref, "$$") {
+			return ref[1:]
+		}
+		name := envPattern.FindStringSubmatch(ref)[1]
+		v, ok := os.LookupEnv(name)
+		if !ok && missing == "" {
+			missing = name
+		}
+		return v
+	})
+	if missing != "" {
+		return fmt.Errorf("config line %d: environment variable %s is not set", n.Line, missing)
+	}
+	// 未加引号的值按展开后的内容重新推断类型，使 tcp_port: ${PORT} 之类可以解码为数字
+	if n.Style&(yaml.SingleQuotedStyle|yaml.DoubleQuotedStyle|yaml.LiteralStyle|yaml.FoldedStyle) == 0 {
+		n.Tag = ""
+	}
+	return nil
+}
+
+// resolveSecretFiles 把映射中的 <key>_file 替换为 <key>: <文件内容>
+func resolveSecretFiles(n *yaml.Node, baseDir string) error {
+	keys := make(map[string]bool, len(n.Content)/2)
+	for i := 0; i < len(n.Content); i += 2 {
+		keys[n.Content[i].Value] = true
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		keyNode, valueNode := n.Content[i], n.Content[i+1]
+		base, ok := strings.CutSuffix(keyNode.Value, "_file")
+		if !ok || (!secretFileKeys[base] && !secretListFileKeys[base]) {
+			continue
+		}
+		if keys[base] {
+			return fmt.Errorf("config line %d: %s and %s are mutually exclusive", keyNode.Line, base, keyNode.Value)
+		}
+		if valueNode.Kind != yaml.ScalarNode || valueNode.Value == "" {
+			return fmt.Errorf("config line %d: %s must be a file path", keyNode.Line, keyNode.Value)
+		}
+		path := valueNode.Value
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(baseDir, path)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("config line %d: %s: %w", keyNode.Line, keyNode.Value, err)
+		}
+		keyNode.Value = base
+		if secretListFileKeys[base] {
+			list := yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Line: valueNode.Line, Column: valueNode.Column}
+			for _, line := range strings.Split(string(data), "\n") {
+				if line = strings.TrimSpace(line); line != "" {
+					list.Content = append(list.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: line, Line: valueNode.Line})
+				}
+			}
+			*valueNode = list
+			continue
+		}
+		*valueNode = yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: strings.TrimRight(string(data), "\r\n"), Line: valueNode.Line, Column: valueNode.Column}
+	}
+	return nil
+}
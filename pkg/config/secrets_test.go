@@ -0,0 +1,131 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfigSecrets(t *testing.T) {
+	t.Setenv("DDNS_TEST_AK", "LTAI-from-env")
+	t.Setenv("DDNS_TEST_PORT", "5353")
+	t.Setenv("DDNS_TEST_EMPTY", "")
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "sk"), []byte("secret-from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "duck"), []byte("duck-token"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "ak"), []byte("LTAI-from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "cf"), []byte("cf-one\n\ncf-two\r\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+		check   func(t *testing.T, c *Config)
+	}{
+		{
+			name: "env and files",
+			content: `server:
+  tcp_port: ${DDNS_TEST_PORT}
+  state_file: "state.json"
+users:
+  - username: "${DDNS_TEST_AK}"
+    password_file: sk
+    provider: "aliyun"
+    remark: "ak=${DDNS_TEST_AK}${DDNS_TEST_EMPTY}"
+    duckdns:
+      token_file: ` + filepath.Join(dir, "duck") + `
+      zone: "ddns.example.com"
+`,
+			check: func(t *testing.T, c *Config) {
+				u := c.Users[0]
+				if c.Server.TCPPort != 5353 || c.Server.StateFile != "state.json" {
+					t.Fatalf("server = %+v", c.Server)
+				}
+				if u.Username != "LTAI-from-env" || u.Password != "secret-from-file" || u.Remark != "ak=LTAI-from-env" {
+					t.Fatalf("user = %q / %q / %q", u.Username, u.Password, u.Remark)
+				}
+				if u.DuckDNS.Token != "duck-token" {
+					t.Fatalf("duckdns token = %q", u.DuckDNS.Token)
+				}
+			},
+		},
+		{
+			name: "access key and token list files",
+			content: `users:
+  - username_file: ak
+    password_file: sk
+    provider: "aliyun"
+    cloudflare_tokens_file: cf
+`,
+			check: func(t *testing.T, c *Config) {
+				u := c.Users[0]
+				if u.Username != "LTAI-from-file" || u.Password != "secret-from-file" {
+					t.Fatalf("user = %q / %q", u.Username, u.Password)
+				}
+				if strings.Join(u.CloudflareTokens, ",") != "cf-one,cf-two" {
+					t.Fatalf("cloudflare tokens = %q", u.CloudflareTokens)
+				}
+			},
+		},
+		{
+			name:    "escaped reference",
+			content: "users:\n  - username: u\n    password: \"pa$${DDNS_TEST_MISSING}ss$${DDNS_TEST_AK}\"\n    remark: \"${DDNS_TEST_AK}\"\n",
+			check: func(t *testing.T, c *Config) {
+				u := c.Users[0]
+				if u.Password != "pa${DDNS_TEST_MISSING}ss${DDNS_TEST_AK}" || u.Remark != "LTAI-from-env" {
+					t.Fatalf("user = %q / %q", u.Password, u.Remark)
+				}
+			},
+		},
+		{name: "missing env", content: "users:\n  - username: \"${DDNS_TEST_MISSING}\"\n", wantErr: "line 2: environment variable DDNS_TEST_MISSING is not set"},
+		{name: "missing file", content: "users:\n  - username: u\n    password_file: nope\n", wantErr: "line 3: password_file"},
+		{name: "value and file", content: "users:\n  - username: u\n    password: p\n    password_file: sk\n", wantErr: "password and password_file are mutually exclusive"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, "config.yaml")
+			if err := os.WriteFile(path, []byte(tt.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+			c, err := readConfig(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("readConfig() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readConfig() error = %v", err)
+			}
+			tt.check(t, c)
+		})
+	}
+}
+
+func TestLoadConfigKeepsPreviousOnError(t *testing.T) {
+	original := Current()
+	defer SetCurrent(original)
+
+	SetCurrent(&Config{Users: []UserConfig{{Username: "kept"}}})
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("users:\n  - username: \"${DDNS_TEST_MISSING}\"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadConfig(path); err == nil {
+		t.Fatal("LoadConfig() should fail on an unset variable")
+	}
+	if len(Current().Users) != 1 || Current().Users[0].Username != "kept" {
+		t.Fatalf("config replaced after a failed load: %+v", Current().Users)
+	}
+}
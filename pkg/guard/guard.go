@@ -0,0 +1,229 @@
+package guard
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 封禁对象的键前缀
+const (
+	KindUser = "user"
+	KindIP   = "ip"
+)
+
+// maxEntries 限制跟踪的键数量，防止大量伪造来源耗尽内存
+const maxEntries = 10000
+
+// Policy 描述封禁策略：连续失败 MaxFailures 次后封禁 Ban，此后每次失败封禁时长翻倍，
+// 最长 MaxBan；封禁结束后 Window 内没有新的失败则清零计数
+type Policy struct {
+	MaxFailures int
+	Ban         time.Duration
+	MaxBan      time.Duration
+	Window      time.Duration
+}
+
+// Ban 是一条当前生效的封禁
+type Ban struct {
+	Key      string    `json:"key"`
+	Failures int       `json:"failures"`
+	Until    time.Time `json:"until"`
+}
+
+type entry struct {
+	failures int
+	last     time.Time
+	until    time.Time
+}
+
+// Guard 按用户名与源 IP 统计认证失败并施加指数退避的临时封禁，
+// nil 或 MaxFailures 为 0 时不做任何限制
+type Guard struct {
+	mu      sync.Mutex
+	policy  Policy
+	entries map[string]*entry
+	now     func() time.Time
+}
+
+// New 按策略创建 Guard
+func New(policy Policy) *Guard {
+	return &Guard{policy: policy, entries: make(map[string]*entry), now: time.Now}
+}
+
+// Key 返回 kind (user/ip) 与取值组成的封禁键，例如 "ip:192.0.2.1"
+func Key(kind, value string) string {
+	return kind + ":" + value
+}
+
+func keys(user, ip string) []string {
+	var ks []string
+	if user != "" {
+		ks = append(ks, Key(KindUser, user))
+	}
+	if ip != "" {
+		ks = append(ks, Key(KindIP, ip))
+	}
+	return ks
+}
+
+// enabled 返回策略是否启用；调用方需持有 g.mu
+func (g *Guard) enabled() bool {
+	return g.policy.MaxFailures > 0
+}
+
+// SetPolicy 替换封禁策略 (如重新加载配置后)，已有的失败计数与封禁保留
+func (g *Guard) SetPolicy(policy Policy) {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.policy = policy
+}
+
+// expired 判断计数是否已过期：封禁 (若有) 结束后又经过了 Window
+func (g *Guard) expired(e *entry, now time.Time) bool {
+	end := e.last
+	if e.until.After(end) {
+		end = e.until
+	}
+	return now.Sub(end) > g.policy.Window
+}
+
+// Blocked 返回用户名或源 IP 是否处于封禁中，以及封禁结束时间
+func (g *Guard) Blocked(user, ip string) (time.Time, bool) {
+	if g == nil {
+		return time.Time{}, false
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.enabled() {
+		return time.Time{}, false
+	}
+	now := g.now()
+	var until time.Time
+	for _, k := range keys(user, ip) {
+		if e, ok := g.entries[k]; ok && e.until.After(now) && e.until.After(until) {
+			until = e.until
+		}
+	}
+	return until, !until.IsZero()
+}
+
+// Fail 记录一次认证失败，达到阈值后封禁对应的用户名与源 IP
+func (g *Guard) Fail(user, ip string) {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.enabled() {
+		return
+	}
+	now := g.now()
+	if len(g.entries) >= maxEntries {
+		g.prune(now)
+	}
+	for _, k := range keys(user, ip) {
+		e, ok := g.entries[k]
+		if !ok || g.expired(e, now) {
+			if !ok && len(g.entries) >= maxEntries {
+				continue
+			}
+			e = &entry{}
+			g.entries[k] = e
+		}
+		e.failures++
+		e.last = now
+		if e.failures >= g.policy.MaxFailures {
+			e.until = now.Add(g.banFor(e.failures))
+		}
+	}
+}
+
+// Succeed 记录一次认证成功，清零用户名与源 IP 的失败计数，使封禁只针对连续失败
+func (g *Guard) Succeed(user, ip string) {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, k := range keys(user, ip) {
+		delete(g.entries, k)
+	}
+}
+
+// banFor 计算第 failures 次失败对应的封禁时长
+func (g *Guard) banFor(failures int) time.Duration {
+	d := g.policy.Ban
+	for i := g.policy.MaxFailures; i < failures && d < g.policy.MaxBan; i++ {
+		d *= 2
+	}
+	if d > g.policy.MaxBan {
+		d = g.policy.MaxBan
+	}
+	return d
+}
+
+// prune 删除已过期的计数
+func (g *Guard) prune(now time.Time) {
+	for k, e := range g.entries {
+		if g.expired(e, now) {
+			delete(g.entries, k)
+		}
+	}
+}
+
+// Bans 返回当前生效的封禁，按键排序
+func (g *Guard) Bans() []Ban {
+	bans := []Ban{}
+	if g == nil {
+		return bans
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.enabled() {
+		return bans
+	}
+	now := g.now()
+	for k, e := range g.entries {
+		if e.until.After(now) {
+			bans = append(bans, Ban{Key: k, Failures: e.failures, Until: e.until})
+		}
+	}
+	sort.Slice(bans, func(i, j int) bool { return bans[i].Key < bans[j].Key })
+	return bans
+}
+
+// Clear 解除封禁并清零计数。key 为空时清除全部，否则只清除该键；返回清除的条目数
+func (g *Guard) Clear(key string) int {
+	if g == nil {
+		return 0
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if key == "" {
+		n := len(g.entries)
+		g.entries = make(map[string]*entry)
+		return n
+	}
+	if _, ok := g.entries[key]; !ok {
+		return 0
+	}
+	delete(g.entries, key)
+	return 1
+}
+
+var defaultGuard atomic.Pointer[Guard]
+
+// SetDefault 设置协议处理使用的全局 Guard
+func SetDefault(g *Guard) {
+	defaultGuard.Store(g)
+}
+
+// Default 返回全局 Guard，未设置时为 nil (不做限制)
+func Default() *Guard {
+	return defaultGuard.Load()
+}
@@ -0,0 +1,144 @@
+package guard
+
+import (
+	"testing"
+	"time"
+)
+
+func newTestGuard(now *time.Time) *Guard {
+	g := New(Policy{MaxFailures: 3, Ban: time.Minute, MaxBan: 4 * time.Minute, Window: 10 * time.Minute})
+	g.now = func() time.Time { return *now }
+	return g
+}
+
+func TestGuardBackoff(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	g := newTestGuard(&now)
+
+	tests := []struct {
+		failures int
+		wantBan  time.Duration
+	}{
+		{failures: 1, wantBan: 0},
+		{failures: 2, wantBan: 0},
+		{failures: 3, wantBan: time.Minute},
+		{failures: 4, wantBan: 2 * time.Minute},
+		{failures: 5, wantBan: 4 * time.Minute},
+		{failures: 6, wantBan: 4 * time.Minute},
+	}
+	for _, tt := range tests {
+		g.Fail("alice", "192.0.2.1")
+		until, banned := g.Blocked("alice", "")
+		if banned != (tt.wantBan > 0) {
+			t.Fatalf("after %d failures banned = %v, want %v", tt.failures, banned, tt.wantBan > 0)
+		}
+		if banned && until.Sub(now) != tt.wantBan {
+			t.Fatalf("after %d failures ban = %v, want %v", tt.failures, until.Sub(now), tt.wantBan)
+		}
+	}
+
+	if _, banned := g.Blocked("", "192.0.2.1"); !banned {
+		t.Fatal("source IP should be banned together with the username")
+	}
+	if _, banned := g.Blocked("bob", "192.0.2.2"); banned {
+		t.Fatal("unrelated user and IP should not be banned")
+	}
+
+	now = now.Add(5 * time.Minute)
+	if _, banned := g.Blocked("alice", "192.0.2.1"); banned {
+		t.Fatal("ban should end after its duration")
+	}
+	g.Fail("alice", "")
+	if until, _ := g.Blocked("alice", ""); until.Sub(now) != 4*time.Minute {
+		t.Fatalf("failure right after a ban should keep escalating, got %v", until.Sub(now))
+	}
+
+	now = now.Add(4*time.Minute + 11*time.Minute)
+	g.Fail("alice", "")
+	if _, banned := g.Blocked("alice", ""); banned {
+		t.Fatal("failures should reset once the window has passed after the ban")
+	}
+}
+
+func TestGuardSucceedResetsFailures(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	g := newTestGuard(&now)
+
+	// Two failures, a success, two more failures: never three in a row.
+	g.Fail("alice", "192.0.2.1")
+	g.Fail("alice", "192.0.2.1")
+	g.Succeed("alice", "192.0.2.1")
+	g.Fail("alice", "192.0.2.1")
+	g.Fail("alice", "192.0.2.1")
+	if _, banned := g.Blocked("alice", "192.0.2.1"); banned {
+		t.Fatal("failures separated by a success should not ban")
+	}
+	g.Fail("alice", "192.0.2.1")
+	if _, banned := g.Blocked("alice", "192.0.2.1"); !banned {
+		t.Fatal("three consecutive failures should ban")
+	}
+}
+
+func TestGuardBansAndClear(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	g := newTestGuard(&now)
+	for i := 0; i < 3; i++ {
+		g.Fail("alice", "192.0.2.1")
+	}
+	g.Fail("bob", "192.0.2.2")
+
+	bans := g.Bans()
+	if len(bans) != 2 || bans[0].Key != "ip:192.0.2.1" || bans[1].Key != "user:alice" {
+		t.Fatalf("Bans() = %+v, want ip:192.0.2.1 and user:alice", bans)
+	}
+	if n := g.Clear(Key(KindUser, "alice")); n != 1 {
+		t.Fatalf("Clear(user) = %d, want 1", n)
+	}
+	if _, banned := g.Blocked("alice", ""); banned {
+		t.Fatal("cleared user should not be banned")
+	}
+	if n := g.Clear(Key(KindUser, "nobody")); n != 0 {
+		t.Fatalf("Clear(unknown) = %d, want 0", n)
+	}
+	if n := g.Clear(""); n != 3 {
+		t.Fatalf("Clear(all) = %d, want 3", n)
+	}
+	if len(g.Bans()) != 0 {
+		t.Fatal("no bans should remain after clearing all")
+	}
+}
+
+func TestGuardDisabled(t *testing.T) {
+	for name, g := range map[string]*Guard{"nil": nil, "zero policy": New(Policy{})} {
+		t.Run(name, func(t *testing.T) {
+			for i := 0; i < 10; i++ {
+				g.Fail("alice", "192.0.2.1")
+			}
+			if _, banned := g.Blocked("alice", "192.0.2.1"); banned {
+				t.Fatal("disabled guard should never ban")
+			}
+			if bans := g.Bans(); len(bans) != 0 {
+				t.Fatalf("Bans() = %+v, want none", bans)
+			}
+		})
+	}
+}
+
+func TestGuardSetPolicy(t *testing.T) {
+	g := New(Policy{})
+	g.Fail("alice", "")
+	g.SetPolicy(Policy{MaxFailures: 1, Ban: time.Minute, MaxBan: time.Minute, Window: time.Hour})
+	g.Fail("alice", "")
+	if _, banned := g.Blocked("alice", ""); !banned {
+		t.Fatal("failure after enabling the policy should ban")
+	}
+
+	g.SetPolicy(Policy{MaxFailures: 5, Ban: time.Minute, MaxBan: time.Minute, Window: time.Hour})
+	if _, banned := g.Blocked("alice", ""); !banned {
+		t.Fatal("changing the policy should keep existing bans")
+	}
+	g.SetPolicy(Policy{})
+	if _, banned := g.Blocked("alice", ""); banned {
+		t.Fatal("disabling the policy should stop enforcing bans")
+	}
+}
@@ -0,0 +1,102 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+)
+
+// 日志输出格式
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// level 是全局 handler 的动态级别，-debug 可在运行时下调到 debug
+var level slog.LevelVar
+
+// baseLevel 保存配置的级别，关闭 debug 时恢复
+var baseLevel atomic.Int64
+
+// ParseLevel 解析 debug/info/warn/error (不区分大小写)，空串为 info
+func ParseLevel(s string) (slog.Level, error) {
+	var l slog.Level
+	if s == "" {
+		return slog.LevelInfo, nil
+	}
+	if err := l.UnmarshalText([]byte(s)); err != nil {
+		return 0, fmt.Errorf("invalid log level %q", s)
+	}
+	return l, nil
+}
+
+// ParseFormat 校验输出格式，空串为 text
+func ParseFormat(s string) (string, error) {
+	switch f := strings.ToLower(s); f {
+	case "":
+		return FormatText, nil
+	case FormatText, FormatJSON:
+		return f, nil
+	}
+	return "", fmt.Errorf("invalid log format %q (want %s or %s)", s, FormatText, FormatJSON)
+}
+
+// Setup 按级别与格式安装全局 slog 日志器，标准库 log 的输出也经由它以 info 级别写出
+func Setup(w io.Writer, levelName, format string) error {
+	l, err := ParseLevel(levelName)
+	if err != nil {
+		return err
+	}
+	f, err := ParseFormat(format)
+	if err != nil {
+		return err
+	}
+	baseLevel.Store(int64(l))
+	level.Set(l)
+
+	opts := &slog.HandlerOptions{Level: &level}
+	var h slog.Handler = slog.NewTextHandler(w, opts)
+	if f == FormatJSON {
+		h = slog.NewJSONHandler(w, opts)
+	}
+	// SetDefault 同时把标准库 log 接到该 handler 上
+	slog.SetDefault(slog.New(h))
+	return nil
+}
+
+// SetDebug 开启时把级别下调到 debug，关闭时恢复配置的级别
+func SetDebug(enabled bool) {
+	if enabled {
+		level.Set(slog.LevelDebug)
+		return
+	}
+	level.Set(slog.Level(baseLevel.Load()))
+}
+
+// NewRequestID 生成关联同一 HTTP 请求或 TCP 会话日志的随机 ID
+func NewRequestID() string {
+	buf := make([]byte, 8)
+	_, _ = rand.Read(buf) // crypto/rand.Read 不会返回错误
+	return hex.EncodeToString(buf)
+}
+
+// ctxKey 是请求日志器在 context 中的键
+type ctxKey struct{}
+
+// NewContext 返回携带 logger 的 ctx，处理链下游用 FromContext 取回带 request_id 的日志器
+func NewContext(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, ctxKey{}, logger)
+}
+
+// FromContext 返回 NewContext 存入的日志器，未设置时为 slog.Default()
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(ctxKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
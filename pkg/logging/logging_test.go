@@ -0,0 +1,101 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestSetup(t *testing.T) {
+	original := slog.Default()
+	defer slog.SetDefault(original)
+
+	tests := []struct {
+		name    string
+		level   string
+		format  string
+		wantErr bool
+		check   func(t *testing.T, out string)
+	}{
+		{
+			name:   "json at warn",
+			level:  "WARN",
+			format: "json",
+			check: func(t *testing.T, out string) {
+				lines := strings.Split(strings.TrimSpace(out), "\n")
+				if len(lines) != 1 {
+					t.Fatalf("expected only the warning, got %q", out)
+				}
+				var rec map[string]any
+				if err := json.Unmarshal([]byte(lines[0]), &rec); err != nil {
+					t.Fatalf("not JSON: %q", lines[0])
+				}
+				if rec["level"] != "WARN" || rec["msg"] != "warn line" || rec["request_id"] != "abc" {
+					t.Fatalf("record = %v", rec)
+				}
+			},
+		},
+		{
+			name: "text defaults to info",
+			check: func(t *testing.T, out string) {
+				if strings.Contains(out, "debug line") || !strings.Contains(out, `level=INFO msg="info line" request_id=abc`) {
+					t.Fatalf("output = %q", out)
+				}
+			},
+		},
+		{name: "invalid level", level: "verbose", wantErr: true},
+		{name: "invalid format", format: "xml", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := Setup(&buf, tt.level, tt.format)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Setup() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			logger := slog.With("request_id", "abc")
+			logger.Debug("debug line")
+			logger.Info("info line")
+			logger.Warn("warn line")
+			tt.check(t, buf.String())
+		})
+	}
+}
+
+func TestSetDebugRestoresLevel(t *testing.T) {
+	original := slog.Default()
+	defer slog.SetDefault(original)
+
+	var buf bytes.Buffer
+	if err := Setup(&buf, "error", "text"); err != nil {
+		t.Fatal(err)
+	}
+	SetDebug(true)
+	slog.Debug("visible")
+	SetDebug(false)
+	slog.Warn("hidden")
+
+	if out := buf.String(); !strings.Contains(out, "visible") || strings.Contains(out, "hidden") {
+		t.Fatalf("output = %q", out)
+	}
+	if a, b := NewRequestID(), NewRequestID(); len(a) != 16 || a == b {
+		t.Fatalf("request IDs %q and %q should be distinct 16-character hex strings", a, b)
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	if got := FromContext(context.Background()); got != slog.Default() {
+		t.Fatalf("FromContext(empty) = %p, want slog.Default()", got)
+	}
+	logger := slog.With("request_id", "abc")
+	if got := FromContext(NewContext(context.Background(), logger)); got != logger {
+		t.Fatalf("FromContext() = %p, want %p", got, logger)
+	}
+}
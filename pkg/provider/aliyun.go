@@ -8,6 +8,16 @@ import (
 	"github.com/alibabacloud-go/tea/tea"
 )
 
+// 阿里云记录状态及默认线路取值
+const (
+	aliyunStatusEnable  = "ENABLE"
+	aliyunStatusDisable = "DISABLE"
+	aliyunDefaultLine   = "default"
+	aliyunPageSize      = 100
+	// DescribeDomainRecords 允许的最大分页
+	aliyunRecordPageSize = 500
+)
+
 type AliyunProvider struct {
 	accessKey string
 	secretKey string
@@ -17,63 +27,258 @@ func NewAliyunProvider(ak, sk string) *AliyunProvider {
 	return &AliyunProvider{accessKey: ak, secretKey: sk}
 }
 
-func (p *AliyunProvider) UpdateRecord(fullDomain string, ip string) error {
-	// 使用统一的域名解析函数
-	domainName, rr, err := ParseDomain(fullDomain)
-	if err != nil {
-		return fmt.Errorf("invalid domain format: %s (%v)", fullDomain, err)
-	}
-
-	// 初始化客户端
+func (p *AliyunProvider) newClient() (*alidns.Client, error) {
 	config := &openapi.Config{
 		AccessKeyId:     tea.String(p.accessKey),
 		AccessKeySecret: tea.String(p.secretKey),
 		Endpoint:        tea.String("alidns.aliyuncs.com"),
 	}
-	client, err := alidns.NewClient(config)
+	return alidns.NewClient(config)
+}
+
+// ListZones 分页列出账号下的全部托管域名 (IDN 使用 punycode 形式)
+func (p *AliyunProvider) ListZones() ([]string, error) {
+	client, err := p.newClient()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// 1. 查询现有记录
+	var zones []string
+	for page := int64(1); ; page++ {
+		resp, err := client.DescribeDomains(&alidns.DescribeDomainsRequest{
+			PageNumber: tea.Int64(page),
+			PageSize:   tea.Int64(aliyunPageSize),
+		})
+		if err != nil {
+			return nil, err
+		}
+		if resp.Body == nil || resp.Body.Domains == nil || len(resp.Body.Domains.Domain) == 0 {
+			break
+		}
+		for _, d := range resp.Body.Domains.Domain {
+			if d.PunyCode != nil && *d.PunyCode != "" {
+				zones = append(zones, *d.PunyCode)
+			} else if d.DomainName != nil {
+				zones = append(zones, *d.DomainName)
+			}
+		}
+		if resp.Body.TotalCount == nil || int64(len(zones)) >= *resp.Body.TotalCount {
+			break
+		}
+	}
+	return zones, nil
+}
+
+// SplitDomain 通过托管域名列表确定 zone 与 RR
+func (p *AliyunProvider) SplitDomain(fullDomain string) (string, string, error) {
+	return resolveZone("aliyun:"+p.accessKey, p, fullDomain)
+}
+
+func aliyunLine(opts RecordOptions) string {
+	if opts.Line != "" {
+		return opts.Line
+	}
+	return aliyunDefaultLine
+}
+
+// findRecord 查询 rr 在指定线路上指定类型的记录，不存在时返回 nil
+func (p *AliyunProvider) findRecord(client *alidns.Client, domainName, rr, line, rtype string) (*alidns.DescribeDomainRecordsResponseBodyDomainRecordsRecord, error) {
+	// RRKeyWord 为模糊匹配 ("www" 也会命中 "www2"、"*" 会命中全部泛解析)，
+	// 放大分页后再按 RR 精确比对
 	searchReq := &alidns.DescribeDomainRecordsRequest{
-		DomainName: tea.String(domainName),
-		RRKeyWord:  tea.String(rr),
+		DomainName:  tea.String(domainName),
+		RRKeyWord:   tea.String(rr),
+		TypeKeyWord: tea.String(rtype),
+		Line:        tea.String(line),
+		PageSize:    tea.Int64(aliyunRecordPageSize),
 	}
 	resp, err := client.DescribeDomainRecords(searchReq)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if resp.Body == nil || resp.Body.DomainRecords == nil {
+		return nil, nil
 	}
-
-	// 2. 判断是否需要更新
-	var recordId *string
 	for _, r := range resp.Body.DomainRecords.Record {
-		// Check if RR is not nil before dereferencing
-		if r.RR != nil && *r.RR == rr {
-			// Check if Value is not nil before dereferencing
-			if r.Value != nil && *r.Value == ip {
-				return nil // IP 相同，无需更新
-			}
-			recordId = r.RecordId
-			break
+		if r.RR != nil && *r.RR == rr && (r.Line == nil || *r.Line == line) && (r.Type == nil || *r.Type == rtype) {
+			return r, nil
 		}
 	}
+	return nil, nil
+}
 
-	// 3. 执行更新或添加
-	if recordId != nil {
-		_, err = client.UpdateDomainRecord(&alidns.UpdateDomainRecordRequest{
-			RecordId: recordId,
-			RR:       tea.String(rr),
-			Type:     tea.String("A"),
-			Value:    tea.String(ip),
-		})
-	} else {
-		_, err = client.AddDomainRecord(&alidns.AddDomainRecordRequest{
+func (p *AliyunProvider) UpdateRecord(fullDomain string, value string, opts RecordOptions) (bool, error) {
+	// 通过托管域名列表拆分域名
+	domainName, rr, err := p.SplitDomain(fullDomain)
+	if err != nil {
+		return false, fmt.Errorf("invalid domain format: %s (%w)", fullDomain, err)
+	}
+	line := aliyunLine(opts)
+	rtype := recordType(opts)
+
+	// 初始化客户端
+	client, err := p.newClient()
+	if err != nil {
+		return false, err
+	}
+
+	// 1. 查询现有记录
+	record, err := p.findRecord(client, domainName, rr, line, rtype)
+	if err != nil {
+		return false, err
+	}
+
+	// 2. 执行添加
+	if record == nil {
+		addReq := &alidns.AddDomainRecordRequest{
 			DomainName: tea.String(domainName),
 			RR:         tea.String(rr),
-			Type:       tea.String("A"),
-			Value:      tea.String(ip),
-		})
+			Type:       tea.String(rtype),
+			Value:      tea.String(value),
+			Line:       tea.String(line),
+		}
+		if opts.TTL > 0 {
+			addReq.TTL = tea.Int64(int64(opts.TTL))
+		}
+		if rtype == RecordTypeMX && opts.Priority > 0 {
+			addReq.Priority = tea.Int64(int64(opts.Priority))
+		}
+		resp, err := client.AddDomainRecord(addReq)
+		if err != nil {
+			return false, err
+		}
+		if opts.Remark != "" && resp.Body != nil {
+			return true, p.setRemark(client, resp.Body.RecordId, opts.Remark)
+		}
+		return true, nil
 	}
+
+	// 3. 判断是否需要更新
+	valueChanged := record.Value == nil || *record.Value != value
+	ttlChanged := opts.TTL > 0 && (record.TTL == nil || *record.TTL != int64(opts.TTL))
+	priorityChanged := rtype == RecordTypeMX && opts.Priority > 0 && (record.Priority == nil || *record.Priority != int64(opts.Priority))
+	remarkChanged := opts.Remark != "" && (record.Remark == nil || *record.Remark != opts.Remark)
+	disabled := record.Status != nil && *record.Status == aliyunStatusDisable
+	if valueChanged || ttlChanged || priorityChanged {
+		updateReq := &alidns.UpdateDomainRecordRequest{
+			RecordId: record.RecordId,
+			RR:       tea.String(rr),
+			Type:     tea.String(rtype),
+			Value:    tea.String(value),
+			Line:     tea.String(line),
+		}
+		if opts.TTL > 0 {
+			updateReq.TTL = tea.Int64(int64(opts.TTL))
+		}
+		if rtype == RecordTypeMX && opts.Priority > 0 {
+			updateReq.Priority = tea.Int64(int64(opts.Priority))
+		}
+		if _, err := client.UpdateDomainRecord(updateReq); err != nil {
+			return false, err
+		}
+	}
+	if remarkChanged {
+		if err := p.setRemark(client, record.RecordId, opts.Remark); err != nil {
+			return true, err
+		}
+	}
+
+	// 4. 恢复此前因离线而暂停的记录
+	if disabled {
+		return true, p.setStatus(client, record.RecordId, true)
+	}
+	return valueChanged || ttlChanged || priorityChanged || remarkChanged, nil
+}
+
+func (p *AliyunProvider) DeleteRecord(fullDomain string, opts RecordOptions) error {
+	domainName, rr, err := p.SplitDomain(fullDomain)
+	if err != nil {
+		return fmt.Errorf("invalid domain format: %s (%w)", fullDomain, err)
+	}
+
+	client, err := p.newClient()
+	if err != nil {
+		return err
+	}
+
+	record, err := p.findRecord(client, domainName, rr, aliyunLine(opts), recordType(opts))
+	if err != nil {
+		return err
+	}
+	if record == nil {
+		return nil // 记录不存在，无需删除
+	}
+
+	_, err = client.DeleteDomainRecord(&alidns.DeleteDomainRecordRequest{
+		RecordId: record.RecordId,
+	})
+	return err
+}
+
+func (p *AliyunProvider) GetRecord(fullDomain string, opts RecordOptions) (Record, error) {
+	domainName, rr, err := p.SplitDomain(fullDomain)
+	if err != nil {
+		return Record{}, fmt.Errorf("invalid domain format: %s (%w)", fullDomain, err)
+	}
+
+	client, err := p.newClient()
+	if err != nil {
+		return Record{}, err
+	}
+
+	record, err := p.findRecord(client, domainName, rr, aliyunLine(opts), recordType(opts))
+	if err != nil {
+		return Record{}, err
+	}
+	if record == nil {
+		return Record{}, ErrRecordNotFound
+	}
+	return Record{
+		Value:    tea.StringValue(record.Value),
+		TTL:      int(tea.Int64Value(record.TTL)),
+		Priority: int(tea.Int64Value(record.Priority)),
+		Remark:   tea.StringValue(record.Remark),
+		Enabled:  tea.StringValue(record.Status) != aliyunStatusDisable,
+	}, nil
+}
+
+func (p *AliyunProvider) SetRecordStatus(fullDomain string, enabled bool, opts RecordOptions) error {
+	domainName, rr, err := p.SplitDomain(fullDomain)
+	if err != nil {
+		return fmt.Errorf("invalid domain format: %s (%w)", fullDomain, err)
+	}
+
+	client, err := p.newClient()
+	if err != nil {
+		return err
+	}
+
+	record, err := p.findRecord(client, domainName, rr, aliyunLine(opts), recordType(opts))
+	if err != nil {
+		return err
+	}
+	if record == nil {
+		return ErrRecordNotFound
+	}
+	return p.setStatus(client, record.RecordId, enabled)
+}
+
+func (p *AliyunProvider) setStatus(client *alidns.Client, recordId *string, enabled bool) error {
+	status := aliyunStatusDisable
+	if enabled {
+		status = aliyunStatusEnable
+	}
+	_, err := client.SetDomainRecordStatus(&alidns.SetDomainRecordStatusRequest{
+		RecordId: recordId,
+		Status:   tea.String(status),
+	})
+	return err
+}
+
+func (p *AliyunProvider) setRemark(client *alidns.Client, recordId *string, remark string) error {
+	_, err := client.UpdateDomainRecordRemark(&alidns.UpdateDomainRecordRemarkRequest{
+		RecordId: recordId,
+		Remark:   tea.String(remark),
+	})
 	return err
 }
@@ -5,13 +5,62 @@ import (
 	"strings"
 
 	"github.com/NewFuture/CloudDDNS/pkg/config"
+	"golang.org/x/net/publicsuffix"
 )
 
+// 支持的记录类型
+const (
+	RecordTypeA    = "A"
+	RecordTypeAAAA = "AAAA"
+	RecordTypeMX   = "MX"
+	RecordTypeTXT  = "TXT"
+)
+
+// RecordOptions 记录的可选属性，零值表示使用服务商默认值
+// Line 与 Type 同时用于在同一子域名存在多条记录时定位目标记录
+type RecordOptions struct {
+	TTL      int
+	Line     string
+	Remark   string
+	Type     string // 记录类型，留空为 A
+	Priority int    // MX 优先级，仅 Type 为 MX 时生效
+}
+
+// Record 服务商中一条记录的当前内容
+type Record struct {
+	Value    string
+	TTL      int
+	Priority int // 仅 MX 记录有效
+	Remark   string
+	Enabled  bool
+}
+
+// recordType 返回 opts 指定的记录类型，默认 A
+func recordType(opts RecordOptions) string {
+	if opts.Type != "" {
+		return opts.Type
+	}
+	return RecordTypeA
+}
+
 // Provider 统一接口
 type Provider interface {
-	UpdateRecord(domain string, ip string) error
+	// UpdateRecord 将域名 opts.Type 类型 (默认 A) 的记录指向 value，记录不存在时新建，已暂停的记录会被恢复
+	// changed 为 false 表示记录已是目标状态，未调用任何写接口
+	UpdateRecord(domain string, value string, opts RecordOptions) (changed bool, err error)
+	// DeleteRecord 删除域名 opts.Type 类型的记录，记录不存在时视为成功
+	DeleteRecord(domain string, opts RecordOptions) error
+	// GetRecord 查询域名 opts.Type 类型的记录，不存在时返回 ErrRecordNotFound
+	GetRecord(domain string, opts RecordOptions) (Record, error)
+	// SetRecordStatus 启用 (true) 或暂停 (false) 域名 opts.Type 类型的记录
+	SetRecordStatus(domain string, enabled bool, opts RecordOptions) error
+	// SplitDomain 按账号托管域名拆分为 zone 与记录名，zone 根为 "@"，泛解析为 "*" 或 "*.sub"
+	SplitDomain(domain string) (zone, subDomain string, err error)
 }
 
+// ErrRecordNotFound 表示需要操作的记录不存在
+var ErrRecordNotFound = errors.New("record not found")
+
 // GetProvider 工厂方法
 func GetProvider(u *config.UserConfig) (Provider, error) {
 	switch u.Provider {
@@ -25,51 +74,16 @@ func GetProvider(u *config.UserConfig) (Provider, error) {
 	}
 }
 
-// ParseDomain 拆分完整域名为基础域名和子域名
-// 处理常见的 TLD 情况，包括二级 TLD (如 .co.uk, .com.cn)
+// ParseDomain 依据内置的公共后缀列表 (Public Suffix List) 拆分完整域名为基础域名和子域名，
+// 如 .co.uk、.com.sg、.gov.au 等多级后缀；服务商无法列出托管域名时作为离线回退
 func ParseDomain(fullDomain string) (baseDomain, subDomain string, err error) {
-	parts := strings.Split(fullDomain, ".")
-	if len(parts) < 2 {
+	fullDomain = normalizeDomain(fullDomain)
+	if !strings.Contains(fullDomain, ".") {
 		return "", "", errors.New("invalid domain format")
 	}
-
-	// 检查常见的二级 TLD
-	twoLevelTLDs := map[string]bool{
-		"co.uk": true, "com.cn": true, "net.cn": true, "org.cn": true, "gov.cn": true,
-		"co.jp": true, "co.nz": true, "co.za": true, "com.au": true, "com.br": true,
-		"com.hk": true, "com.tw": true, "org.uk": true, "ac.uk": true, "gov.uk": true,
-	}
-
-	// 如果有 3 个或更多部分，检查最后两部分是否是二级 TLD
-	if len(parts) >= 3 {
-		lastTwo := strings.Join(parts[len(parts)-2:], ".")
-		if twoLevelTLDs[lastTwo] {
-			// 对于二级 TLD，基础域名是最后 3 部分
-			if len(parts) == 3 {
-				// example.co.uk
-				baseDomain = fullDomain
-				subDomain = "@"
-			} else {
-				// subdomain.example.co.uk
-				baseDomain = strings.Join(parts[len(parts)-3:], ".")
-				subDomain = strings.Join(parts[:len(parts)-3], ".")
-			}
-			return baseDomain, subDomain, nil
-		}
-	}
-
-	// 默认情况：最后两部分是基础域名 (example.com)
-	if len(parts) == 2 {
-		baseDomain = fullDomain
-		subDomain = "@"
-	} else {
-		baseDomain = strings.Join(parts[len(parts)-2:], ".")
-		subDomain = strings.Join(parts[:len(parts)-2], ".")
-	}
-
-	if subDomain == "" {
-		subDomain = "@"
+	baseDomain, err = publicsuffix.EffectiveTLDPlusOne(fullDomain)
+	if err != nil {
+		return "", "", errors.New("invalid domain format")
 	}
-
-	return baseDomain, subDomain, nil
+	return SplitAtZone(fullDomain, baseDomain)
 }
@@ -1,7 +1,11 @@
 package provider
 
 import (
+	"errors"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/NewFuture/CloudDDNS/pkg/config"
 )
@@ -199,6 +203,34 @@ func TestParseDomain(t *testing.T) {
 			wantSub:  "@",
 			wantErr:  false,
 		},
+		{
+			name:     "Singapore subdomain",
+			input:    "cam.example.com.sg",
+			wantBase: "example.com.sg",
+			wantSub:  "cam",
+			wantErr:  false,
+		},
+		{
+			name:     "Australian government domain",
+			input:    "www.agency.gov.au",
+			wantBase: "agency.gov.au",
+			wantSub:  "www",
+			wantErr:  false,
+		},
+		{
+			name:     "Private suffix",
+			input:    "blog.user.github.io",
+			wantBase: "user.github.io",
+			wantSub:  "blog",
+			wantErr:  false,
+		},
+		{
+			name:     "Trailing dot and upper case",
+			input:    "WWW.Example.COM.",
+			wantBase: "example.com",
+			wantSub:  "www",
+			wantErr:  false,
+		},
 		// Error cases
 		{
 			name:     "Single part",
@@ -232,3 +264,132 @@ func TestParseDomain(t *testing.T) {
 		})
 	}
 }
+
+// fakeZoneLister returns a fixed zone list and counts API calls.
+type fakeZoneLister struct {
+	zones []string
+	err   error
+	calls int
+}
+
+func (f *fakeZoneLister) ListZones() ([]string, error) {
+	f.calls++
+	return append([]string(nil), f.zones...), f.err
+}
+
+// blockingZoneLister holds every ListZones call until release is closed.
+type blockingZoneLister struct {
+	release chan struct{}
+	calls   atomic.Int32
+}
+
+func (b *blockingZoneLister) ListZones() ([]string, error) {
+	b.calls.Add(1)
+	<-b.release
+	return []string{"example.com"}, nil
+}
+
+func TestCachedZonesConcurrentMiss(t *testing.T) {
+	zoneCache.Lock()
+	delete(zoneCache.entries, "test:concurrent")
+	zoneCache.Unlock()
+	lister := &blockingZoneLister{release: make(chan struct{})}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			zone, _, err := resolveZone("test:concurrent", lister, "www.example.com")
+			if err == nil && zone != "example.com" {
+				err = errors.New("unexpected zone " + zone)
+			}
+			errs <- err
+		}()
+	}
+	// Let the lookups pile up on the cold cache before the first call returns.
+	time.Sleep(50 * time.Millisecond)
+	close(lister.release)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("resolveZone() error = %v", err)
+		}
+	}
+	if n := lister.calls.Load(); n != 1 {
+		t.Errorf("expected concurrent misses to share one ListZones call, got %d", n)
+	}
+}
+
+func TestResolveZone(t *testing.T) {
+	lister := &fakeZoneLister{zones: []string{"example.com", "lab.example.com", "Example.com.sg."}}
+
+	tests := []struct {
+		name     string
+		input    string
+		wantZone string
+		wantSub  string
+		wantErr  error
+	}{
+		{name: "apex", input: "example.com", wantZone: "example.com", wantSub: "@"},
+		{name: "subdomain", input: "www.example.com", wantZone: "example.com", wantSub: "www"},
+		{name: "delegated subzone wins", input: "home.lab.example.com", wantZone: "lab.example.com", wantSub: "home"},
+		{name: "subzone apex", input: "lab.example.com", wantZone: "lab.example.com", wantSub: "@"},
+		{name: "normalized zone", input: "cam.example.com.sg", wantZone: "example.com.sg", wantSub: "cam"},
+		{name: "suffix must align on label", input: "www.notexample.com", wantErr: ErrZoneNotFound},
+		{name: "foreign zone", input: "www.example.org", wantErr: ErrZoneNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			zone, sub, err := resolveZone("test:resolve", lister, tt.input)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("resolveZone() error = %v, want %v", err, tt.wantErr)
+			}
+			if zone != tt.wantZone || sub != tt.wantSub {
+				t.Errorf("resolveZone() = (%q, %q), want (%q, %q)", zone, sub, tt.wantZone, tt.wantSub)
+			}
+		})
+	}
+
+	if lister.calls != 1 {
+		t.Errorf("expected zone list to be cached after first call, got %d calls", lister.calls)
+	}
+}
+
+func TestResolveZoneFallsBackToPublicSuffixList(t *testing.T) {
+	lister := &fakeZoneLister{err: errors.New("api unavailable")}
+
+	zone, sub, err := resolveZone("test:fallback", lister, "nas.home.example.co.uk")
+	if err != nil {
+		t.Fatalf("resolveZone() error = %v", err)
+	}
+	if zone != "example.co.uk" || sub != "nas.home" {
+		t.Errorf("resolveZone() = (%q, %q), want (%q, %q)", zone, sub, "example.co.uk", "nas.home")
+	}
+
+	// The failure is cached briefly, so the next lookup falls back without
+	// calling the API again.
+	if _, _, err := resolveZone("test:fallback", lister, "nas.home.example.co.uk"); err != nil {
+		t.Fatalf("resolveZone() error = %v", err)
+	}
+	if lister.calls != 1 {
+		t.Errorf("expected the failed lookup to be cached, got %d calls", lister.calls)
+	}
+
+	// Once the failure expires the API is retried.
+	zoneCache.Lock()
+	entry := zoneCache.entries["test:fallback"]
+	entry.expires = time.Now().Add(-time.Second)
+	zoneCache.entries["test:fallback"] = entry
+	zoneCache.Unlock()
+	if _, _, err := resolveZone("test:fallback", lister, "nas.home.example.co.uk"); err != nil {
+		t.Fatalf("resolveZone() error = %v", err)
+	}
+	if lister.calls != 2 {
+		t.Errorf("expected an expired failure to be retried, got %d calls", lister.calls)
+	}
+}
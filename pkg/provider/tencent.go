@@ -1,13 +1,23 @@
 package provider
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common"
+	sdkerrors "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common/errors"
 	"github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common/profile"
 	dnspod "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/dnspod/v20210323"
 )
 
+// DNSPod 记录状态及默认线路取值
+const (
+	tencentStatusEnable  = "ENABLE"
+	tencentStatusDisable = "DISABLE"
+	tencentDefaultLine   = "默认"
+	tencentPageSize      = 100
+)
+
 type TencentProvider struct {
 	secretId  string
 	secretKey string
@@ -17,59 +27,254 @@ func NewTencentProvider(id, key string) *TencentProvider {
 	return &TencentProvider{secretId: id, secretKey: key}
 }
 
-func (p *TencentProvider) UpdateRecord(fullDomain string, ip string) error {
-	// 使用统一的域名解析函数
-	domain, subDomain, err := ParseDomain(fullDomain)
-	if err != nil {
-		return fmt.Errorf("invalid domain format: %s (%v)", fullDomain, err)
-	}
-
-	// 初始化客户端
+func (p *TencentProvider) newClient() (*dnspod.Client, error) {
 	credential := common.NewCredential(p.secretId, p.secretKey)
 	cpf := profile.NewClientProfile()
-	client, err := dnspod.NewClient(credential, "", cpf)
+	return dnspod.NewClient(credential, "", cpf)
+}
+
+// ListZones 分页列出账号下的全部托管域名 (IDN 使用 punycode 形式)
+func (p *TencentProvider) ListZones() ([]string, error) {
+	client, err := p.newClient()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// 1. 查询现有记录
+	var zones []string
+	for offset := int64(0); ; offset += tencentPageSize {
+		listReq := dnspod.NewDescribeDomainListRequest()
+		listReq.Offset = common.Int64Ptr(offset)
+		listReq.Limit = common.Int64Ptr(tencentPageSize)
+		listResp, err := client.DescribeDomainList(listReq)
+		if err != nil {
+			return nil, err
+		}
+		if listResp.Response == nil || len(listResp.Response.DomainList) == 0 {
+			break
+		}
+		for _, d := range listResp.Response.DomainList {
+			if d.Punycode != nil && *d.Punycode != "" {
+				zones = append(zones, *d.Punycode)
+			} else if d.Name != nil {
+				zones = append(zones, *d.Name)
+			}
+		}
+		info := listResp.Response.DomainCountInfo
+		if info == nil || info.AllTotal == nil || uint64(len(zones)) >= *info.AllTotal {
+			break
+		}
+	}
+	return zones, nil
+}
+
+// SplitDomain 通过托管域名列表确定 zone 与子域名
+func (p *TencentProvider) SplitDomain(fullDomain string) (string, string, error) {
+	return resolveZone("tencent:"+p.secretId, p, fullDomain)
+}
+
+func tencentLine(opts RecordOptions) string {
+	if opts.Line != "" {
+		return opts.Line
+	}
+	return tencentDefaultLine
+}
+
+// findRecord 查询子域名在指定线路上指定类型的记录，不存在时返回 nil
+func (p *TencentProvider) findRecord(client *dnspod.Client, domain, subDomain, line, rtype string) (*dnspod.RecordListItem, error) {
 	describeReq := dnspod.NewDescribeRecordListRequest()
 	describeReq.Domain = common.StringPtr(domain)
 	describeReq.Subdomain = common.StringPtr(subDomain)
-	describeReq.RecordType = common.StringPtr("A")
+	describeReq.RecordType = common.StringPtr(rtype)
+	describeReq.RecordLine = common.StringPtr(line)
 
 	describeResp, err := client.DescribeRecordList(describeReq)
 	if err != nil {
-		return err
+		// DNSPod 在没有匹配记录时返回错误码而不是空列表
+		var sdkErr *sdkerrors.TencentCloudSDKError
+		if errors.As(err, &sdkErr) && sdkErr.GetCode() == "ResourceNotFound.NoDataOfRecord" {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if describeResp.Response == nil {
+		return nil, nil
+	}
+	for _, record := range describeResp.Response.RecordList {
+		if record.Name != nil && *record.Name == subDomain && (record.Line == nil || *record.Line == line) {
+			return record, nil
+		}
+	}
+	return nil, nil
+}
+
+func (p *TencentProvider) UpdateRecord(fullDomain string, value string, opts RecordOptions) (bool, error) {
+	// 通过托管域名列表拆分域名
+	domain, subDomain, err := p.SplitDomain(fullDomain)
+	if err != nil {
+		return false, fmt.Errorf("invalid domain format: %s (%w)", fullDomain, err)
+	}
+	line := tencentLine(opts)
+	rtype := recordType(opts)
+
+	// 初始化客户端
+	client, err := p.newClient()
+	if err != nil {
+		return false, err
 	}
 
-	// 2. 判断是否需要更新
-	if describeResp.Response != nil && describeResp.Response.RecordList != nil && len(describeResp.Response.RecordList) > 0 {
-		record := describeResp.Response.RecordList[0]
-		// Check if Value is not nil before dereferencing
-		if record.Value != nil && *record.Value == ip {
-			return nil // IP 相同，无需更新
+	// 1. 查询现有记录
+	record, err := p.findRecord(client, domain, subDomain, line, rtype)
+	if err != nil {
+		return false, err
+	}
+
+	// 2. 添加新记录
+	if record == nil {
+		createReq := dnspod.NewCreateRecordRequest()
+		createReq.Domain = common.StringPtr(domain)
+		createReq.SubDomain = common.StringPtr(subDomain)
+		createReq.RecordType = common.StringPtr(rtype)
+		createReq.RecordLine = common.StringPtr(line)
+		createReq.Value = common.StringPtr(value)
+		if opts.TTL > 0 {
+			createReq.TTL = common.Uint64Ptr(uint64(opts.TTL))
+		}
+		if rtype == RecordTypeMX && opts.Priority > 0 {
+			createReq.MX = common.Uint64Ptr(uint64(opts.Priority))
+		}
+		if opts.Remark != "" {
+			createReq.Remark = common.StringPtr(opts.Remark)
+		}
+		if _, err = client.CreateRecord(createReq); err != nil {
+			return false, err
 		}
+		return true, nil
+	}
 
-		// 更新记录
+	// 3. 判断是否需要更新
+	valueChanged := record.Value == nil || *record.Value != value
+	ttlChanged := opts.TTL > 0 && (record.TTL == nil || *record.TTL != uint64(opts.TTL))
+	priorityChanged := rtype == RecordTypeMX && opts.Priority > 0 && (record.MX == nil || *record.MX != uint64(opts.Priority))
+	remarkChanged := opts.Remark != "" && (record.Remark == nil || *record.Remark != opts.Remark)
+	if valueChanged || ttlChanged || priorityChanged || remarkChanged {
 		modifyReq := dnspod.NewModifyRecordRequest()
 		modifyReq.Domain = common.StringPtr(domain)
 		modifyReq.RecordId = record.RecordId
 		modifyReq.SubDomain = common.StringPtr(subDomain)
-		modifyReq.RecordType = common.StringPtr("A")
-		modifyReq.RecordLine = common.StringPtr("默认")
-		modifyReq.Value = common.StringPtr(ip)
-		_, err = client.ModifyRecord(modifyReq)
+		modifyReq.RecordType = common.StringPtr(rtype)
+		modifyReq.RecordLine = common.StringPtr(line)
+		modifyReq.Value = common.StringPtr(value)
+		if opts.TTL > 0 {
+			modifyReq.TTL = common.Uint64Ptr(uint64(opts.TTL))
+		}
+		if rtype == RecordTypeMX && opts.Priority > 0 {
+			modifyReq.MX = common.Uint64Ptr(uint64(opts.Priority))
+		}
+		if opts.Remark != "" {
+			modifyReq.Remark = common.StringPtr(opts.Remark)
+		}
+		if _, err = client.ModifyRecord(modifyReq); err != nil {
+			return false, err
+		}
+	}
+
+	// 4. 恢复此前因离线而暂停的记录
+	if record.Status != nil && *record.Status == tencentStatusDisable {
+		return true, p.setStatus(client, domain, record.RecordId, true)
+	}
+	return valueChanged || ttlChanged || priorityChanged || remarkChanged, nil
+}
+
+func (p *TencentProvider) DeleteRecord(fullDomain string, opts RecordOptions) error {
+	domain, subDomain, err := p.SplitDomain(fullDomain)
+	if err != nil {
+		return fmt.Errorf("invalid domain format: %s (%w)", fullDomain, err)
+	}
+
+	client, err := p.newClient()
+	if err != nil {
+		return err
+	}
+
+	record, err := p.findRecord(client, domain, subDomain, tencentLine(opts), recordType(opts))
+	if err != nil {
+		return err
+	}
+	if record == nil {
+		return nil // 记录不存在，无需删除
+	}
+
+	deleteReq := dnspod.NewDeleteRecordRequest()
+	deleteReq.Domain = common.StringPtr(domain)
+	deleteReq.RecordId = record.RecordId
+	_, err = client.DeleteRecord(deleteReq)
+	return err
+}
+
+func (p *TencentProvider) GetRecord(fullDomain string, opts RecordOptions) (Record, error) {
+	domain, subDomain, err := p.SplitDomain(fullDomain)
+	if err != nil {
+		return Record{}, fmt.Errorf("invalid domain format: %s (%w)", fullDomain, err)
+	}
+
+	client, err := p.newClient()
+	if err != nil {
+		return Record{}, err
+	}
+
+	record, err := p.findRecord(client, domain, subDomain, tencentLine(opts), recordType(opts))
+	if err != nil {
+		return Record{}, err
+	}
+	if record == nil {
+		return Record{}, ErrRecordNotFound
+	}
+	rec := Record{Enabled: record.Status == nil || *record.Status != tencentStatusDisable}
+	if record.Value != nil {
+		rec.Value = *record.Value
+	}
+	if record.TTL != nil {
+		rec.TTL = int(*record.TTL)
+	}
+	if record.MX != nil {
+		rec.Priority = int(*record.MX)
+	}
+	if record.Remark != nil {
+		rec.Remark = *record.Remark
+	}
+	return rec, nil
+}
+
+func (p *TencentProvider) SetRecordStatus(fullDomain string, enabled bool, opts RecordOptions) error {
+	domain, subDomain, err := p.SplitDomain(fullDomain)
+	if err != nil {
+		return fmt.Errorf("invalid domain format: %s (%w)", fullDomain, err)
+	}
+
+	client, err := p.newClient()
+	if err != nil {
 		return err
 	}
 
-	// 3. 添加新记录
-	createReq := dnspod.NewCreateRecordRequest()
-	createReq.Domain = common.StringPtr(domain)
-	createReq.SubDomain = common.StringPtr(subDomain)
-	createReq.RecordType = common.StringPtr("A")
-	createReq.RecordLine = common.StringPtr("默认")
-	createReq.Value = common.StringPtr(ip)
-	_, err = client.CreateRecord(createReq)
+	record, err := p.findRecord(client, domain, subDomain, tencentLine(opts), recordType(opts))
+	if err != nil {
+		return err
+	}
+	if record == nil {
+		return ErrRecordNotFound
+	}
+	return p.setStatus(client, domain, record.RecordId, enabled)
+}
+
+func (p *TencentProvider) setStatus(client *dnspod.Client, domain string, recordId *uint64, enabled bool) error {
+	status := tencentStatusDisable
+	if enabled {
+		status = tencentStatusEnable
+	}
+	statusReq := dnspod.NewModifyRecordStatusRequest()
+	statusReq.Domain = common.StringPtr(domain)
+	statusReq.RecordId = recordId
+	statusReq.Status = common.StringPtr(status)
+	_, err := client.ModifyRecordStatus(statusReq)
 	return err
 }
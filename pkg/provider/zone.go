@@ -0,0 +1,117 @@
+package provider
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// ZoneLister 由能够列出账号下托管域名 (Zone) 的服务商实现
+type ZoneLister interface {
+	ListZones() ([]string, error)
+}
+
+// ErrZoneNotFound 表示账号下没有托管域名能匹配请求的主机名
+var ErrZoneNotFound = errors.New("no hosted zone matches domain")
+
+// zoneCacheTTL 托管域名列表的缓存时间，避免每次更新都调用列表接口；
+// zoneErrorTTL 列表接口失败 (如凭据没有列表权限) 的缓存时间，期间直接回退而不重复调用
+const (
+	zoneCacheTTL = 10 * time.Minute
+	zoneErrorTTL = time.Minute
+)
+
+type zoneCacheEntry struct {
+	zones   []string
+	err     error
+	expires time.Time
+}
+
+var zoneCache = struct {
+	sync.Mutex
+	entries map[string]zoneCacheEntry
+}{entries: make(map[string]zoneCacheEntry)}
+
+// zoneGroup 合并同一账号并发的列表请求，缓存过期时只调用一次 lister
+var zoneGroup singleflight.Group
+
+// cachedZones 返回账号 key 的托管域名列表 (或缓存的失败)，缓存过期后重新调用 lister
+func cachedZones(key string, lister ZoneLister) ([]string, error) {
+	zoneCache.Lock()
+	entry, ok := zoneCache.entries[key]
+	zoneCache.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.zones, entry.err
+	}
+
+	v, err, _ := zoneGroup.Do(key, func() (interface{}, error) {
+		zones, err := lister.ListZones()
+		if err != nil {
+			zoneCache.Lock()
+			zoneCache.entries[key] = zoneCacheEntry{err: err, expires: time.Now().Add(zoneErrorTTL)}
+			zoneCache.Unlock()
+			return nil, err
+		}
+		for i := range zones {
+			zones[i] = normalizeDomain(zones[i])
+		}
+
+		zoneCache.Lock()
+		zoneCache.entries[key] = zoneCacheEntry{zones: zones, expires: time.Now().Add(zoneCacheTTL)}
+		zoneCache.Unlock()
+		return zones, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.([]string), nil
+}
+
+// resolveZone 按最长后缀在账号托管域名中匹配 fullDomain，返回 zone 与子域名；
+// 列表接口不可用时回退到内置公共后缀列表 (ParseDomain)
+func resolveZone(key string, lister ZoneLister, fullDomain string) (zone, subDomain string, err error) {
+	zones, err := cachedZones(key, lister)
+	if err != nil {
+		return ParseDomain(fullDomain)
+	}
+	zone = matchZone(zones, fullDomain)
+	if zone == "" {
+		return "", "", ErrZoneNotFound
+	}
+	return SplitAtZone(fullDomain, zone)
+}
+
+// matchZone 返回 zones 中与 fullDomain 匹配的最长后缀，没有匹配时返回空字符串
+func matchZone(zones []string, fullDomain string) string {
+	fullDomain = normalizeDomain(fullDomain)
+	best := ""
+	for _, zone := range zones {
+		if zone == "" || len(zone) <= len(best) {
+			continue
+		}
+		if fullDomain == zone || strings.HasSuffix(fullDomain, "."+zone) {
+			best = zone
+		}
+	}
+	return best
+}
+
+// SplitAtZone 按已知 zone 拆分完整域名，zone 本身对应子域名 "@"
+func SplitAtZone(fullDomain, zone string) (baseDomain, subDomain string, err error) {
+	fullDomain = normalizeDomain(fullDomain)
+	zone = normalizeDomain(zone)
+	if fullDomain == zone {
+		return zone, "@", nil
+	}
+	if zone == "" || !strings.HasSuffix(fullDomain, "."+zone) {
+		return "", "", errors.New("domain is not inside zone " + zone)
+	}
+	return zone, strings.TrimSuffix(fullDomain, "."+zone), nil
+}
+
+func normalizeDomain(domain string) string {
+	return strings.ToLower(strings.TrimSuffix(domain, "."))
+}
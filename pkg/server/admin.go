@@ -0,0 +1,81 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/NewFuture/CloudDDNS/pkg/config"
+	"github.com/NewFuture/CloudDDNS/pkg/guard"
+	"github.com/NewFuture/CloudDDNS/pkg/logging"
+)
+
+// adminAuthorized checks the Bearer token against server.admin_token. The
+// admin endpoints answer 404 while no token is configured. Wrong tokens count
+// as authentication failures of the source IP, and banned sources get 429.
+func adminAuthorized(w http.ResponseWriter, r *http.Request) bool {
+	token := config.Current().Server.AdminToken
+	if token == "" {
+		http.NotFound(w, r)
+		return false
+	}
+	logger := logging.FromContext(r.Context())
+	g := guard.Default()
+	ip := remoteIP(r.RemoteAddr)
+	if until, banned := g.Blocked("", ip); banned {
+		logger.Warn("Rejected admin request from banned client", "ip", ip, "until", until.Format(time.RFC3339))
+		http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+		return false
+	}
+	provided, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+		if provided != "" {
+			logger.Warn("Admin authentication failed", "ip", ip)
+			g.Fail("", ip)
+		}
+		w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return false
+	}
+	g.Succeed("", ip)
+	return true
+}
+
+// handleAdminBans lists the current brute-force bans (GET) or lifts them
+// (DELETE). DELETE takes an optional key, user or ip parameter to clear a
+// single entry; without one every ban and failure count is cleared.
+func handleAdminBans(w http.ResponseWriter, r *http.Request) {
+	if !adminAuthorized(w, r) {
+		return
+	}
+	g := guard.Default()
+	switch r.Method {
+	case http.MethodGet:
+		writeAdminJSON(w, map[string]interface{}{"bans": g.Bans()})
+	case http.MethodDelete:
+		q := r.URL.Query()
+		key := q.Get("key")
+		switch {
+		case q.Get("user") != "":
+			key = guard.Key(guard.KindUser, q.Get("user"))
+		case q.Get("ip") != "":
+			key = guard.Key(guard.KindIP, q.Get("ip"))
+		}
+		cleared := g.Clear(key)
+		logging.FromContext(r.Context()).Info("Admin cleared ban entries", "cleared", cleared, "key", key, "remote", r.RemoteAddr)
+		writeAdminJSON(w, map[string]interface{}{"cleared": cleared})
+	default:
+		w.Header().Set("Allow", "GET, DELETE")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+func writeAdminJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("HTTP write error", "error", err)
+	}
+}
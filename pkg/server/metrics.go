@@ -0,0 +1,51 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+)
+
+// serverMetrics holds the process-wide counters exposed on /metrics.
+type serverMetrics struct {
+	tcpAccepted       atomic.Int64
+	tcpActive         atomic.Int64
+	tcpRejectedRate   atomic.Int64
+	tcpRejectedGlobal atomic.Int64
+	tcpRejectedPerIP  atomic.Int64
+}
+
+var metrics serverMetrics
+
+// countRejection records a TCP connection refused for reason.
+func (m *serverMetrics) countRejection(reason string) {
+	switch reason {
+	case rejectRate:
+		m.tcpRejectedRate.Add(1)
+	case rejectGlobal:
+		m.tcpRejectedGlobal.Add(1)
+	case rejectPerIP:
+		m.tcpRejectedPerIP.Add(1)
+	}
+}
+
+// handleMetrics writes the counters in the Prometheus text exposition format.
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	fmt.Fprintf(w, "# HELP cloudddns_tcp_connections_accepted_total GnuDIP TCP connections admitted by the listener.\n")
+	fmt.Fprintf(w, "# TYPE cloudddns_tcp_connections_accepted_total counter\n")
+	fmt.Fprintf(w, "cloudddns_tcp_connections_accepted_total %d\n", metrics.tcpAccepted.Load())
+	fmt.Fprintf(w, "# HELP cloudddns_tcp_connections_active GnuDIP TCP connections currently being served.\n")
+	fmt.Fprintf(w, "# TYPE cloudddns_tcp_connections_active gauge\n")
+	fmt.Fprintf(w, "cloudddns_tcp_connections_active %d\n", metrics.tcpActive.Load())
+	fmt.Fprintf(w, "# HELP cloudddns_tcp_connections_rejected_total GnuDIP TCP connections refused by a limit.\n")
+	fmt.Fprintf(w, "# TYPE cloudddns_tcp_connections_rejected_total counter\n")
+	fmt.Fprintf(w, "cloudddns_tcp_connections_rejected_total{reason=%q} %d\n", rejectRate, metrics.tcpRejectedRate.Load())
+	fmt.Fprintf(w, "cloudddns_tcp_connections_rejected_total{reason=%q} %d\n", rejectGlobal, metrics.tcpRejectedGlobal.Load())
+	fmt.Fprintf(w, "cloudddns_tcp_connections_rejected_total{reason=%q} %d\n", rejectPerIP, metrics.tcpRejectedPerIP.Load())
+}
@@ -2,10 +2,9 @@ package mode
 
 import (
 	"crypto/md5"
-	"crypto/sha256"
-	"encoding/base64"
 	"encoding/hex"
 	"fmt"
+	"log/slog"
 	"net"
 	"net/http"
 	"strconv"
@@ -22,6 +21,26 @@ const (
 	OutcomeAuthFailure
 	OutcomeInvalidDomain
 	OutcomeSystemError
+	// OutcomeNoChange reports that the record already held the requested value.
+	OutcomeNoChange
+	// OutcomeNoHost reports that the hostname is not in any zone of the account
+	// or that the user may not update it.
+	OutcomeNoHost
+	// OutcomeTooManyHosts reports that a request listed more hostnames than allowed.
+	OutcomeTooManyHosts
+	// OutcomeAbuse reports that the user is blocked from updating.
+	OutcomeAbuse
+	// OutcomeBadAgent reports a request without the required User-Agent.
+	OutcomeBadAgent
+	// OutcomeDNSError reports that the DNS provider API rejected or failed the update.
+	OutcomeDNSError
+	// OutcomeNotDonator reports a request for a feature the user is not granted (wildcards).
+	OutcomeNotDonator
+	// OutcomeBadSystem reports an unsupported 3322/qDNS system parameter.
+	OutcomeBadSystem
+	// OutcomeChallenge reports a GnuDIP HTTP handshake that is answered with a
+	// new challenge instead of being processed as an update.
+	OutcomeChallenge
 )
 
 var debugMode atomic.Bool
@@ -37,9 +56,13 @@ func isDebugMode() bool {
 
 // Request holds normalized DDNS parameters.
 type Request struct {
-	Username   string
-	Password   string
-	Domain     string
+	Username string
+	Password string
+	// Domain is the hostname in IDNA ASCII (punycode) form.
+	Domain string
+	// Domains lists every requested hostname in request order for modes that
+	// accept several at once; Domain is always its first entry.
+	Domains    []string
 	IP         string
 	Reqc       int
 	RemoteAddr string
@@ -48,6 +71,35 @@ type Request struct {
 	Salt string
 	// Sign is the MD5 signature for challenge-response authentication.
 	Sign string
+	// Wildcard, MX and BackMX carry the 3322/qDNS wildcard=ON, mx and backmx=YES
+	// options; ClearWildcard carries wildcard=OFF.
+	Wildcard      bool
+	ClearWildcard bool
+	MX            string
+	BackMX        bool
+	// Names are the raw DuckDNS domains before expansion into the user's zone.
+	Names []string
+	// IPv6, TXT, UpdateTXT, Clear and Verbose carry the DuckDNS ipv6, txt,
+	// clear and verbose options.
+	IPv6      string
+	TXT       string
+	UpdateTXT bool
+	Clear     bool
+	Verbose   bool
+	// Results holds the per-host outcome of a multi-hostname update, aligned with Domains.
+	Results []HostResult
+}
+
+// HostResult is the outcome of updating a single hostname.
+type HostResult struct {
+	Domain  string
+	Outcome Outcome
+}
+
+// DisplayDomain returns the hostname for logs and responses, including the
+// Unicode form when the request used an internationalized domain name.
+func (r *Request) DisplayDomain() string {
+	return displayHostname(r.Domain)
 }
 
 // Mode defines a protocol handler that can prepare, process, and respond to a DDNS HTTP request.
@@ -60,13 +112,22 @@ type Mode interface {
 // DynMode holds shared DynDNS-like behaviour (DynDNS, DtDNS, EasyDNS, Oray).
 type DynMode struct {
 	numericResponse bool
-	debugLogf       func(format string, args ...interface{})
+	logger          *slog.Logger
+	// hostParams and ipParams are the query aliases accepted for the hostname
+	// and IP; protocol-specific modes narrow them to their own vocabulary.
+	hostParams []string
+	ipParams   []string
 }
 
-func NewDynMode(numeric bool, debug func(format string, args ...interface{})) *DynMode {
+// NewDynMode returns a DynDNS2 mode that logs through logger, normally the
+// request logger carrying the request_id; nil uses slog.Default().
+func NewDynMode(numeric bool, logger *slog.Logger) *DynMode {
 	return &DynMode{
 		numericResponse: numeric,
-		debugLogf:       debug,
+		logger:          loggerOrDefault(logger),
+		// Domain aliases: domn/domain/hostname/host (standard), id (DtDNS), host_id (EasyDNS).
+		hostParams: []string{"domn", "domain", "hostname", "host", "id", "host_id"},
+		ipParams:   []string{"addr", "myip", "ip"},
 	}
 }
 
@@ -92,50 +153,6 @@ func getQueryParam(q map[string][]string, names ...string) string {
 	return ""
 }
 
-func verifyPassword(storedPassword, inputPassword string) bool {
-	if storedPassword == inputPassword {
-		return true
-	}
-
-	md5Hash := md5.Sum([]byte(storedPassword))
-	md5Str := hex.EncodeToString(md5Hash[:])
-	if strings.EqualFold(md5Str, inputPassword) {
-		return true
-	}
-
-	sha256Hash := sha256.Sum256([]byte(storedPassword))
-	sha256Str := hex.EncodeToString(sha256Hash[:])
-	if strings.EqualFold(sha256Str, inputPassword) {
-		return true
-	}
-
-	if decoded, err := base64.StdEncoding.DecodeString(inputPassword); err == nil {
-		if string(decoded) == storedPassword {
-			return true
-		}
-	}
-
-	inputMd5 := md5.Sum([]byte(inputPassword))
-	inputMd5Str := hex.EncodeToString(inputMd5[:])
-	if strings.EqualFold(storedPassword, inputMd5Str) {
-		return true
-	}
-
-	inputSha256 := sha256.Sum256([]byte(inputPassword))
-	inputSha256Str := hex.EncodeToString(inputSha256[:])
-	if strings.EqualFold(storedPassword, inputSha256Str) {
-		return true
-	}
-
-	if decoded, err := base64.StdEncoding.DecodeString(storedPassword); err == nil {
-		if string(decoded) == inputPassword {
-			return true
-		}
-	}
-
-	return false
-}
-
 func parseReqc(raw string) (int, error) {
 	if raw == "" {
 		return 0, nil
@@ -0,0 +1,601 @@
+package mode
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/NewFuture/CloudDDNS/pkg/config"
+	"github.com/NewFuture/CloudDDNS/pkg/guard"
+	"github.com/NewFuture/CloudDDNS/pkg/logging"
+	"github.com/NewFuture/CloudDDNS/pkg/provider"
+)
+
+// CloudflarePrefix is the path prefix of the Cloudflare v4 API façade.
+const CloudflarePrefix = "/client/v4/"
+
+// maxCloudflareBody caps the JSON body accepted by record writes.
+const maxCloudflareBody = 64 << 10
+
+// Cloudflare API error codes returned by the façade.
+const (
+	cfCodeRateLimit  = 971   // Please wait and consider throttling your request speed
+	cfCodeValidation = 1004  // DNS Validation Error
+	cfCodeNoRoute    = 7000  // No route for that URI
+	cfCodeMethod     = 7001  // Method not allowed for this endpoint
+	cfCodeZone       = 7003  // Could not route to the zone identifier
+	cfCodeForbidden  = 9109  // Unauthorized to access requested resource
+	cfCodeAuth       = 10000 // Authentication error
+	cfCodeUpstream   = 10001 // Upstream DNS provider error
+	cfCodeNotFound   = 81044 // Record does not exist
+	cfCodeExists     = 81057 // Record already exists
+	cfCodeIdentical  = 81058 // An identical record already exists
+)
+
+// cfRecordTypes are the record types the façade exposes, matching the types
+// every provider implements.
+var cfRecordTypes = []string{provider.RecordTypeA, provider.RecordTypeAAAA, provider.RecordTypeMX, provider.RecordTypeTXT}
+
+// CloudflareAPI serves a minimal Cloudflare v4 compatible API so tools that
+// only speak Cloudflare (Traefik, Caddy, certbot-dns-cloudflare) can manage
+// records through the user's provider. Bearer tokens map to users via
+// cloudflare_tokens. Zone and record IDs are the hex-encoded zone name and
+// "<type>/<name>", so no state is kept; each name holds at most one record per
+// type, as with the DDNS protocols. Log lines go to the request logger stored
+// in the request context by logging.NewContext.
+type CloudflareAPI struct {
+	newProvider func(*config.UserConfig) (provider.Provider, error)
+}
+
+func NewCloudflareAPI() *CloudflareAPI {
+	return &CloudflareAPI{newProvider: provider.GetProvider}
+}
+
+type cfError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type cfResultInfo struct {
+	Page       int `json:"page"`
+	PerPage    int `json:"per_page"`
+	Count      int `json:"count"`
+	TotalCount int `json:"total_count"`
+	TotalPages int `json:"total_pages"`
+}
+
+type cfEnvelope struct {
+	Success    bool          `json:"success"`
+	Errors     []cfError     `json:"errors"`
+	Messages   []string      `json:"messages"`
+	Result     interface{}   `json:"result"`
+	ResultInfo *cfResultInfo `json:"result_info,omitempty"`
+}
+
+type cfZone struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Paused bool   `json:"paused"`
+	Type   string `json:"type"`
+}
+
+type cfRecord struct {
+	ID        string `json:"id"`
+	ZoneID    string `json:"zone_id"`
+	ZoneName  string `json:"zone_name"`
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	Content   string `json:"content"`
+	Proxiable bool   `json:"proxiable"`
+	Proxied   bool   `json:"proxied"`
+	TTL       int    `json:"ttl"`
+	Priority  *int   `json:"priority,omitempty"`
+	Comment   string `json:"comment,omitempty"`
+}
+
+// cfRecordInput is the body of record create and update calls. TTL 1 means
+// automatic in Cloudflare and maps to the provider default.
+type cfRecordInput struct {
+	Type     string `json:"type"`
+	Name     string `json:"name"`
+	Content  string `json:"content"`
+	TTL      int    `json:"ttl"`
+	Priority *int   `json:"priority"`
+	Comment  string `json:"comment"`
+}
+
+// cfStatusError is a failed call with its HTTP status and Cloudflare code.
+type cfStatusError struct {
+	status int
+	code   int
+	msg    string
+}
+
+func (e *cfStatusError) Error() string { return e.msg }
+
+func cfErrorf(status, code int, format string, args ...interface{}) *cfStatusError {
+	return &cfStatusError{status: status, code: code, msg: fmt.Sprintf(format, args...)}
+}
+
+// ServeHTTP authenticates the bearer token and routes the calls below. Wrong
+// tokens count as authentication failures of the source IP in the brute-force
+// guard, and banned sources are answered with 429 before the token is checked.
+//
+//   - GET /user/tokens/verify
+//   - GET /zones[?name=]                 and GET /zones/{zone}
+//   - GET, POST /zones/{zone}/dns_records
+//   - GET, PUT, PATCH, DELETE /zones/{zone}/dns_records/{record}
+func (a *CloudflareAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+	g := guard.Default()
+	ip, err := extractRemoteIP(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	if until, banned := g.Blocked("", ip); banned {
+		logger.Warn("Rejected Cloudflare API call from banned client", "ip", ip, "until", until.Format(time.RFC3339))
+		writeCloudflareError(w, cfErrorf(http.StatusTooManyRequests, cfCodeRateLimit, "Too many authentication failures, try again later"))
+		return
+	}
+	// Only "Authorization: Bearer <token>" is accepted; other schemes or a bare
+	// header never match a token, so they are not counted by the guard.
+	token, bearer := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	token = strings.TrimSpace(token)
+	var u *config.UserConfig
+	if bearer {
+		u = config.GetUserByCloudflareToken(token)
+	}
+	if u == nil {
+		logger.Warn("Cloudflare API authentication failed", "remote", r.RemoteAddr)
+		if bearer && token != "" {
+			g.Fail("", ip)
+		}
+		writeCloudflareError(w, cfErrorf(http.StatusForbidden, cfCodeAuth, "Authentication error"))
+		return
+	}
+	g.Succeed("", ip)
+	if u.Blocked {
+		logger.Warn("Blocked user attempted a Cloudflare API call", "user", u.Username)
+		writeCloudflareError(w, cfErrorf(http.StatusForbidden, cfCodeForbidden, "User is blocked"))
+		return
+	}
+	logger.Debug("Cloudflare API call", "method", r.Method, "path", r.URL.Path, "user", u.Username)
+
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, CloudflarePrefix), "/"), "/")
+	if strings.Join(parts, "/") == "user/tokens/verify" {
+		if r.Method != http.MethodGet {
+			writeCloudflareError(w, cfErrorf(http.StatusMethodNotAllowed, cfCodeMethod, "Method not allowed for this endpoint"))
+			return
+		}
+		writeCloudflare(w, map[string]string{"id": u.Username, "status": "active"}, nil)
+		return
+	}
+	if parts[0] != "zones" || len(parts) > 4 || (len(parts) > 2 && parts[2] != "dns_records") {
+		writeCloudflareError(w, cfErrorf(http.StatusNotFound, cfCodeNoRoute, "No route for that URI"))
+		return
+	}
+
+	p, err := a.newProvider(u)
+	if err != nil {
+		logger.Error("Provider init failed", "user", u.Username, "provider", u.Provider, "error", err)
+		writeCloudflareError(w, cfErrorf(http.StatusInternalServerError, cfCodeUpstream, "DNS provider unavailable"))
+		return
+	}
+
+	var result interface{}
+	var info *cfResultInfo
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		result, info, err = a.listZones(p, r)
+	case len(parts) == 2 && r.Method == http.MethodGet:
+		result, err = a.getZone(p, parts[1])
+	case len(parts) == 3 && r.Method == http.MethodGet:
+		result, info, err = a.listRecords(p, u, parts[1], r)
+	case len(parts) == 3 && r.Method == http.MethodPost:
+		result, err = a.createRecord(p, u, parts[1], r)
+	case len(parts) == 4 && r.Method == http.MethodGet:
+		result, err = a.getRecord(p, u, parts[1], parts[3])
+	case len(parts) == 4 && (r.Method == http.MethodPut || r.Method == http.MethodPatch):
+		result, err = a.updateRecord(p, u, parts[1], parts[3], r)
+	case len(parts) == 4 && r.Method == http.MethodDelete:
+		result, err = a.deleteRecord(p, u, parts[1], parts[3], r)
+	default:
+		err = cfErrorf(http.StatusMethodNotAllowed, cfCodeMethod, "Method not allowed for this endpoint")
+	}
+	if err != nil {
+		writeCloudflareError(w, err)
+		return
+	}
+	writeCloudflare(w, result, info)
+}
+
+// listZones lists the account's zones, or the zone matching ?name=. Without
+// a name the provider must be able to enumerate its zones.
+func (a *CloudflareAPI) listZones(p provider.Provider, r *http.Request) ([]cfZone, *cfResultInfo, error) {
+	zones := []cfZone{}
+	if name := r.URL.Query().Get("name"); name != "" {
+		zone, sub, err := p.SplitDomain(cfNormalizeName(name))
+		if err == nil && sub == "@" {
+			zones = append(zones, cfZoneFor(zone))
+		} else if err != nil && !errors.Is(err, provider.ErrZoneNotFound) {
+			return nil, nil, cfProviderError(err)
+		}
+		return zones, cfPage(len(zones)), nil
+	}
+
+	lister, ok := p.(provider.ZoneLister)
+	if !ok {
+		return nil, nil, cfErrorf(http.StatusBadRequest, cfCodeValidation, "name filter is required for this provider")
+	}
+	names, err := lister.ListZones()
+	if err != nil {
+		return nil, nil, cfProviderError(err)
+	}
+	for _, name := range names {
+		zones = append(zones, cfZoneFor(cfNormalizeName(name)))
+	}
+	return zones, cfPage(len(zones)), nil
+}
+
+func (a *CloudflareAPI) getZone(p provider.Provider, zoneID string) (cfZone, error) {
+	zone, err := resolveCloudflareZone(p, zoneID)
+	if err != nil {
+		return cfZone{}, err
+	}
+	return cfZoneFor(zone), nil
+}
+
+// listRecords returns the records at ?name= (or name.exact=), optionally
+// narrowed by type and content. Providers cannot enumerate a whole zone
+// through the Provider interface, so the name filter is required.
+func (a *CloudflareAPI) listRecords(p provider.Provider, u *config.UserConfig, zoneID string, r *http.Request) ([]cfRecord, *cfResultInfo, error) {
+	zone, err := resolveCloudflareZone(p, zoneID)
+	if err != nil {
+		return nil, nil, err
+	}
+	q := r.URL.Query()
+	rawName := getQueryParam(q, "name", "name.exact")
+	if rawName == "" {
+		return nil, nil, cfErrorf(http.StatusBadRequest, cfCodeValidation, "name filter is required")
+	}
+	name, err := cfRecordName(rawName, zone)
+	if err != nil {
+		return nil, nil, err
+	}
+	types := cfRecordTypes
+	if t := strings.ToUpper(q.Get("type")); t != "" {
+		if !isCloudflareType(t) {
+			return []cfRecord{}, cfPage(0), nil
+		}
+		types = []string{t}
+	}
+
+	records := []cfRecord{}
+	for _, rtype := range types {
+		opts := recordOptions(u, name)
+		opts.Type = rtype
+		rec, err := p.GetRecord(name, opts)
+		if errors.Is(err, provider.ErrRecordNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, nil, cfProviderError(err)
+		}
+		if content := q.Get("content"); content != "" && content != rec.Value {
+			continue
+		}
+		records = append(records, cfRecordFor(zone, name, rtype, rec))
+	}
+	return records, cfPage(len(records)), nil
+}
+
+func (a *CloudflareAPI) getRecord(p provider.Provider, u *config.UserConfig, zoneID, recordID string) (cfRecord, error) {
+	zone, name, rtype, err := resolveCloudflareRecord(p, zoneID, recordID)
+	if err != nil {
+		return cfRecord{}, err
+	}
+	opts := recordOptions(u, name)
+	opts.Type = rtype
+	rec, err := p.GetRecord(name, opts)
+	if errors.Is(err, provider.ErrRecordNotFound) {
+		return cfRecord{}, cfErrorf(http.StatusNotFound, cfCodeNotFound, "Record does not exist.")
+	}
+	if err != nil {
+		return cfRecord{}, cfProviderError(err)
+	}
+	return cfRecordFor(zone, name, rtype, rec), nil
+}
+
+// createRecord writes a new record. Providers hold one record per name and
+// type, so a create over an existing one is rejected like Cloudflare does for
+// conflicting records instead of replacing it: two concurrent ACME challenges
+// for the same name must not silently overwrite each other. This is a known
+// limitation: an order for both example.com and *.example.com needs two TXT
+// values at _acme-challenge.example.com and cannot be completed in one go.
+func (a *CloudflareAPI) createRecord(p provider.Provider, u *config.UserConfig, zoneID string, r *http.Request) (cfRecord, error) {
+	zone, err := resolveCloudflareZone(p, zoneID)
+	if err != nil {
+		return cfRecord{}, err
+	}
+	in, err := decodeCloudflareRecord(r)
+	if err != nil {
+		return cfRecord{}, err
+	}
+	name, err := cfRecordName(in.Name, zone)
+	if err != nil {
+		return cfRecord{}, err
+	}
+	rtype := strings.ToUpper(in.Type)
+	if err := validateCloudflareContent(rtype, in.Content); err != nil {
+		return cfRecord{}, err
+	}
+	opts := recordOptions(u, name)
+	opts.Type = rtype
+	existing, err := p.GetRecord(name, opts)
+	switch {
+	case err == nil && existing.Value == in.Content:
+		return cfRecord{}, cfErrorf(http.StatusBadRequest, cfCodeIdentical, "An identical record already exists.")
+	case err == nil:
+		return cfRecord{}, cfErrorf(http.StatusBadRequest, cfCodeExists, "A %s record with that host already exists.", rtype)
+	case !errors.Is(err, provider.ErrRecordNotFound):
+		return cfRecord{}, cfProviderError(err)
+	}
+	return a.writeRecord(logging.FromContext(r.Context()), p, u, zone, name, rtype, in)
+}
+
+// updateRecord overwrites (PUT) or patches (PATCH) an existing record. The
+// record ID fixes the name and type, so they cannot be changed.
+func (a *CloudflareAPI) updateRecord(p provider.Provider, u *config.UserConfig, zoneID, recordID string, r *http.Request) (cfRecord, error) {
+	zone, name, rtype, err := resolveCloudflareRecord(p, zoneID, recordID)
+	if err != nil {
+		return cfRecord{}, err
+	}
+	in, err := decodeCloudflareRecord(r)
+	if err != nil {
+		return cfRecord{}, err
+	}
+	if in.Type != "" && !strings.EqualFold(in.Type, rtype) {
+		return cfRecord{}, cfErrorf(http.StatusBadRequest, cfCodeValidation, "record type cannot be changed")
+	}
+	if in.Name != "" {
+		if newName, err := cfRecordName(in.Name, zone); err != nil || newName != name {
+			return cfRecord{}, cfErrorf(http.StatusBadRequest, cfCodeValidation, "record name cannot be changed")
+		}
+	}
+
+	opts := recordOptions(u, name)
+	opts.Type = rtype
+	existing, err := p.GetRecord(name, opts)
+	if errors.Is(err, provider.ErrRecordNotFound) {
+		return cfRecord{}, cfErrorf(http.StatusNotFound, cfCodeNotFound, "Record does not exist.")
+	}
+	if err != nil {
+		return cfRecord{}, cfProviderError(err)
+	}
+	if r.Method == http.MethodPatch {
+		if in.Content == "" {
+			in.Content = existing.Value
+		}
+		if in.TTL == 0 {
+			in.TTL = existing.TTL
+		}
+		if in.Comment == "" {
+			in.Comment = existing.Remark
+		}
+		if in.Priority == nil && rtype == provider.RecordTypeMX {
+			in.Priority = &existing.Priority
+		}
+	}
+	return a.writeRecord(logging.FromContext(r.Context()), p, u, zone, name, rtype, in)
+}
+
+func (a *CloudflareAPI) deleteRecord(p provider.Provider, u *config.UserConfig, zoneID, recordID string, r *http.Request) (map[string]string, error) {
+	_, name, rtype, err := resolveCloudflareRecord(p, zoneID, recordID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkHostPolicy(p, u, name); err != nil {
+		return nil, cfProviderError(err)
+	}
+	opts := recordOptions(u, name)
+	opts.Type = rtype
+	// Providers delete idempotently; Cloudflare reports a missing record.
+	if _, err := p.GetRecord(name, opts); errors.Is(err, provider.ErrRecordNotFound) {
+		return nil, cfErrorf(http.StatusNotFound, cfCodeNotFound, "Record does not exist.")
+	} else if err != nil {
+		return nil, cfProviderError(err)
+	}
+	if err := p.DeleteRecord(name, opts); err != nil {
+		return nil, cfProviderError(err)
+	}
+	logging.FromContext(r.Context()).Info("Cloudflare API deleted record", "type", rtype, "name", name, "user", u.Username)
+	return map[string]string{"id": recordID}, nil
+}
+
+// writeRecord validates the input and writes it through the provider.
+func (a *CloudflareAPI) writeRecord(logger *slog.Logger, p provider.Provider, u *config.UserConfig, zone, name, rtype string, in cfRecordInput) (cfRecord, error) {
+	if err := validateCloudflareContent(rtype, in.Content); err != nil {
+		return cfRecord{}, err
+	}
+	if err := checkHostPolicy(p, u, name); err != nil {
+		return cfRecord{}, cfProviderError(err)
+	}
+
+	opts := recordOptions(u, name)
+	opts.Type = rtype
+	if in.TTL > 1 {
+		opts.TTL = in.TTL
+	}
+	if in.Comment != "" {
+		opts.Remark = in.Comment
+	}
+	if rtype == provider.RecordTypeMX {
+		opts.Priority = 10
+		if in.Priority != nil {
+			opts.Priority = *in.Priority
+		}
+	}
+	if _, err := p.UpdateRecord(name, in.Content, opts); err != nil {
+		logger.Error("Cloudflare API update failed", "type", rtype, "name", name, "user", u.Username, "error", err)
+		return cfRecord{}, cfProviderError(err)
+	}
+	logger.Info("Cloudflare API wrote record", "type", rtype, "name", name, "user", u.Username)
+	return cfRecordFor(zone, name, rtype, provider.Record{Value: in.Content, TTL: opts.TTL, Priority: opts.Priority, Remark: opts.Remark}), nil
+}
+
+func decodeCloudflareRecord(r *http.Request) (cfRecordInput, error) {
+	var in cfRecordInput
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxCloudflareBody)).Decode(&in); err != nil {
+		return in, cfErrorf(http.StatusBadRequest, cfCodeValidation, "invalid request body: %v", err)
+	}
+	return in, nil
+}
+
+// validateCloudflareContent checks the record type and its content.
+func validateCloudflareContent(rtype, content string) error {
+	if !isCloudflareType(rtype) {
+		return cfErrorf(http.StatusBadRequest, cfCodeValidation, "unsupported record type %q", rtype)
+	}
+	ip := net.ParseIP(content)
+	switch {
+	case content == "":
+		return cfErrorf(http.StatusBadRequest, cfCodeValidation, "content is required")
+	case rtype == provider.RecordTypeA && (ip == nil || ip.To4() == nil):
+		return cfErrorf(http.StatusBadRequest, cfCodeValidation, "content for A record is invalid. Must be a valid IPv4 address")
+	case rtype == provider.RecordTypeAAAA && (ip == nil || ip.To4() != nil):
+		return cfErrorf(http.StatusBadRequest, cfCodeValidation, "content for AAAA record is invalid. Must be a valid IPv6 address")
+	}
+	return nil
+}
+
+func isCloudflareType(rtype string) bool {
+	for _, t := range cfRecordTypes {
+		if t == rtype {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveCloudflareZone decodes a zone ID and checks the account still hosts it.
+func resolveCloudflareZone(p provider.Provider, zoneID string) (string, error) {
+	raw, err := hex.DecodeString(zoneID)
+	if err != nil || len(raw) == 0 {
+		return "", cfErrorf(http.StatusNotFound, cfCodeZone, "Could not route to /zones/%s, perhaps your object identifier is invalid?", zoneID)
+	}
+	zone, sub, err := p.SplitDomain(string(raw))
+	if err != nil || sub != "@" {
+		return "", cfErrorf(http.StatusNotFound, cfCodeZone, "Could not route to /zones/%s, perhaps your object identifier is invalid?", zoneID)
+	}
+	return zone, nil
+}
+
+// resolveCloudflareRecord decodes a record ID into its name and type and
+// checks that the name lies in the zone.
+func resolveCloudflareRecord(p provider.Provider, zoneID, recordID string) (zone, name, rtype string, err error) {
+	zone, err = resolveCloudflareZone(p, zoneID)
+	if err != nil {
+		return "", "", "", err
+	}
+	notFound := cfErrorf(http.StatusNotFound, cfCodeNotFound, "Record does not exist.")
+	raw, decodeErr := hex.DecodeString(recordID)
+	if decodeErr != nil {
+		return "", "", "", notFound
+	}
+	rtype, name, ok := strings.Cut(string(raw), "/")
+	if !ok || !isCloudflareType(rtype) {
+		return "", "", "", notFound
+	}
+	if name != zone && !strings.HasSuffix(name, "."+zone) {
+		return "", "", "", notFound
+	}
+	return zone, name, rtype, nil
+}
+
+// cfRecordName resolves a record name relative to zone: "@" is the zone
+// itself and names outside the zone get the zone appended, as Cloudflare does.
+func cfRecordName(raw, zone string) (string, error) {
+	name := cfNormalizeName(raw)
+	switch {
+	case name == "" || strings.ContainsAny(name, " /"):
+		return "", cfErrorf(http.StatusBadRequest, cfCodeValidation, "invalid record name %q", raw)
+	case name == "@" || name == zone:
+		return zone, nil
+	case strings.HasSuffix(name, "."+zone):
+		return name, nil
+	default:
+		return name + "." + zone, nil
+	}
+}
+
+func cfNormalizeName(name string) string {
+	return strings.ToLower(strings.TrimSuffix(strings.TrimSpace(name), "."))
+}
+
+func cfZoneFor(zone string) cfZone {
+	return cfZone{ID: hex.EncodeToString([]byte(zone)), Name: zone, Status: "active", Type: "full"}
+}
+
+func cfRecordFor(zone, name, rtype string, rec provider.Record) cfRecord {
+	out := cfRecord{
+		ID:       hex.EncodeToString([]byte(rtype + "/" + name)),
+		ZoneID:   hex.EncodeToString([]byte(zone)),
+		ZoneName: zone,
+		Name:     name,
+		Type:     rtype,
+		Content:  rec.Value,
+		TTL:      rec.TTL,
+		Comment:  rec.Remark,
+	}
+	if out.TTL == 0 {
+		out.TTL = 1
+	}
+	if rtype == provider.RecordTypeMX {
+		priority := rec.Priority
+		out.Priority = &priority
+	}
+	return out
+}
+
+func cfPage(count int) *cfResultInfo {
+	return &cfResultInfo{Page: 1, PerPage: count, Count: count, TotalCount: count, TotalPages: 1}
+}
+
+// cfProviderError maps a policy or provider failure to an API error using
+// the same classification as the DDNS protocols.
+func cfProviderError(err error) error {
+	switch outcomeForError(err) {
+	case OutcomeNoHost, OutcomeNotDonator:
+		return cfErrorf(http.StatusForbidden, cfCodeForbidden, "%v", err)
+	default:
+		return cfErrorf(http.StatusBadGateway, cfCodeUpstream, "DNS provider error: %v", err)
+	}
+}
+
+func writeCloudflare(w http.ResponseWriter, result interface{}, info *cfResultInfo) {
+	writeCloudflareJSON(w, http.StatusOK, cfEnvelope{Success: true, Errors: []cfError{}, Messages: []string{}, Result: result, ResultInfo: info})
+}
+
+func writeCloudflareError(w http.ResponseWriter, err error) {
+	var se *cfStatusError
+	if !errors.As(err, &se) {
+		se = cfErrorf(http.StatusInternalServerError, cfCodeUpstream, "%v", err)
+	}
+	writeCloudflareJSON(w, se.status, cfEnvelope{Errors: []cfError{{Code: se.code, Message: se.msg}}, Messages: []string{}})
+}
+
+func writeCloudflareJSON(w http.ResponseWriter, status int, env cfEnvelope) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(env); err != nil {
+		slog.Error("HTTP write error", "error", err)
+	}
+}
@@ -0,0 +1,171 @@
+package mode
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NewFuture/CloudDDNS/pkg/config"
+	"github.com/NewFuture/CloudDDNS/pkg/guard"
+	"github.com/NewFuture/CloudDDNS/pkg/provider"
+)
+
+func TestCloudflareAPI(t *testing.T) {
+	originalConfig := config.Current()
+	defer config.SetCurrent(originalConfig)
+	config.SetCurrent(&config.Config{Users: []config.UserConfig{
+		{Username: "cf", Password: "secret", Provider: "aliyun", CloudflareTokens: []string{"cf-token"}},
+		{Username: "blocked", Password: "secret", Provider: "aliyun", CloudflareTokens: []string{"blocked-token"}, Blocked: true},
+	}})
+
+	fake := &fakeProvider{records: map[string]string{}}
+	api := NewCloudflareAPI()
+	api.newProvider = func(*config.UserConfig) (provider.Provider, error) { return fake, nil }
+
+	zoneID := hex.EncodeToString([]byte("example.com"))
+	txtID := hex.EncodeToString([]byte("TXT/_acme-challenge.example.com"))
+	records := "/client/v4/zones/" + zoneID + "/dns_records"
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		token      string
+		auth       string
+		body       string
+		wantStatus int
+		wantCode   int
+		wantResult string
+	}{
+		{name: "verify token", method: "GET", path: "/client/v4/user/tokens/verify", wantStatus: 200, wantResult: `{"id":"cf","status":"active"}`},
+		{name: "invalid token", method: "GET", path: "/client/v4/zones", token: "wrong", wantStatus: 403, wantCode: cfCodeAuth},
+		{name: "token without bearer scheme", method: "GET", path: "/client/v4/user/tokens/verify", auth: "cf-token", wantStatus: 403, wantCode: cfCodeAuth},
+		{name: "basic scheme", method: "GET", path: "/client/v4/user/tokens/verify", auth: "Basic cf-token", wantStatus: 403, wantCode: cfCodeAuth},
+		{name: "blocked user", method: "GET", path: "/client/v4/zones", token: "blocked-token", wantStatus: 403, wantCode: cfCodeForbidden},
+		{name: "zone by name", method: "GET", path: "/client/v4/zones?name=example.com", wantStatus: 200, wantResult: `[{"id":"` + zoneID + `","name":"example.com","status":"active","paused":false,"type":"full"}]`},
+		{name: "subdomain is not a zone", method: "GET", path: "/client/v4/zones?name=www.example.com", wantStatus: 200, wantResult: `[]`},
+		{name: "zone list needs name", method: "GET", path: "/client/v4/zones", wantStatus: 400, wantCode: cfCodeValidation},
+		{name: "unknown zone id", method: "GET", path: "/client/v4/zones/zz/dns_records?name=www", wantStatus: 404, wantCode: cfCodeZone},
+		{name: "create txt", method: "POST", path: records, body: `{"type":"TXT","name":"_acme-challenge","content":"abc","ttl":120}`, wantStatus: 200,
+			wantResult: `{"id":"` + txtID + `","zone_id":"` + zoneID + `","zone_name":"example.com","name":"_acme-challenge.example.com","type":"TXT","content":"abc","proxiable":false,"proxied":false,"ttl":120}`},
+		// A second ACME challenge for the same name must not replace the first.
+		{name: "second challenge conflicts", method: "POST", path: records, body: `{"type":"TXT","name":"_acme-challenge","content":"xyz","ttl":120}`, wantStatus: 400, wantCode: cfCodeExists},
+		{name: "identical create", method: "POST", path: records, body: `{"type":"TXT","name":"_acme-challenge","content":"abc"}`, wantStatus: 400, wantCode: cfCodeIdentical},
+		{name: "list by name type content", method: "GET", path: records + "?type=TXT&name=_acme-challenge.example.com&content=abc", wantStatus: 200,
+			wantResult: `[{"id":"` + txtID + `","zone_id":"` + zoneID + `","zone_name":"example.com","name":"_acme-challenge.example.com","type":"TXT","content":"abc","proxiable":false,"proxied":false,"ttl":120}]`},
+		{name: "list content mismatch", method: "GET", path: records + "?name=_acme-challenge.example.com&content=other", wantStatus: 200, wantResult: `[]`},
+		{name: "list needs name", method: "GET", path: records, wantStatus: 400, wantCode: cfCodeValidation},
+		{name: "put sets comment", method: "PUT", path: records + "/" + txtID, body: `{"content":"abc","ttl":120,"comment":"acme"}`, wantStatus: 200,
+			wantResult: `{"id":"` + txtID + `","zone_id":"` + zoneID + `","zone_name":"example.com","name":"_acme-challenge.example.com","type":"TXT","content":"abc","proxiable":false,"proxied":false,"ttl":120,"comment":"acme"}`},
+		{name: "patch content keeps ttl and comment", method: "PATCH", path: records + "/" + txtID, body: `{"content":"def"}`, wantStatus: 200,
+			wantResult: `{"id":"` + txtID + `","zone_id":"` + zoneID + `","zone_name":"example.com","name":"_acme-challenge.example.com","type":"TXT","content":"def","proxiable":false,"proxied":false,"ttl":120,"comment":"acme"}`},
+		{name: "get patched", method: "GET", path: records + "/" + txtID, wantStatus: 200,
+			wantResult: `{"id":"` + txtID + `","zone_id":"` + zoneID + `","zone_name":"example.com","name":"_acme-challenge.example.com","type":"TXT","content":"def","proxiable":false,"proxied":false,"ttl":120,"comment":"acme"}`},
+		{name: "clean up first challenge", method: "DELETE", path: records + "/" + txtID, wantStatus: 200, wantResult: `{"id":"` + txtID + `"}`},
+		{name: "second challenge after cleanup", method: "POST", path: records, body: `{"type":"TXT","name":"_acme-challenge","content":"xyz"}`, wantStatus: 200,
+			wantResult: `{"id":"` + txtID + `","zone_id":"` + zoneID + `","zone_name":"example.com","name":"_acme-challenge.example.com","type":"TXT","content":"xyz","proxiable":false,"proxied":false,"ttl":1}`},
+		{name: "put cannot change type", method: "PUT", path: records + "/" + txtID, body: `{"type":"A","content":"1.2.3.4"}`, wantStatus: 400, wantCode: cfCodeValidation},
+		{name: "delete", method: "DELETE", path: records + "/" + txtID, wantStatus: 200, wantResult: `{"id":"` + txtID + `"}`},
+		{name: "get deleted", method: "GET", path: records + "/" + txtID, wantStatus: 404, wantCode: cfCodeNotFound},
+		{name: "delete deleted", method: "DELETE", path: records + "/" + txtID, wantStatus: 404, wantCode: cfCodeNotFound},
+		{name: "invalid A content", method: "POST", path: records, body: `{"type":"A","name":"www.example.com","content":"2001:db8::1"}`, wantStatus: 400, wantCode: cfCodeValidation},
+		{name: "unsupported type", method: "POST", path: records, body: `{"type":"CNAME","name":"www","content":"example.net"}`, wantStatus: 400, wantCode: cfCodeValidation},
+		{name: "wildcard not granted", method: "POST", path: records, body: `{"type":"A","name":"*","content":"1.2.3.4"}`, wantStatus: 403, wantCode: cfCodeForbidden},
+		{name: "unknown route", method: "GET", path: "/client/v4/accounts", wantStatus: 404, wantCode: cfCodeNoRoute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			token := tt.token
+			if token == "" {
+				token = "cf-token"
+			}
+			auth := tt.auth
+			if auth == "" {
+				auth = "Bearer " + token
+			}
+			req.Header.Set("Authorization", auth)
+			w := httptest.NewRecorder()
+			api.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %s)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			var env struct {
+				Success bool            `json:"success"`
+				Errors  []cfError       `json:"errors"`
+				Result  json.RawMessage `json:"result"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &env); err != nil {
+				t.Fatalf("invalid JSON %q: %v", w.Body.String(), err)
+			}
+			if tt.wantCode != 0 {
+				if env.Success || len(env.Errors) != 1 || env.Errors[0].Code != tt.wantCode {
+					t.Fatalf("errors = %+v, want code %d", env.Errors, tt.wantCode)
+				}
+				return
+			}
+			if !env.Success || string(env.Result) != tt.wantResult {
+				t.Fatalf("result = %s, want %s", env.Result, tt.wantResult)
+			}
+		})
+	}
+
+	t.Run("wrong tokens are throttled", func(t *testing.T) {
+		defer guard.SetDefault(guard.Default())
+		guard.SetDefault(guard.New(guard.Policy{MaxFailures: 2, Ban: time.Minute, MaxBan: time.Hour, Window: time.Hour}))
+		call := func(token string) int {
+			req := httptest.NewRequest("GET", "/client/v4/user/tokens/verify", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+			api.ServeHTTP(w, req)
+			return w.Code
+		}
+		for i := 0; i < 2; i++ {
+			if code := call("guess"); code != 403 {
+				t.Fatalf("wrong token %d: status %d, want 403", i+1, code)
+			}
+		}
+		if code := call("cf-token"); code != 429 {
+			t.Fatalf("banned source: status %d, want 429", code)
+		}
+	})
+}
+
+// TestCloudflareAPISingleTXTPerName pins the one-record-per-name limitation:
+// the second TXT value of an apex + wildcard ACME order is rejected and the
+// first value is left in place.
+func TestCloudflareAPISingleTXTPerName(t *testing.T) {
+	originalConfig := config.Current()
+	defer config.SetCurrent(originalConfig)
+	config.SetCurrent(&config.Config{Users: []config.UserConfig{
+		{Username: "cf", Password: "secret", Provider: "aliyun", CloudflareTokens: []string{"cf-token"}},
+	}})
+
+	fake := &fakeProvider{records: map[string]string{}}
+	api := NewCloudflareAPI()
+	api.newProvider = func(*config.UserConfig) (provider.Provider, error) { return fake, nil }
+	records := "/client/v4/zones/" + hex.EncodeToString([]byte("example.com")) + "/dns_records"
+
+	call := func(method, body string) int {
+		req := httptest.NewRequest(method, records, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer cf-token")
+		w := httptest.NewRecorder()
+		api.ServeHTTP(w, req)
+		return w.Code
+	}
+	if code := call("POST", `{"type":"TXT","name":"_acme-challenge","content":"apex-token"}`); code != 200 {
+		t.Fatalf("first TXT: status %d, want 200", code)
+	}
+	if code := call("POST", `{"type":"TXT","name":"_acme-challenge","content":"wildcard-token"}`); code != 400 {
+		t.Fatalf("second TXT: status %d, want 400", code)
+	}
+	rec, err := fake.GetRecord("_acme-challenge.example.com", provider.RecordOptions{Type: provider.RecordTypeTXT})
+	if err != nil || rec.Value != "apex-token" {
+		t.Fatalf("TXT record = %q (%v), want the first value kept", rec.Value, err)
+	}
+}
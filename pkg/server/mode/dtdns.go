@@ -0,0 +1,64 @@
+package mode
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+)
+
+// DtDNSMode implements the DtDNS /api/autodns.cfm protocol: id carries the
+// hostname, pw the password and ip the address. Clients may omit the username
+// entirely, in which case the account is located by its owned_hosts patterns.
+// Replies are the human-readable sentences DtDNS firmware scans for.
+type DtDNSMode struct {
+	*DynMode
+}
+
+func NewDtDNSMode(logger *slog.Logger) Mode {
+	dyn := NewDynMode(false, logger)
+	dyn.hostParams = []string{"id", "hostname"}
+	dyn.ipParams = []string{"ip", "myip"}
+	return &DtDNSMode{DynMode: dyn}
+}
+
+// Process resolves the account from the hostname when no username was sent
+// and the host has no update key, then performs the regular DynDNS update.
+func (m *DtDNSMode) Process(req *Request) Outcome {
+	return m.processByHost(req, "DtDNS")
+}
+
+// Respond writes DtDNS sentences:
+//   - OutcomeSuccess, OutcomeNoChange       -> "Host <host> now points to <ip>."
+//   - OutcomeAuthFailure                    -> "Incorrect password for host <host>."
+//   - OutcomeNoHost, OutcomeInvalidDomain   -> "The hostname <host> does not exist."
+//   - OutcomeAbuse                          -> "Host <host> has been blocked."
+//   - OutcomeNotDonator                     -> "Wildcard hostnames are not enabled for <host>."
+//   - any other outcome                     -> "Server error, host <host> was not updated."
+func (m *DtDNSMode) Respond(w http.ResponseWriter, req *Request, outcome Outcome) {
+	host, ip := "", ""
+	if req != nil {
+		host, ip = req.DisplayDomain(), req.IP
+	}
+
+	var body string
+	switch {
+	case host == "" && outcome == OutcomeInvalidDomain:
+		body = "No valid hostname was specified."
+	case outcome == OutcomeSuccess || outcome == OutcomeNoChange:
+		body = fmt.Sprintf("Host %s now points to %s.", host, ip)
+	case outcome == OutcomeAuthFailure:
+		body = fmt.Sprintf("Incorrect password for host %s.", host)
+	case outcome == OutcomeNoHost || outcome == OutcomeInvalidDomain:
+		body = fmt.Sprintf("The hostname %s does not exist.", host)
+	case outcome == OutcomeAbuse:
+		body = fmt.Sprintf("Host %s has been blocked.", host)
+	case outcome == OutcomeNotDonator:
+		body = fmt.Sprintf("Wildcard hostnames are not enabled for %s.", host)
+	default:
+		body = fmt.Sprintf("Server error, host %s was not updated.", host)
+	}
+
+	if _, err := w.Write([]byte(body)); err != nil {
+		m.logger.Error("Failed to write DtDNS response", "body", body, "error", err)
+	}
+}
@@ -0,0 +1,236 @@
+package mode
+
+import (
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/NewFuture/CloudDDNS/pkg/config"
+	"github.com/NewFuture/CloudDDNS/pkg/provider"
+)
+
+// duckDNSSuffix is stripped from names so clients configured for the public
+// service can be pointed at this server unchanged.
+const duckDNSSuffix = ".duckdns.org"
+
+// acmeChallengeLabel prefixes the host for TXT updates so the record is
+// where ACME DNS-01 validation looks for it.
+const acmeChallengeLabel = "_acme-challenge."
+
+// DuckDNSMode implements the DuckDNS /update protocol: domains and token
+// select the hosts and the user, ip/ipv6 set A/AAAA records, and txt/clear
+// manage the ACME challenge TXT record. Replies are OK or KO, followed by
+// the addresses and UPDATED/NOCHANGE when verbose=true.
+type DuckDNSMode struct {
+	logger *slog.Logger
+}
+
+func NewDuckDNSMode(logger *slog.Logger) Mode {
+	return &DuckDNSMode{logger: loggerOrDefault(logger)}
+}
+
+func (m *DuckDNSMode) Prepare(r *http.Request) (*Request, Outcome) {
+	q := r.URL.Query()
+	req := &Request{
+		Password:   getQueryParam(q, "token"),
+		RemoteAddr: r.RemoteAddr,
+		Verbose:    strings.EqualFold(getQueryParam(q, "verbose"), "true"),
+		Clear:      strings.EqualFold(getQueryParam(q, "clear"), "true"),
+	}
+	if _, ok := q["txt"]; ok {
+		req.UpdateTXT = true
+		req.TXT = getQueryParam(q, "txt")
+	}
+
+	names := getQueryParam(q, "domains")
+	if names == "" {
+		m.logger.Warn("DuckDNS request without domains")
+		return req, OutcomeInvalidDomain
+	}
+	req.Names = strings.Split(names, ",")
+	if len(req.Names) > maxHostsPerRequest {
+		m.logger.Warn("Too many DuckDNS domains in request", "hosts", len(req.Names), "max", maxHostsPerRequest)
+		return req, OutcomeTooManyHosts
+	}
+
+	if req.UpdateTXT || req.Clear {
+		m.logger.Debug("Prepared DuckDNS request", "names", names, "txt", req.UpdateTXT, "clear", req.Clear)
+		return req, OutcomeSuccess
+	}
+
+	// ip may carry either family; ipv6 is explicit. Without either, the
+	// source address is used for the matching family.
+	for _, raw := range []string{getQueryParam(q, "ip"), getQueryParam(q, "ipv6")} {
+		if raw == "" {
+			continue
+		}
+		parsed := net.ParseIP(raw)
+		if parsed == nil {
+			m.logger.Warn("Invalid DuckDNS IP address", "ip", raw)
+			return req, OutcomeSystemError
+		}
+		if parsed.To4() != nil {
+			req.IP = parsed.String()
+		} else {
+			req.IPv6 = parsed.String()
+		}
+	}
+	if req.IP == "" && req.IPv6 == "" {
+		remote, err := extractRemoteIP(r.RemoteAddr)
+		parsed := net.ParseIP(remote)
+		if err != nil || parsed == nil {
+			m.logger.Error("Invalid RemoteAddr format", "remote", r.RemoteAddr, "error", err)
+			return req, OutcomeSystemError
+		}
+		if parsed.To4() != nil {
+			req.IP = parsed.String()
+		} else {
+			req.IPv6 = parsed.String()
+		}
+	}
+	m.logger.Debug("Prepared DuckDNS request", "names", names, "ip", req.IP, "ipv6", req.IPv6)
+	return req, OutcomeSuccess
+}
+
+// Process maps the token to a user, expands the names into the user's zone
+// and applies the update to every host. DuckDNS reports a single result, so
+// any failing host fails the request.
+func (m *DuckDNSMode) Process(req *Request) Outcome {
+	if isDebugMode() && req.Password == "debug" {
+		m.logger.Debug("DuckDNS debug bypass", "names", req.Names)
+		return OutcomeSuccess
+	}
+
+	u := config.GetUserByDuckDNSToken(req.Password)
+	if u == nil {
+		m.logger.Warn("DuckDNS authentication failed: unknown token")
+		return OutcomeAuthFailure
+	}
+	req.Username = u.Username
+	if u.Blocked {
+		m.logger.Warn("Blocked user attempted a DuckDNS update", "user", u.Username)
+		return OutcomeAbuse
+	}
+
+	for _, name := range req.Names {
+		domain, err := expandDuckDNSName(name, u.DuckDNS.Zone)
+		if err != nil {
+			m.logger.Warn("Invalid DuckDNS domain", "name", name, "error", err)
+			return OutcomeInvalidDomain
+		}
+		req.Domains = append(req.Domains, domain)
+	}
+	req.Domain = req.Domains[0]
+
+	p, err := provider.GetProvider(u)
+	if err != nil {
+		m.logger.Error("Provider init failed", "user", u.Username, "provider", u.Provider, "error", err)
+		return OutcomeSystemError
+	}
+
+	changed := false
+	for _, domain := range req.Domains {
+		c, err := m.updateHost(p, u, req, domain)
+		if err != nil {
+			m.logger.Error("DuckDNS update failed", "domain", displayHostname(domain), "error", err)
+			return outcomeForError(err)
+		}
+		changed = changed || c
+	}
+	if !changed {
+		return OutcomeNoChange
+	}
+	m.logger.Info("DuckDNS records updated", "hosts", len(req.Domains), "user", u.Username)
+	return OutcomeSuccess
+}
+
+// updateHost applies the request to a single host.
+func (m *DuckDNSMode) updateHost(p provider.Provider, u *config.UserConfig, req *Request, domain string) (bool, error) {
+	if err := checkHostPolicy(p, u, domain); err != nil {
+		return false, err
+	}
+	opts := recordOptions(u, domain)
+
+	if req.UpdateTXT {
+		opts.Type = provider.RecordTypeTXT
+		name := acmeChallengeLabel + domain
+		if req.Clear {
+			return true, p.DeleteRecord(name, opts)
+		}
+		return p.UpdateRecord(name, req.TXT, opts)
+	}
+
+	if req.Clear {
+		for _, rtype := range []string{provider.RecordTypeA, provider.RecordTypeAAAA} {
+			opts.Type = rtype
+			if err := p.DeleteRecord(domain, opts); err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+	}
+
+	changed := false
+	for _, rec := range []struct{ rtype, value string }{
+		{provider.RecordTypeA, req.IP},
+		{provider.RecordTypeAAAA, req.IPv6},
+	} {
+		if rec.value == "" {
+			continue
+		}
+		opts.Type = rec.rtype
+		c, err := p.UpdateRecord(domain, rec.value, opts)
+		if err != nil {
+			return false, err
+		}
+		changed = changed || c
+	}
+	return changed, nil
+}
+
+// Respond writes OK or KO. Verbose replies add the IPv4 address (or TXT
+// value), the IPv6 address and UPDATED/NOCHANGE on separate lines.
+func (m *DuckDNSMode) Respond(w http.ResponseWriter, req *Request, outcome Outcome) {
+	body := "KO"
+	if outcome == OutcomeSuccess || outcome == OutcomeNoChange {
+		body = "OK"
+		if req != nil && req.Verbose {
+			status := "UPDATED"
+			if outcome == OutcomeNoChange {
+				status = "NOCHANGE"
+			}
+			first := req.IP
+			if req.UpdateTXT {
+				first = req.TXT
+			}
+			body = strings.Join([]string{"OK", first, req.IPv6, status}, "\n")
+		}
+	}
+
+	if _, err := w.Write([]byte(body)); err != nil {
+		m.logger.Error("Failed to write DuckDNS response", "error", err)
+	}
+}
+
+// errDuckDNSName is returned for names that cannot be expanded into the zone.
+var errDuckDNSName = errors.New("invalid duckdns name")
+
+// expandDuckDNSName turns a DuckDNS short name ("home" or "home.duckdns.org")
+// into a hostname under zone. Names already inside zone are kept.
+func expandDuckDNSName(name, zone string) (string, error) {
+	zone, err := normalizeHostname(zone)
+	if err != nil {
+		return "", err
+	}
+	name = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(name), "."))
+	name = strings.TrimSuffix(name, duckDNSSuffix)
+	if name == "" {
+		return "", errDuckDNSName
+	}
+	if name != zone && !strings.HasSuffix(name, "."+zone) {
+		name += "." + zone
+	}
+	return normalizeHostname(name)
+}
@@ -0,0 +1,99 @@
+package mode
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/NewFuture/CloudDDNS/pkg/config"
+	"github.com/NewFuture/CloudDDNS/pkg/provider"
+)
+
+func TestExpandDuckDNSName(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{name: "home", want: "home.ddns.example.com"},
+		{name: "home.duckdns.org", want: "home.ddns.example.com"},
+		{name: "Cam.Home", want: "cam.home.ddns.example.com"},
+		{name: "nas.ddns.example.com", want: "nas.ddns.example.com"},
+		{name: "", wantErr: true},
+		{name: "-bad", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := expandDuckDNSName(tt.name, "ddns.example.com")
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expandDuckDNSName(%q) = %q, want error", tt.name, got)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("expandDuckDNSName(%q) = %q, %v, want %q", tt.name, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDuckDNSUpdateHost(t *testing.T) {
+	tests := []struct {
+		name      string
+		req       Request
+		wantCalls []string
+		wantTypes []string
+	}{
+		{
+			name:      "ipv4 only",
+			req:       Request{IP: "1.2.3.4"},
+			wantCalls: []string{"update home.example.com 1.2.3.4"},
+			wantTypes: []string{provider.RecordTypeA},
+		},
+		{
+			name:      "ipv4 and ipv6",
+			req:       Request{IP: "1.2.3.4", IPv6: "2001:db8::1"},
+			wantCalls: []string{"update home.example.com 1.2.3.4", "update home.example.com 2001:db8::1"},
+			wantTypes: []string{provider.RecordTypeA, provider.RecordTypeAAAA},
+		},
+		{
+			name:      "clear addresses",
+			req:       Request{Clear: true},
+			wantCalls: []string{"delete home.example.com", "delete home.example.com"},
+			wantTypes: []string{provider.RecordTypeA, provider.RecordTypeAAAA},
+		},
+		{
+			name:      "set acme txt",
+			req:       Request{UpdateTXT: true, TXT: "token-value"},
+			wantCalls: []string{"update _acme-challenge.home.example.com token-value"},
+			wantTypes: []string{provider.RecordTypeTXT},
+		},
+		{
+			name:      "clear acme txt",
+			req:       Request{UpdateTXT: true, Clear: true},
+			wantCalls: []string{"delete _acme-challenge.home.example.com"},
+			wantTypes: []string{provider.RecordTypeTXT},
+		},
+	}
+
+	m := NewDuckDNSMode(nil).(*DuckDNSMode)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &fakeProvider{}
+			if _, err := m.updateHost(p, &config.UserConfig{}, &tt.req, "home.example.com"); err != nil {
+				t.Fatalf("updateHost() error = %v", err)
+			}
+			if !reflect.DeepEqual(p.calls, tt.wantCalls) {
+				t.Fatalf("provider calls = %v, want %v", p.calls, tt.wantCalls)
+			}
+			var types []string
+			for _, o := range p.opts {
+				types = append(types, o.Type)
+			}
+			if !reflect.DeepEqual(types, tt.wantTypes) {
+				t.Fatalf("record types = %v, want %v", types, tt.wantTypes)
+			}
+		})
+	}
+}
@@ -1,18 +1,28 @@
 package mode
 
 import (
-	"log"
+	"crypto/subtle"
 	"net"
 	"net/http"
+	"strings"
 
 	"github.com/NewFuture/CloudDDNS/pkg/config"
 	"github.com/NewFuture/CloudDDNS/pkg/provider"
 )
 
+// maxHostsPerRequest caps the DynDNS2 hostname list, matching the limit
+// clients expect before they receive numhost.
+const maxHostsPerRequest = 20
+
 // Prepare extracts credentials, domain and IP info from the HTTP request.
 func (m *DynMode) Prepare(r *http.Request) (*Request, Outcome) {
 	q := r.URL.Query()
 
+	if config.Current().Server.RequireUserAgent && strings.TrimSpace(r.UserAgent()) == "" {
+		m.logger.Warn("Rejected request without User-Agent", "remote", r.RemoteAddr)
+		return &Request{}, OutcomeBadAgent
+	}
+
 	headerUser, headerPass, basicAuthProvided := r.BasicAuth()
 	queryUser := getQueryParam(q, "user", "username", "usr", "name")
 	queryPass := getQueryParam(q, "pass", "password", "pwd", "pw")
@@ -20,81 +30,194 @@ func (m *DynMode) Prepare(r *http.Request) (*Request, Outcome) {
 	username := preferValue(headerUser, queryUser)
 	password := preferValue(headerPass, queryPass)
 
-	// Domain aliases: domn/domain/hostname/host (standard), id (DtDNS), host_id (EasyDNS).
-	domain := getQueryParam(q, "domn", "domain", "hostname", "host", "id", "host_id")
-	ip := getQueryParam(q, "addr", "myip", "ip")
+	domain := getQueryParam(q, m.hostParams...)
+	ip := getQueryParam(q, m.ipParams...)
 	reqcStr := getQueryParam(q, "reqc")
 	reqc, err := parseReqc(reqcStr)
 	if err != nil {
-		log.Printf("Invalid reqc value %q: %v", reqcStr, err)
+		m.logger.Warn("Invalid reqc value", "reqc", reqcStr, "error", err)
 		return &Request{Reqc: 0}, OutcomeSystemError
 	}
 
 	resolvedIP, err := resolveRequestIP(reqc, ip, r.RemoteAddr)
 	if err != nil {
-		log.Printf("Invalid RemoteAddr format: %q, error: %v", r.RemoteAddr, err)
+		m.logger.Error("Invalid RemoteAddr format", "remote", r.RemoteAddr, "error", err)
 		return &Request{Reqc: reqc}, OutcomeSystemError
 	}
 
 	if net.ParseIP(resolvedIP) == nil {
-		log.Printf("Invalid IP address: %q", resolvedIP)
+		m.logger.Warn("Invalid IP address", "ip", resolvedIP)
 		return &Request{Reqc: reqc}, OutcomeSystemError
 	}
 
-	if domain == "" || len(domain) < 3 || len(domain) > 253 {
-		log.Printf("Invalid domain: %q", domain)
+	domains, err := parseHostnames(domain)
+	if err != nil {
+		m.logger.Warn("Invalid domain", "domain", domain, "error", err)
 		return &Request{Reqc: reqc}, OutcomeInvalidDomain
 	}
+	if len(domains) > maxHostsPerRequest {
+		m.logger.Warn("Too many hostnames in request", "hosts", len(domains), "max", maxHostsPerRequest)
+		return &Request{Reqc: reqc}, OutcomeTooManyHosts
+	}
 
 	req := &Request{
 		Username:   username,
 		Password:   password,
-		Domain:     domain,
+		Domain:     domains[0],
+		Domains:    domains,
 		IP:         resolvedIP,
 		Reqc:       reqc,
 		RemoteAddr: r.RemoteAddr,
 	}
 
-	m.debugLogf("Credential source basicAuth=%t headerProvided=%t queryProvided=%t", basicAuthProvided, headerUser != "", queryUser != "")
-	m.debugLogf("Prepared DDNS Request domain=%s ip=%s reqc=%d numeric=%t remote=%s", domain, resolvedIP, reqc, m.numericResponse, r.RemoteAddr)
+	m.logger.Debug("Credential source", "basic_auth", basicAuthProvided, "header", headerUser != "", "query", queryUser != "")
+	m.logger.Debug("Prepared DDNS request", "domain", req.DisplayDomain(), "hosts", len(domains), "ip", resolvedIP, "reqc", reqc, "numeric", m.numericResponse, "remote", r.RemoteAddr)
 	return req, OutcomeSuccess
 }
 
 // Process authenticates the user and executes the provider update.
 func (m *DynMode) Process(req *Request) Outcome {
-	if isDebugMode() && req.Username == "debug" && req.Password == "debug" {
-		m.debugLogf("Debug bypass for domain=%s ip=%s", req.Domain, req.IP)
+	if m.debugBypass(req) {
 		return OutcomeSuccess
 	}
 
+	u, p, outcome := m.authorizeHostKey(req)
+	if u == nil && outcome == OutcomeSuccess {
+		u, p, outcome = m.authorize(req)
+	}
+	if outcome != OutcomeSuccess {
+		return outcome
+	}
+	return m.update(req, u, p)
+}
+
+// processByHost is Process for protocols that may send only a hostname and
+// password (DtDNS, Namecheap): without a username or host key the account is
+// resolved from the hostname, which also authenticates it, and updated
+// directly rather than authenticated a second time by Process.
+func (m *DynMode) processByHost(req *Request, protocol string) Outcome {
+	if req.Username != "" || hasHostKey(req.Domain) {
+		return m.Process(req)
+	}
+	u, outcome := m.resolveUserByHost(req, protocol)
+	if outcome != OutcomeSuccess {
+		return outcome
+	}
+	u, p, outcome := m.initProvider(req, u)
+	if outcome != OutcomeSuccess {
+		return outcome
+	}
+	return m.update(req, u, p)
+}
+
+// update writes every requested host for an authorized user and summarizes
+// the per-host results.
+func (m *DynMode) update(req *Request, u *config.UserConfig, p provider.Provider) Outcome {
+	req.Results = updateHosts(m.logger, p, u, req.Domains, req.IP, req.Reqc)
+	return summarizeResults(req.Results)
+}
+
+// debugBypass reports success for every host of a debug/debug request when
+// debug mode is enabled, without touching the provider.
+func (m *DynMode) debugBypass(req *Request) bool {
+	if !isDebugMode() || req.Username != "debug" || req.Password != "debug" {
+		return false
+	}
+	m.logger.Debug("Debug bypass", "domain", req.DisplayDomain(), "ip", req.IP)
+	req.Results = make([]HostResult, len(req.Domains))
+	for i, domain := range req.Domains {
+		req.Results[i] = HostResult{Domain: domain, Outcome: OutcomeSuccess}
+	}
+	return true
+}
+
+// authorizeHostKey authenticates Hurricane Electric style requests, where the
+// username is the hostname itself (or absent) and the password is that host's
+// update key. It returns a nil user and OutcomeSuccess when the request is not
+// a host key request, so account authentication can proceed.
+func (m *DynMode) authorizeHostKey(req *Request) (*config.UserConfig, provider.Provider, Outcome) {
+	if len(req.Domains) != 1 {
+		return nil, nil, OutcomeSuccess
+	}
+	if req.Username != "" {
+		if name, err := normalizeHostname(req.Username); err != nil || name != req.Domain {
+			return nil, nil, OutcomeSuccess
+		}
+	}
+	u, key := config.LookupHostKey(req.Domain)
+	if u == nil {
+		return nil, nil, OutcomeSuccess
+	}
+	// A host key is a plain shared secret: the owner's password_schemes and
+	// encodings do not apply to it.
+	if subtle.ConstantTimeCompare([]byte(key), []byte(req.Password)) != 1 {
+		m.logger.Warn("Host key authentication failed", "domain", req.DisplayDomain())
+		return nil, nil, OutcomeAuthFailure
+	}
+	m.logger.Debug("Host key authentication succeeded", "domain", req.DisplayDomain(), "user", u.Username)
+	req.Username = u.Username
+	return m.initProvider(req, u)
+}
+
+// hasHostKey reports whether domain has a per-host update key configured.
+func hasHostKey(domain string) bool {
+	u, _ := config.LookupHostKey(domain)
+	return u != nil
+}
+
+// authorize authenticates the request and initializes the user's provider.
+func (m *DynMode) authorize(req *Request) (*config.UserConfig, provider.Provider, Outcome) {
 	u := config.GetUser(req.Username)
-	if u == nil || !verifyPassword(u.Password, req.Password) {
-		log.Printf("Authentication failed for user: %q", req.Username)
-		m.debugLogf("DDNS mode authentication failed for user=%s", req.Username)
-		return OutcomeAuthFailure
+	if u == nil || !authenticateUser(m.logger, u, req.Password) {
+		m.logger.Warn("Authentication failed", "user", req.Username)
+		return nil, nil, OutcomeAuthFailure
+	}
+	m.logger.Debug("Authentication succeeded", "user", req.Username)
+	return m.initProvider(req, u)
+}
+
+// initProvider rejects blocked users and initializes the provider of an
+// authenticated user.
+func (m *DynMode) initProvider(req *Request, u *config.UserConfig) (*config.UserConfig, provider.Provider, Outcome) {
+	if u.Blocked {
+		m.logger.Warn("Blocked user attempted an update", "user", req.Username)
+		return nil, nil, OutcomeAbuse
 	}
-	m.debugLogf("DDNS mode authentication succeeded for user=%s", req.Username)
 
 	p, err := provider.GetProvider(u)
 	if err != nil {
-		log.Printf("Provider error for user %q: %v", req.Username, err)
-		m.debugLogf("DDNS mode provider init failed for user=%s provider=%s error=%v", req.Username, u.Provider, err)
-		return OutcomeSystemError
+		m.logger.Error("Provider init failed", "user", req.Username, "provider", u.Provider, "error", err)
+		return nil, nil, OutcomeSystemError
 	}
-	m.debugLogf("DDNS mode provider initialized for user=%s provider=%s", req.Username, u.Provider)
+	m.logger.Debug("Provider initialized", "user", req.Username, "provider", u.Provider)
+	return u, p, OutcomeSuccess
+}
 
-	if err := p.UpdateRecord(req.Domain, req.IP); err != nil {
-		log.Printf("UpdateRecord error for domain %q and ip %q: %v", req.Domain, req.IP, err)
-		m.debugLogf("DDNS mode DNS update failed for domain=%s ip=%s error=%v", req.Domain, req.IP, err)
-		return OutcomeSystemError
+// resolveUserByHost finds the account for protocols that send only a
+// hostname and password (DtDNS, Namecheap): the first user whose owned_hosts
+// patterns match the hostname and whose password verifies is returned, and
+// req.Username is filled in. A hostname no user owns gets the same
+// authentication failure as a wrong password, so the reply does not reveal
+// which hostnames exist.
+func (m *DynMode) resolveUserByHost(req *Request, protocol string) (*config.UserConfig, Outcome) {
+	users := config.GetUsersByHost(req.Domain)
+	if len(users) == 0 {
+		m.logger.Warn("Host does not match any user", "protocol", protocol, "domain", req.DisplayDomain())
+		return nil, OutcomeAuthFailure
 	}
-
-	log.Printf("Successfully updated %s to %s", req.Domain, req.IP)
-	m.debugLogf("DDNS mode DNS update succeeded for domain=%s ip=%s", req.Domain, req.IP)
-	return OutcomeSuccess
+	for _, u := range users {
+		if authenticateUser(m.logger, u, req.Password) {
+			req.Username = u.Username
+			m.logger.Debug("Host resolved to user", "protocol", protocol, "domain", req.DisplayDomain(), "user", req.Username)
+			return u, OutcomeSuccess
+		}
+	}
+	m.logger.Warn("Authentication failed for host", "protocol", protocol, "domain", req.DisplayDomain())
+	return nil, OutcomeAuthFailure
 }
 
-// Respond writes protocol-specific responses.
+// Respond writes protocol-specific responses. Textual DynDNS2 responses carry
+// one result line per requested hostname, in request order.
 func (m *DynMode) Respond(w http.ResponseWriter, req *Request, outcome Outcome) {
 	reqc := 0
 	if req != nil {
@@ -102,8 +225,20 @@ func (m *DynMode) Respond(w http.ResponseWriter, req *Request, outcome Outcome)
 	}
 
 	var body string
+	if !m.numericResponse && req != nil && len(req.Results) > 0 {
+		lines := make([]string, len(req.Results))
+		for i, r := range req.Results {
+			lines[i] = dynResultLine(r.Outcome, req.IP)
+		}
+		body = strings.Join(lines, "\n")
+		if _, err := w.Write([]byte(body)); err != nil {
+			m.logger.Error("HTTP write error", "error", err)
+		}
+		return
+	}
+
 	switch outcome {
-	case OutcomeSuccess:
+	case OutcomeSuccess, OutcomeNoChange:
 		if m.numericResponse {
 			if reqc == 1 {
 				body = "2"
@@ -111,33 +246,76 @@ func (m *DynMode) Respond(w http.ResponseWriter, req *Request, outcome Outcome)
 				body = "0"
 			}
 		} else {
-			if req != nil && req.IP != "" {
-				body = "good " + req.IP
-			} else {
-				body = "good"
+			ip := ""
+			if req != nil {
+				ip = req.IP
 			}
-		}
-	case OutcomeAuthFailure:
-		if m.numericResponse {
-			body = "1"
-		} else {
-			body = "badauth"
-		}
-	case OutcomeInvalidDomain:
-		if m.numericResponse {
-			body = "1"
-		} else {
-			body = "notfqdn"
+			body = dynResultLine(outcome, ip)
 		}
 	default:
 		if m.numericResponse {
 			body = "1"
 		} else {
-			body = "911"
+			body = dynResultLine(outcome, "")
 		}
 	}
 
 	if _, err := w.Write([]byte(body)); err != nil {
-		log.Printf("HTTP Write Error: %v", err)
+		m.logger.Error("HTTP write error", "error", err)
+	}
+}
+
+// dynResultLine renders a single DynDNS2 return code.
+func dynResultLine(outcome Outcome, ip string) string {
+	var code string
+	switch outcome {
+	case OutcomeSuccess:
+		code = "good"
+	case OutcomeNoChange:
+		code = "nochg"
+	case OutcomeAuthFailure:
+		return "badauth"
+	case OutcomeInvalidDomain:
+		return "notfqdn"
+	case OutcomeNoHost:
+		return "nohost"
+	case OutcomeTooManyHosts:
+		return "numhost"
+	case OutcomeAbuse:
+		return "abuse"
+	case OutcomeBadAgent:
+		return "badagent"
+	case OutcomeDNSError:
+		return "dnserr"
+	case OutcomeNotDonator:
+		return "!donator"
+	case OutcomeBadSystem:
+		return "badsys"
+	default:
+		return "911"
+	}
+	if ip != "" {
+		return code + " " + ip
+	}
+	return code
+}
+
+// parseHostnames splits a comma-separated DynDNS2 hostname list and
+// normalizes each entry. Any invalid entry rejects the whole request.
+func parseHostnames(raw string) ([]string, error) {
+	var domains []string
+	for _, part := range strings.Split(raw, ",") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		domain, err := normalizeHostname(part)
+		if err != nil {
+			return nil, err
+		}
+		domains = append(domains, domain)
+	}
+	if len(domains) == 0 {
+		return nil, errNotFQDN
 	}
+	return domains, nil
 }
@@ -1,7 +1,7 @@
 package mode
 
 import (
-	"log"
+	"log/slog"
 	"net/http"
 )
 
@@ -13,17 +13,24 @@ type EasyDNSMode struct {
 	*DynMode
 }
 
-func NewEasyDNSMode(debug func(format string, args ...interface{})) Mode {
-	return &EasyDNSMode{DynMode: NewDynMode(false, debug)}
+func NewEasyDNSMode(logger *slog.Logger) Mode {
+	return &EasyDNSMode{DynMode: NewDynMode(false, logger)}
 }
 
 // Respond writes EasyDNS dynamic DNS result codes as plain-text responses.
 // It implements the EasyDNS API contract by mapping internal outcomes to
 // EasyDNS result strings (each terminated with a newline):
 //   - OutcomeSuccess       -> "NOERROR\n"
+//   - OutcomeNoChange      -> "NOERROR\n"
 //   - OutcomeAuthFailure   -> "NOACCESS\n"
+//   - OutcomeNoHost        -> "NOACCESS\n" (host not in the account)
+//   - OutcomeNotDonator    -> "NOACCESS\n"
 //   - OutcomeInvalidDomain -> "ILLEGAL INPUT\n"
+//   - OutcomeTooManyHosts  -> "ILLEGAL INPUT\n"
+//   - OutcomeBadAgent      -> "ILLEGAL INPUT\n"
+//   - OutcomeAbuse         -> "TOOSOON\n"
 //   - OutcomeSystemError   -> "NOSERVICE\n"
+//   - OutcomeDNSError      -> "NOSERVICE\n"
 //   - any other outcome    -> "NOSERVICE\n"
 //
 // For protocol details, see the EasyDNS dynamic DNS API documentation.
@@ -31,12 +38,14 @@ func NewEasyDNSMode(debug func(format string, args ...interface{})) Mode {
 func (m *EasyDNSMode) Respond(w http.ResponseWriter, req *Request, outcome Outcome) {
 	var body string
 	switch outcome {
-	case OutcomeSuccess:
+	case OutcomeSuccess, OutcomeNoChange:
 		body = "NOERROR\n"
-	case OutcomeAuthFailure:
+	case OutcomeAuthFailure, OutcomeNoHost, OutcomeNotDonator:
 		body = "NOACCESS\n"
-	case OutcomeInvalidDomain:
+	case OutcomeInvalidDomain, OutcomeTooManyHosts, OutcomeBadAgent:
 		body = "ILLEGAL INPUT\n"
+	case OutcomeAbuse:
+		body = "TOOSOON\n"
 	case OutcomeSystemError:
 		body = "NOSERVICE\n"
 	default:
@@ -44,6 +53,6 @@ func (m *EasyDNSMode) Respond(w http.ResponseWriter, req *Request, outcome Outco
 	}
 
 	if _, err := w.Write([]byte(body)); err != nil {
-		log.Printf("Failed to write EasyDNS response %q: %v", body, err)
+		m.logger.Error("Failed to write EasyDNS response", "body", body, "error", err)
 	}
 }
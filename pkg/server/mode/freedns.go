@@ -0,0 +1,155 @@
+package mode
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/NewFuture/CloudDDNS/pkg/config"
+	"github.com/NewFuture/CloudDDNS/pkg/provider"
+	"github.com/NewFuture/CloudDDNS/pkg/state"
+)
+
+// FreeDNSV2Prefix is the path prefix of the afraid.org v2 update form
+// (/u/<token>/); the legacy form is /dynamic/update.php?<token>.
+const FreeDNSV2Prefix = "/u/"
+
+// FreeDNSMode implements the afraid.org FreeDNS update protocol. A random
+// token issued per host (see the freedns-token command) selects both the user
+// and the hostname, so clients send no credentials. Replies are the plain
+// text sentences FreeDNS clients log.
+type FreeDNSMode struct {
+	logger  *slog.Logger
+	started time.Time
+}
+
+func NewFreeDNSMode(logger *slog.Logger) Mode {
+	return &FreeDNSMode{logger: loggerOrDefault(logger)}
+}
+
+// Prepare extracts the token from the path or bare query key and resolves the
+// address from address/ip or the source address.
+func (m *FreeDNSMode) Prepare(r *http.Request) (*Request, Outcome) {
+	m.started = time.Now()
+	q := r.URL.Query()
+	req := &Request{Password: freeDNSToken(r), RemoteAddr: r.RemoteAddr}
+	if req.Password == "" {
+		m.logger.Warn("FreeDNS request without token", "remote", r.RemoteAddr)
+		return req, OutcomeAuthFailure
+	}
+
+	ip, err := resolveRequestIP(0, getQueryParam(q, "address", "ip"), r.RemoteAddr)
+	if err != nil {
+		m.logger.Error("Invalid RemoteAddr format", "remote", r.RemoteAddr, "error", err)
+		return req, OutcomeSystemError
+	}
+	if net.ParseIP(ip) == nil {
+		m.logger.Warn("Invalid IP address", "ip", ip)
+		return req, OutcomeSystemError
+	}
+	req.IP = ip
+
+	m.logger.Debug("Prepared FreeDNS request", "ip", req.IP, "remote", r.RemoteAddr)
+	return req, OutcomeSuccess
+}
+
+// freeDNSToken returns the token from /u/<token>/ or from the first query
+// key that carries no value, as in /dynamic/update.php?<token>&address=.
+func freeDNSToken(r *http.Request) string {
+	if strings.HasPrefix(r.URL.Path, FreeDNSV2Prefix) {
+		token, _, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, FreeDNSV2Prefix), "/")
+		return token
+	}
+	for _, part := range strings.Split(r.URL.RawQuery, "&") {
+		if part != "" && !strings.Contains(part, "=") {
+			return part
+		}
+	}
+	return getQueryParam(r.URL.Query(), "token")
+}
+
+// Process maps the token to its user and host and updates the host record.
+func (m *FreeDNSMode) Process(req *Request) Outcome {
+	if isDebugMode() && req.Password == "debug" {
+		req.Domain = "debug"
+		m.logger.Debug("FreeDNS debug bypass", "ip", req.IP)
+		return OutcomeSuccess
+	}
+
+	store := state.Default()
+	if store == nil {
+		m.logger.Error("FreeDNS request rejected: state store not initialized")
+		return OutcomeSystemError
+	}
+	entry, ok := store.LookupFreeDNSToken(req.Password)
+	if !ok {
+		m.logger.Warn("FreeDNS authentication failed: unknown token")
+		return OutcomeAuthFailure
+	}
+	req.Username = entry.Username
+	req.Domain = entry.Host
+	req.Domains = []string{entry.Host}
+
+	u := config.GetUser(entry.Username)
+	if u == nil {
+		m.logger.Warn("FreeDNS token refers to unknown user", "user", entry.Username)
+		return OutcomeAuthFailure
+	}
+	if u.Blocked {
+		m.logger.Warn("Blocked user attempted a FreeDNS update", "user", u.Username)
+		return OutcomeAbuse
+	}
+
+	p, err := provider.GetProvider(u)
+	if err != nil {
+		m.logger.Error("Provider init failed", "user", u.Username, "provider", u.Provider, "error", err)
+		return OutcomeSystemError
+	}
+	changed, err := applyUpdate(p, u, req.Domain, req.IP, 0)
+	if err != nil {
+		m.logger.Error("FreeDNS update failed", "domain", req.DisplayDomain(), "error", err)
+		return outcomeForError(err)
+	}
+	if !changed {
+		return OutcomeNoChange
+	}
+	m.logger.Info("DNS record updated", "domain", req.DisplayDomain(), "ip", req.IP, "user", u.Username)
+	return OutcomeSuccess
+}
+
+// Respond writes the FreeDNS reply sentence for the outcome.
+func (m *FreeDNSMode) Respond(w http.ResponseWriter, req *Request, outcome Outcome) {
+	host, ip := "", ""
+	if req != nil {
+		host, ip = req.DisplayDomain(), req.IP
+	}
+
+	var body string
+	switch outcome {
+	case OutcomeSuccess:
+		body = fmt.Sprintf("Updated %s to %s in %.3f seconds", host, ip, time.Since(m.started).Seconds())
+	case OutcomeNoChange:
+		body = fmt.Sprintf("No IP change detected for %s with IP %s, skipping update", host, ip)
+	case OutcomeAuthFailure:
+		body = "ERROR: Unable to locate this record"
+	case OutcomeAbuse:
+		body = fmt.Sprintf("ERROR: Host %s has been blocked", host)
+	case OutcomeNoHost, OutcomeNotDonator:
+		body = fmt.Sprintf("ERROR: Host %s cannot be updated by this account", host)
+	case OutcomeSystemError:
+		if ip == "" {
+			body = "ERROR: Invalid address"
+			break
+		}
+		fallthrough
+	default:
+		body = fmt.Sprintf("ERROR: Unable to update %s, please try again later", host)
+	}
+
+	if _, err := w.Write([]byte(body)); err != nil {
+		m.logger.Error("HTTP write error", "error", err)
+	}
+}
@@ -0,0 +1,162 @@
+package mode
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/NewFuture/CloudDDNS/pkg/config"
+)
+
+// maxPendingChallenges caps the challenges kept in memory so unauthenticated
+// handshake requests cannot grow the store without bound, and
+// maxClientChallenges caps those issued to one source address so a single
+// client replaces its own oldest challenge instead of filling the store.
+const (
+	maxPendingChallenges = 10000
+	maxClientChallenges  = 16
+)
+
+var (
+	errChallengeUnknown = errors.New("challenge was not issued or was already used")
+	errChallengeExpired = errors.New("challenge expired")
+	errChallengeTime    = errors.New("challenge time does not match")
+	errChallengeSign    = errors.New("challenge sign does not match")
+	errChallengesFull   = errors.New("too many pending challenges")
+)
+
+// gnuChallenge is a salt/time pair issued by the GnuDIP HTTP handshake page.
+type gnuChallenge struct {
+	user   string
+	client string // source address the handshake came from
+	time   int64
+	seq    uint64 // issue order; times tie within a second
+}
+
+// challengeStore remembers issued GnuDIP HTTP challenges so the second step
+// is only accepted once, for the user it was issued to, and within the
+// configured validity window.
+type challengeStore struct {
+	mu      sync.Mutex
+	entries map[string]gnuChallenge // keyed by salt
+	clients map[string]int          // pending challenges per source address
+	seq     uint64
+	now     func() time.Time
+}
+
+func newChallengeStore() *challengeStore {
+	return &challengeStore{entries: make(map[string]gnuChallenge), clients: make(map[string]int), now: time.Now}
+}
+
+// gnuChallenges is the process-wide store shared by GnuHTTPMode instances.
+var gnuChallenges = newChallengeStore()
+
+// gnuSignKey is the per-process key of challenge signs. Signs only prove that
+// the server issued a challenge; they never depend on a user's password, so
+// publishing them on the unauthenticated handshake page reveals nothing.
+var gnuSignKey = func() []byte {
+	key := make([]byte, 32)
+	_, _ = rand.Read(key) // crypto/rand.Read never returns an error
+	return key
+}()
+
+// gnuSign returns the HMAC-MD5 sign of a challenge issued to user.
+func gnuSign(user, salt string, issued int64) string {
+	mac := hmac.New(md5.New, gnuSignKey)
+	mac.Write([]byte(user + "\x00" + salt + "\x00" + strconv.FormatInt(issued, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// issue records a new challenge for user, requested from the source address
+// client, and returns its salt and time. A client at maxClientChallenges
+// loses its own oldest challenge; when the store is full of live challenges
+// from other clients, issue fails rather than evicting them.
+func (s *challengeStore) issue(user, client string) (string, int64, error) {
+	salt := generateSalt(10)
+	if salt == "" {
+		salt = fallbackSalt(10)
+	}
+	now := s.now().Unix()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.clients[client] >= maxClientChallenges {
+		oldest := ""
+		for k, c := range s.entries {
+			if c.client == client && (oldest == "" || c.seq < s.entries[oldest].seq) {
+				oldest = k
+			}
+		}
+		s.deleteLocked(oldest)
+	}
+	if len(s.entries) >= maxPendingChallenges {
+		s.purgeLocked(now)
+	}
+	if len(s.entries) >= maxPendingChallenges {
+		return "", 0, errChallengesFull
+	}
+	s.seq++
+	s.entries[salt] = gnuChallenge{user: user, client: client, time: now, seq: s.seq}
+	s.clients[client]++
+	return salt, now, nil
+}
+
+// consume validates and removes the challenge identified by salt. Only a
+// response naming the user, time and sign the challenge was issued with
+// removes it, so a captured URL cannot be replayed and a mismatched response
+// cannot destroy another user's pending challenge. sign may be empty.
+func (s *challengeStore) consume(user, salt, timeParam, sign string) error {
+	now := s.now().Unix()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.entries[salt]
+	if !ok || c.user != user {
+		return errChallengeUnknown
+	}
+	if timeParam != "" && timeParam != strconv.FormatInt(c.time, 10) {
+		return errChallengeTime
+	}
+	if sign != "" && !hmac.Equal([]byte(sign), []byte(gnuSign(user, salt, c.time))) {
+		return errChallengeSign
+	}
+	s.deleteLocked(salt)
+	if now > c.time+challengeWindow() {
+		return errChallengeExpired
+	}
+	return nil
+}
+
+// purgeLocked drops expired challenges; the caller holds s.mu.
+func (s *challengeStore) purgeLocked(now int64) {
+	window := challengeWindow()
+	for k, c := range s.entries {
+		if now > c.time+window {
+			s.deleteLocked(k)
+		}
+	}
+}
+
+// deleteLocked removes the challenge with salt; the caller holds s.mu.
+func (s *challengeStore) deleteLocked(salt string) {
+	c, ok := s.entries[salt]
+	if !ok {
+		return
+	}
+	delete(s.entries, salt)
+	if s.clients[c.client]--; s.clients[c.client] <= 0 {
+		delete(s.clients, c.client)
+	}
+}
+
+// challengeWindow returns how many seconds a challenge stays valid: the
+// configured TTL plus the allowed clock skew.
+func challengeWindow() int64 {
+	s := config.Current().Server
+	return int64((s.ChallengeTTL() + s.ClockSkew()) / time.Second)
+}
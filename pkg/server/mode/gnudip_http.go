@@ -1,28 +1,29 @@
 package mode
 
 import (
-	"crypto/md5"
 	"crypto/rand"
 	"fmt"
 	"html"
-	"log"
+	"log/slog"
 	"math/big"
+	"net"
 	"net/http"
-	"time"
 
 	"github.com/NewFuture/CloudDDNS/pkg/config"
 	"github.com/NewFuture/CloudDDNS/pkg/provider"
 )
 
 // GnuHTTPMode implements the two-step GnuDIP HTTP challenge flow.
-// Step 1: client requests without pass/sign -> server returns meta tags with retc/time/sign/addr.
-// Step 2: client requests with pass/sign (md5(user:time:secret)) -> server validates and updates.
+// Step 1: client requests without pass/sign -> server returns meta tags with salt/time/sign/addr.
+// Step 2: client echoes salt/time/sign with pass = md5(md5(password).salt) -> server validates and updates.
+// The sign is an opaque server-side HMAC over user, salt and time; it is never
+// accepted in place of the password.
 type GnuHTTPMode struct {
-	debugLogf func(format string, args ...interface{})
+	logger *slog.Logger
 }
 
-func NewGnuHTTPMode(debug func(format string, args ...interface{})) Mode {
-	return &GnuHTTPMode{debugLogf: debug}
+func NewGnuHTTPMode(logger *slog.Logger) Mode {
+	return &GnuHTTPMode{logger: loggerOrDefault(logger)}
 }
 
 func (m *GnuHTTPMode) Prepare(r *http.Request) (*Request, Outcome) {
@@ -40,11 +41,20 @@ func (m *GnuHTTPMode) Prepare(r *http.Request) (*Request, Outcome) {
 	// Check if any form of authentication is present (not just password)
 	authPresent := pass != "" || sign != ""
 
-	reqc := 0
+	reqcStr := GetQueryParam(q, "reqc")
+	reqc, err := parseReqc(reqcStr)
+	if err != nil {
+		m.logger.Warn("Invalid reqc value", "reqc", reqcStr, "error", err)
+		return &Request{Username: user, Password: pass, Sign: sign}, OutcomeSystemError
+	}
 	resolvedIP, err := resolveRequestIP(reqc, ip, r.RemoteAddr)
 	if err != nil {
-		log.Printf("Invalid RemoteAddr format: %q, error: %v", r.RemoteAddr, err)
-		return &Request{Reqc: reqc}, OutcomeSystemError
+		m.logger.Error("Invalid RemoteAddr format", "remote", r.RemoteAddr, "error", err)
+		return &Request{Username: user, Password: pass, Sign: sign, Reqc: reqc}, OutcomeSystemError
+	}
+	if net.ParseIP(resolvedIP) == nil {
+		m.logger.Warn("Invalid IP address", "ip", resolvedIP)
+		return &Request{Username: user, Password: pass, Sign: sign, Reqc: reqc}, OutcomeSystemError
 	}
 
 	req := &Request{
@@ -59,135 +69,164 @@ func (m *GnuHTTPMode) Prepare(r *http.Request) (*Request, Outcome) {
 		Sign:       sign,
 	}
 
-	// Skip domain validation when no authentication is present (handshake scenario)
-	// The Respond method will issue a challenge page in this case
-	if authPresent {
-		if domain == "" || len(domain) < 3 || len(domain) > 253 {
-			log.Printf("Invalid domain: %q", domain)
-			return req, OutcomeInvalidDomain
-		}
-	}
-
-	logMsg := "GnuHTTP prepare user=%s domain=%s ip=%s time=%s remote=%s"
+	// Without authentication this is the handshake step: skip domain validation
+	// and Process, and let Respond issue a challenge page.
 	if !authPresent {
-		logMsg = "GnuHTTP handshake prepare user=%s domain=%s ip=%s time=%s remote=%s"
+		m.logger.Debug("Prepared GnuHTTP handshake", "user", user, "ip", resolvedIP, "reqc", reqc, "remote", r.RemoteAddr)
+		return req, OutcomeChallenge
+	}
+	normalized, err := normalizeHostname(domain)
+	if err != nil {
+		m.logger.Warn("Invalid domain", "domain", domain, "error", err)
+		return req, OutcomeInvalidDomain
 	}
-	m.debugLogf(logMsg, user, domain, resolvedIP, timeParam, r.RemoteAddr)
+	req.Domain = normalized
+
+	m.logger.Debug("Prepared GnuHTTP request", "user", user, "domain", req.DisplayDomain(),
+		"ip", resolvedIP, "reqc", reqc, "time", timeParam, "remote", r.RemoteAddr)
 	return req, OutcomeSuccess
 }
 
 func (m *GnuHTTPMode) Process(req *Request) Outcome {
 	if isDebugMode() && req.Username == "debug" && req.Password == "debug" {
-		m.debugLogf("GnuHTTP debug bypass for domain=%s ip=%s", req.Domain, req.IP)
+		m.logger.Debug("GnuHTTP debug bypass", "domain", req.DisplayDomain(), "ip", req.IP)
 		return OutcomeSuccess
 	}
 
 	u := config.GetUser(req.Username)
 	if u == nil {
-		log.Printf("Authentication failed for user: %q", req.Username)
+		m.logger.Warn("Authentication failed", "user", req.Username)
 		return OutcomeAuthFailure
 	}
 
-	// Two-step flow: if no authentication provided (password and sign both empty), defer to Respond to issue challenge.
-	// If sign is present without password, validation will fail because computing expected hash requires password.
-	if req.Password == "" && req.Sign == "" {
+	// Two-step flow: without a password Respond issues the challenge page; a
+	// sign alone never authenticates.
+	if req.Password == "" {
 		return OutcomeAuthFailure
 	}
 
-	if req.Salt != "" {
-		// Salt-based authentication may omit sign entirely; only enforce time when sign is present.
-		if req.Sign != "" && req.Time == "" {
+	// Challenge fields must belong to a challenge issued by Respond, unused and
+	// not expired, and the password must be md5(md5(password).salt) for it.
+	// Salt-based authentication may omit sign; when sent it must be the one
+	// issued with the challenge.
+	challenge := req.Salt != "" || req.Time != "" || req.Sign != ""
+	if challenge {
+		if !u.AllowsScheme(config.SchemeGnuDIP) {
+			m.logger.Warn("GnuDIP challenge authentication is not allowed", "user", req.Username)
 			return OutcomeAuthFailure
 		}
-		if req.Sign != "" {
-			expectedSign := fmt.Sprintf("%x", md5.Sum([]byte(fmt.Sprintf("%s:%s:%s", req.Username, req.Time, u.Password))))
-			if req.Sign != expectedSign {
-				return OutcomeAuthFailure
-			}
+		if req.Salt == "" {
+			m.logger.Warn("GnuHTTP challenge without salt rejected", "user", req.Username)
+			return OutcomeAuthFailure
 		}
-		inner := md5.Sum([]byte(u.Password))
-		expected := fmt.Sprintf("%x", md5.Sum([]byte(fmt.Sprintf("%x.%s", inner, req.Salt))))
-		if req.Password != expected {
+		if err := gnuChallenges.consume(req.Username, req.Salt, req.Time, req.Sign); err != nil {
+			m.logger.Warn("GnuHTTP challenge rejected", "user", req.Username, "error", err)
 			return OutcomeAuthFailure
 		}
-	} else {
-		if req.Time != "" || req.Sign != "" {
-			if req.Time == "" {
-				return OutcomeAuthFailure
-			}
-			expected := fmt.Sprintf("%x", md5.Sum([]byte(fmt.Sprintf("%s:%s:%s", req.Username, req.Time, u.Password))))
-			if req.Sign != "" && req.Sign != expected {
-				return OutcomeAuthFailure
-			}
-			if req.Password != expected {
-				return OutcomeAuthFailure
-			}
-		} else if !verifyPassword(u.Password, req.Password) {
+		if req.Password != gnuSaltedHash(u.GnuDIPPasswordMD5(), req.Salt) {
+			m.logger.Warn("Authentication failed", "user", req.Username)
 			return OutcomeAuthFailure
 		}
+		m.logger.Info("Password matched scheme", "user", req.Username, "scheme", config.SchemeGnuDIP)
+	} else if !authenticateUser(m.logger, u, req.Password) {
+		m.logger.Warn("Authentication failed", "user", req.Username)
+		return OutcomeAuthFailure
+	}
+
+	if u.Blocked {
+		m.logger.Warn("Blocked user attempted an update", "user", req.Username)
+		return OutcomeAbuse
 	}
 
 	p, err := provider.GetProvider(u)
 	if err != nil {
-		log.Printf("Provider error for user %q: %v", req.Username, err)
+		m.logger.Error("Provider init failed", "user", req.Username, "provider", u.Provider, "error", err)
 		return OutcomeSystemError
 	}
 
-	if err := p.UpdateRecord(req.Domain, req.IP); err != nil {
-		log.Printf("UpdateRecord error for domain %q and ip %q: %v", req.Domain, req.IP, err)
-		return OutcomeSystemError
+	changed, err := applyUpdate(p, u, req.Domain, req.IP, req.Reqc)
+	if err != nil {
+		m.logger.Error("DNS update failed", "domain", req.DisplayDomain(), "ip", req.IP, "error", err)
+		return outcomeForError(err)
 	}
 
-	log.Printf("Successfully updated %s to %s", req.Domain, req.IP)
+	if changed {
+		m.logger.Info("DNS record updated", "domain", req.DisplayDomain(), "ip", req.IP)
+	} else {
+		m.logger.Debug("DNS record unchanged", "domain", req.DisplayDomain(), "ip", req.IP)
+	}
 	return OutcomeSuccess
 }
 
 func (m *GnuHTTPMode) Respond(w http.ResponseWriter, req *Request, outcome Outcome) {
-	// If no authentication provided (password and sign both empty), issue challenge page.
-	// This handles the first step of the two-step GnuDIP authentication flow.
-	if req != nil && req.Password == "" && req.Sign == "" {
-		now := time.Now().Unix()
-		user := req.Username
-		salt := generateSalt(10)
-		if salt == "" {
-			salt = fallbackSalt(10)
-		}
+	// A handshake (no password or sign) gets a challenge page: the first step
+	// of the two-step GnuDIP authentication flow. Rejected handshakes fall
+	// through to the retc=1 result page.
+	if outcome == OutcomeChallenge && req != nil {
+		m.respondChallenge(w, req)
+		return
+	}
 
-		// Generate sign if user is known, otherwise use empty sign
-		sign := ""
-		u := config.GetUser(user)
-		if u != nil {
-			sign = fmt.Sprintf("%x", md5.Sum([]byte(fmt.Sprintf("%s:%d:%s", user, now, u.Password))))
-		}
+	// Update result page: retc carries the GnuDIP return code and, for
+	// auto-detected addresses (reqc=2), addr echoes the address that was set.
+	reqc, ip := 0, ""
+	if req != nil {
+		reqc, ip = req.Reqc, req.IP
+	}
+	retc := gnuReturnCode(outcome, reqc)
+	addrMeta := ""
+	if retc == "0" && reqc == 2 {
+		addrMeta = fmt.Sprintf("\n<meta name=\"addr\" content=\"%s\">", html.EscapeString(ip))
+	}
+	body := fmt.Sprintf(`<html><head>
+<meta name="retc" content="%s">%s
+</head><body></body></html>`, retc, addrMeta)
+
+	if _, err := w.Write([]byte(body)); err != nil {
+		m.logger.Error("HTTP write error", "error", err)
+	}
+}
+
+// respondChallenge issues a challenge for the handshake in req and writes
+// its salt, time, sign and addr meta tags. When no challenge can be issued the
+// handshake is answered with retc=1.
+func (m *GnuHTTPMode) respondChallenge(w http.ResponseWriter, req *Request) {
+	client, err := extractRemoteIP(req.RemoteAddr)
+	if err != nil {
+		client = req.RemoteAddr
+	}
+	salt, now, err := gnuChallenges.issue(req.Username, client)
+	if err != nil {
+		m.logger.Warn("GnuHTTP challenge not issued", "user", req.Username, "remote", req.RemoteAddr, "error", err)
+		m.Respond(w, req, OutcomeSystemError)
+		return
+	}
+	// Signed for every user, known or not, so the page does not reveal which
+	// accounts exist.
+	sign := gnuSign(req.Username, salt, now)
 
-		body := fmt.Sprintf(`<html><head>
+	body := fmt.Sprintf(`<html><head>
 <meta name="salt" content="%s">
 <meta name="time" content="%d">
 <meta name="sign" content="%s">
 <meta name="addr" content="%s">
 </head><body></body></html>`, html.EscapeString(salt), now, sign, html.EscapeString(req.IP))
-		if _, err := w.Write([]byte(body)); err != nil {
-			log.Printf("HTTP Write Error: %v", err)
-		}
-		return
+	if _, err := w.Write([]byte(body)); err != nil {
+		m.logger.Error("HTTP write error", "error", err)
 	}
+}
 
-	// Standard response mapping similar to DynDNS numeric
-	var body string
-	switch outcome {
-	case OutcomeSuccess:
-		body = "0"
-	case OutcomeAuthFailure:
-		body = "1"
-	case OutcomeInvalidDomain:
-		body = "1"
-	default:
-		body = "1"
+// gnuReturnCode maps an outcome to the GnuDIP return code shared by the TCP
+// and HTTP protocols: 0 for a successful update, 2 for a successful offline
+// request (reqc=1) and 1 for any failure.
+func gnuReturnCode(outcome Outcome, reqc int) string {
+	if outcome != OutcomeSuccess {
+		return "1"
 	}
-
-	if _, err := w.Write([]byte(body)); err != nil {
-		log.Printf("HTTP Write Error: %v", err)
+	if reqc == 1 {
+		return "2"
 	}
+	return "0"
 }
 
 func generateSalt(length int) string {
@@ -200,7 +239,7 @@ func generateSalt(length int) string {
 	for i := 0; i < length; i++ {
 		n, err := rand.Int(rand.Reader, max)
 		if err != nil {
-			log.Printf("crypto/rand failed generating salt: %v", err)
+			slog.Error("crypto/rand failed generating salt", "error", err)
 			return ""
 		}
 		buf[i] = charset[n.Int64()]
@@ -1,18 +1,22 @@
 package mode
 
 import (
+	"log/slog"
 	"net/http/httptest"
 	"net/url"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/NewFuture/CloudDDNS/pkg/config"
 )
 
 func TestGnuHTTPAllowsSaltWithoutSign(t *testing.T) {
-	originalConfig := config.GlobalConfig
-	defer func() { config.GlobalConfig = originalConfig }()
+	originalConfig := config.Current()
+	defer config.SetCurrent(originalConfig)
 
-	config.GlobalConfig = config.Config{
+	config.SetCurrent(&config.Config{
 		Users: []config.UserConfig{
 			{
 				Username: "debug",
@@ -20,10 +24,10 @@ func TestGnuHTTPAllowsSaltWithoutSign(t *testing.T) {
 				Provider: "",
 			},
 		},
-	}
+	})
 
-	salt := "Y7Bu3WOpEm"
-	const testTimeParam = "1700000000" // arbitrary timestamp for salt-based auth validation
+	salt, issued, _ := gnuChallenges.issue("debug", "192.0.2.1")
+	testTimeParam := strconv.FormatInt(issued, 10)
 	pass := ComputeTCPHash("debug", salt)
 
 	params := url.Values{}
@@ -37,7 +41,7 @@ func TestGnuHTTPAllowsSaltWithoutSign(t *testing.T) {
 	params.Set("addr", "1.2.3.4")
 
 	req := httptest.NewRequest("GET", "/cgi-bin/gdipupdt.cgi?"+params.Encode(), nil)
-	mode := NewGnuHTTPMode(t.Logf)
+	mode := NewGnuHTTPMode(slog.New(slog.NewTextHandler(t.Output(), nil)))
 
 	preparedReq, outcome := mode.Prepare(req)
 	if outcome != OutcomeSuccess {
@@ -48,4 +52,216 @@ func TestGnuHTTPAllowsSaltWithoutSign(t *testing.T) {
 	if processOutcome == OutcomeAuthFailure {
 		t.Fatalf("Process outcome should not be auth failure when sign is omitted, got %v", processOutcome)
 	}
+
+	// Replaying the same URL must fail: the challenge was consumed.
+	replayReq, _ := mode.Prepare(httptest.NewRequest("GET", "/cgi-bin/gdipupdt.cgi?"+params.Encode(), nil))
+	if outcome := mode.Process(replayReq); outcome != OutcomeAuthFailure {
+		t.Fatalf("replayed Process outcome = %v, want %v", outcome, OutcomeAuthFailure)
+	}
+}
+
+// TestGnuHTTPRejectsHandshakeSign replays the values published on the
+// unauthenticated handshake page: none of them may stand in for the password.
+func TestGnuHTTPRejectsHandshakeSign(t *testing.T) {
+	originalConfig := config.Current()
+	defer config.SetCurrent(originalConfig)
+	config.SetCurrent(&config.Config{Users: []config.UserConfig{{Username: "alice", Password: "s3cret"}}})
+
+	mode := NewGnuHTTPMode(slog.New(slog.NewTextHandler(t.Output(), nil)))
+	handshake := func() (salt, ts, sign string) {
+		req, outcome := mode.Prepare(httptest.NewRequest("GET", "/cgi-bin/gdipupdt.cgi?user=alice", nil))
+		w := httptest.NewRecorder()
+		mode.Respond(w, req, outcome)
+		body := w.Body.String()
+		meta := func(name string) string {
+			prefix := `<meta name="` + name + `" content="`
+			start := strings.Index(body, prefix) + len(prefix)
+			return body[start : start+strings.Index(body[start:], `"`)]
+		}
+		return meta("salt"), meta("time"), meta("sign")
+	}
+
+	tests := []struct {
+		name  string
+		query func(salt, ts, sign string) string
+		want  Outcome
+	}{
+		{name: "sign as password without salt", query: func(_, ts, sign string) string { return "time=" + ts + "&sign=" + sign + "&pass=" + sign }, want: OutcomeAuthFailure},
+		{name: "sign as password with salt", query: func(salt, ts, sign string) string {
+			return "salt=" + salt + "&time=" + ts + "&sign=" + sign + "&pass=" + sign
+		}, want: OutcomeAuthFailure},
+		{name: "sign only", query: func(salt, ts, sign string) string { return "salt=" + salt + "&time=" + ts + "&sign=" + sign }, want: OutcomeAuthFailure},
+		{name: "forged sign", query: func(salt, ts, _ string) string {
+			return "salt=" + salt + "&time=" + ts + "&sign=deadbeef&pass=" + ComputeTCPHash("s3cret", salt)
+		}, want: OutcomeAuthFailure},
+		// The real password hash passes authentication and reaches the
+		// (unconfigured) provider.
+		{name: "salted password", query: func(salt, ts, sign string) string {
+			return "salt=" + salt + "&time=" + ts + "&sign=" + sign + "&pass=" + ComputeTCPHash("s3cret", salt)
+		}, want: OutcomeSystemError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			salt, ts, sign := handshake()
+			req, outcome := mode.Prepare(httptest.NewRequest("GET", "/cgi-bin/gdipupdt.cgi?user=alice&domn=h.example.com&addr=1.2.3.4&"+tt.query(salt, ts, sign), nil))
+			if outcome != OutcomeSuccess {
+				t.Fatalf("Prepare outcome = %v", outcome)
+			}
+			if got := mode.Process(req); got != tt.want {
+				t.Fatalf("Process outcome = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGnuHTTPChallengeStore(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	store := newChallengeStore()
+	store.now = func() time.Time { return now }
+
+	window := config.DefaultChallengeTTL + config.DefaultClockSkew
+	tests := []struct {
+		name    string
+		user    string
+		salt    func(issued string) string
+		time    func(issued string) string
+		sign    string
+		advance time.Duration
+		wantErr error
+		// kept reports that the failed response must leave the challenge usable.
+		kept bool
+	}{
+		{name: "fresh challenge", user: "alice"},
+		{name: "missing salt", user: "alice", salt: func(string) string { return "" }, wantErr: errChallengeUnknown},
+		{name: "salt only", user: "alice", time: func(string) string { return "" }},
+		{name: "within clock skew", user: "alice", advance: window},
+		{name: "expired", user: "alice", advance: window + time.Second, wantErr: errChallengeExpired},
+		{name: "other user", user: "mallory", wantErr: errChallengeUnknown, kept: true},
+		{name: "unknown salt", user: "alice", salt: func(string) string { return "forged" }, wantErr: errChallengeUnknown},
+		{name: "time mismatch", user: "alice", time: func(string) string { return "1" }, wantErr: errChallengeTime, kept: true},
+		{name: "sign mismatch", user: "alice", sign: "forged", wantErr: errChallengeSign, kept: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now = time.Unix(1700000000, 0)
+			salt, issued, _ := store.issue("alice", "192.0.2.1")
+			ts := strconv.FormatInt(issued, 10)
+			gotSalt, gotTime := salt, ts
+			if tt.salt != nil {
+				gotSalt = tt.salt(ts)
+			}
+			if tt.time != nil {
+				gotTime = tt.time(ts)
+			}
+			now = now.Add(tt.advance)
+
+			if err := store.consume(tt.user, gotSalt, gotTime, tt.sign); err != tt.wantErr {
+				t.Fatalf("consume() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.kept {
+				if err := store.consume("alice", salt, ts, gnuSign("alice", salt, issued)); err != nil {
+					t.Fatalf("consume() after mismatched response error = %v, want nil", err)
+				}
+				return
+			}
+			// Otherwise a challenge looked up by its salt cannot be used again.
+			if tt.salt == nil {
+				if err := store.consume("alice", salt, ts, ""); err != errChallengeUnknown {
+					t.Fatalf("replayed consume() error = %v, want %v", err, errChallengeUnknown)
+				}
+			}
+		})
+	}
+}
+
+func TestGnuHTTPChallengeLimits(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	store := newChallengeStore()
+	store.now = func() time.Time { return now }
+
+	victim, _, err := store.issue("alice", "192.0.2.1")
+	if err != nil {
+		t.Fatalf("issue() error = %v", err)
+	}
+	var flood []string
+	for i := 0; i <= maxClientChallenges; i++ {
+		salt, _, err := store.issue("alice", "198.51.100.7")
+		if err != nil {
+			t.Fatalf("issue() error = %v", err)
+		}
+		flood = append(flood, salt)
+	}
+	if _, ok := store.entries[flood[0]]; ok {
+		t.Fatal("a client over its cap should lose its own oldest challenge")
+	}
+	if _, ok := store.entries[victim]; !ok {
+		t.Fatal("one client's flood evicted another client's challenge")
+	}
+
+	// A store full of live challenges refuses new ones instead of evicting.
+	for i := len(store.entries); i < maxPendingChallenges; i++ {
+		store.entries[strconv.Itoa(i)] = gnuChallenge{user: "bob", client: strconv.Itoa(i), time: now.Unix()}
+	}
+	if _, _, err := store.issue("carol", "203.0.113.9"); err != errChallengesFull {
+		t.Fatalf("issue() on a full store error = %v, want %v", err, errChallengesFull)
+	}
+	if _, ok := store.entries[victim]; !ok {
+		t.Fatal("a full store evicted a pending challenge")
+	}
+}
+
+func TestGnuHTTPRejectedHandshake(t *testing.T) {
+	mode := NewGnuHTTPMode(slog.New(slog.NewTextHandler(t.Output(), nil)))
+	req, outcome := mode.Prepare(httptest.NewRequest("GET", "/cgi-bin/gdipupdt.cgi?user=alice&reqc=9", nil))
+	w := httptest.NewRecorder()
+	mode.Respond(w, req, outcome)
+	if body := w.Body.String(); strings.Contains(body, `name="salt"`) || !strings.Contains(body, `<meta name="retc" content="1">`) {
+		t.Fatalf("handshake with invalid reqc: body = %q, want retc=1 without a challenge", body)
+	}
+}
+
+func TestGnuHTTPReqcResponses(t *testing.T) {
+	SetDebugMode(true)
+	defer SetDebugMode(false)
+
+	tests := []struct {
+		name     string
+		query    string
+		wantRetc string
+		wantAddr string
+	}{
+		{name: "explicit address", query: "reqc=0&addr=1.2.3.4", wantRetc: "0"},
+		{name: "offline", query: "reqc=1", wantRetc: "2"},
+		{name: "auto-detected address echoed", query: "reqc=2", wantRetc: "0", wantAddr: "192.0.2.10"},
+		{name: "invalid reqc", query: "reqc=9&addr=1.2.3.4", wantRetc: "1"},
+		{name: "invalid address", query: "reqc=0&addr=not-an-ip", wantRetc: "1"},
+	}
+
+	mode := NewGnuHTTPMode(slog.New(slog.NewTextHandler(t.Output(), nil)))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/cgi-bin/gdipupdt.cgi?user=debug&pass=debug&domn=debug.example.com&"+tt.query, nil)
+			r.RemoteAddr = "192.0.2.10:4567"
+			req, outcome := mode.Prepare(r)
+			if outcome == OutcomeSuccess {
+				outcome = mode.Process(req)
+			}
+			w := httptest.NewRecorder()
+			mode.Respond(w, req, outcome)
+
+			body := w.Body.String()
+			if want := `<meta name="retc" content="` + tt.wantRetc + `">`; !strings.Contains(body, want) {
+				t.Fatalf("body = %q, want %s", body, want)
+			}
+			hasAddr := strings.Contains(body, `<meta name="addr"`)
+			if tt.wantAddr == "" && hasAddr {
+				t.Fatalf("body = %q, want no addr meta", body)
+			}
+			if want := `<meta name="addr" content="` + tt.wantAddr + `">`; tt.wantAddr != "" && !strings.Contains(body, want) {
+				t.Fatalf("body = %q, want %s", body, want)
+			}
+		})
+	}
 }
@@ -3,80 +3,144 @@ package mode
 import (
 	"bufio"
 	"crypto/md5"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"net"
 	"strings"
 	"time"
 
 	"github.com/NewFuture/CloudDDNS/pkg/config"
+	"github.com/NewFuture/CloudDDNS/pkg/guard"
 	"github.com/NewFuture/CloudDDNS/pkg/provider"
 )
 
 // GnuTCPMode handles GnuDIP TCP protocol.
 type GnuTCPMode struct {
-	debugLogf func(format string, args ...interface{})
+	logger *slog.Logger
 }
 
-func NewGnuTCPMode(debug func(format string, args ...interface{})) *GnuTCPMode {
-	return &GnuTCPMode{debugLogf: debug}
+// NewGnuTCPMode returns a handler for one TCP session. Every request line is
+// summarized on logger, which should carry the session's request_id.
+func NewGnuTCPMode(logger *slog.Logger) *GnuTCPMode {
+	return &GnuTCPMode{logger: loggerOrDefault(logger)}
 }
 
 // ComputeTCPHash returns md5( md5(password) + "." + salt ) used by GnuDIP TCP clients.
 func ComputeTCPHash(password, salt string) string {
-	pwHash := fmt.Sprintf("%x", md5.Sum([]byte(password)))
-	return fmt.Sprintf("%x", md5.Sum([]byte(pwHash+"."+salt)))
+	return gnuSaltedHash(fmt.Sprintf("%x", md5.Sum([]byte(password))), salt)
 }
 
+// gnuSaltedHash returns md5( passwordMD5 + "." + salt ) from the hex MD5 of
+// the password, so users configured with only gnudip_md5 can authenticate.
+func gnuSaltedHash(passwordMD5, salt string) string {
+	return fmt.Sprintf("%x", md5.Sum([]byte(passwordMD5+"."+salt)))
+}
+
+// gnuTCPSuccess renders the success line for reqc: "0", "2" when offline, or
+// "0:<addr>" echoing the auto-detected address for reqc=2.
+func gnuTCPSuccess(reqc int, ip string) string {
+	if reqc == 2 {
+		return gnuReturnCode(OutcomeSuccess, reqc) + ":" + ip + "\n"
+	}
+	return gnuReturnCode(OutcomeSuccess, reqc) + "\n"
+}
+
+// gnuTCPQuit ends a session before the request cap or idle timeout is reached.
+const gnuTCPQuit = "quit"
+
+// Handle serves one GnuDIP TCP connection. A single salt is issued and the
+// client has server.tcp_handshake_timeout to send its first request. It may
+// then send up to server.gnudip_tcp_max_requests update lines, each answered
+// on its own line, until it sends "quit", goes idle for
+// server.gnudip_tcp_idle_timeout or sends a malformed line.
 func (m *GnuTCPMode) Handle(conn net.Conn) {
 	defer conn.Close()
-	conn.SetDeadline(time.Now().Add(30 * time.Second))
+	srv := config.Current().Server
+	maxRequests := srv.TCPMaxRequests()
+	idleTimeout := srv.TCPIdleTimeout()
+	handshakeTimeout := srv.HandshakeTimeout()
+	conn.SetDeadline(time.Now().Add(handshakeTimeout))
 
 	salt := generateSalt(10)
 	if salt == "" {
 		salt = fallbackSalt(10)
 	}
-	m.debugLogf("Generated salt %s for %s", salt, conn.RemoteAddr().String())
+	m.logger.Debug("Generated salt", "salt", salt, "remote", conn.RemoteAddr().String())
 	if _, err := conn.Write([]byte(salt + "\n")); err != nil {
-		log.Printf("TCP Write Error (salt): %v", err)
+		m.logger.Error("TCP write error (salt)", "error", err)
 		return
 	}
 
-	line, err := bufio.NewReader(conn).ReadString('\n')
-	if err != nil {
-		log.Printf("TCP Read Error: %v", err)
-		return
+	reader := bufio.NewReader(conn)
+	for served := 0; served < maxRequests; served++ {
+		if served > 0 {
+			conn.SetDeadline(time.Now().Add(idleTimeout))
+		}
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			if served == 0 || !errors.Is(err, io.EOF) {
+				m.logger.Warn("TCP read error", "error", err)
+			}
+			return
+		}
+		m.logger.Debug("Received raw TCP request", "line", redactTCPLine(line))
+		if strings.EqualFold(strings.TrimSpace(line), gnuTCPQuit) {
+			m.logger.Debug("TCP session closed by client", "requests", served)
+			return
+		}
+
+		start := time.Now()
+		req, outcome, ok := m.handleLine(conn, line, salt)
+		if !ok {
+			return
+		}
+		LogRequest(m.logger, ModeName(m), req, outcome, time.Since(start))
+		resp := "1\n"
+		if outcome == OutcomeSuccess || outcome == OutcomeNoChange {
+			resp = gnuTCPSuccess(req.Reqc, req.IP)
+		}
+		if _, err := conn.Write([]byte(resp)); err != nil {
+			m.logger.Error("TCP write error", "error", err)
+			return
+		}
 	}
-	m.debugLogf("Received raw TCP request: %q", line)
+	m.logger.Debug("TCP session reached request limit", "max", maxRequests)
+}
+
+// handleLine processes a single "user:hash:domain[:reqc[:addr]]" request and
+// returns the parsed request with its outcome. ok is false for a malformed
+// request, which ends the session without a reply.
+func (m *GnuTCPMode) handleLine(conn net.Conn, line, salt string) (req *Request, outcome Outcome, ok bool) {
 	parts := strings.Split(strings.TrimSpace(line), ":")
 
 	if len(parts) < 3 {
-		m.debugLogf("Invalid TCP request parts length: %d", len(parts))
-		return
+		m.logger.Warn("Invalid TCP request", "parts", len(parts))
+		return nil, OutcomeSystemError, false
 	}
 	user := parts[0]
+	req = &Request{Username: user, RemoteAddr: conn.RemoteAddr().String()}
 	clientHash := parts[1]
-	domain := parts[2]
 	reqcRaw := ""
 	if len(parts) > 3 {
 		reqcRaw = parts[3]
 	}
 	reqc, err := parseReqc(reqcRaw)
 	if err != nil {
-		log.Printf("Invalid reqc value %q: %v", reqcRaw, err)
-		if _, writeErr := conn.Write([]byte("1\n")); writeErr != nil {
-			log.Printf("TCP Write Error (invalid reqc): %v", writeErr)
-		}
-		return
+		m.logger.Warn("Invalid reqc value", "reqc", reqcRaw, "error", err)
+		return req, OutcomeSystemError, true
 	}
 
-	if domain == "" || len(domain) < 3 || len(domain) > 253 {
-		log.Printf("Invalid domain: %q", domain)
-		if _, err := conn.Write([]byte("1\n")); err != nil {
-			log.Printf("TCP Write Error (invalid domain): %v", err)
-		}
-		return
+	req.Reqc = reqc
+
+	domain, err := normalizeHostname(parts[2])
+	if err != nil {
+		m.logger.Warn("Invalid domain", "domain", parts[2], "error", err)
+		return req, OutcomeInvalidDomain, true
 	}
+	req.Domain = domain
+	display := displayHostname(domain)
 
 	providedIP := ""
 	if len(parts) > 4 {
@@ -85,82 +149,80 @@ func (m *GnuTCPMode) Handle(conn net.Conn) {
 
 	targetIP, err := resolveRequestIP(reqc, providedIP, conn.RemoteAddr().String())
 	if err != nil {
-		log.Printf("Failed to resolve target IP: %v", err)
-		if _, writeErr := conn.Write([]byte("1\n")); writeErr != nil {
-			log.Printf("TCP Write Error (resolve ip): %v", writeErr)
-		}
-		return
+		m.logger.Warn("Failed to resolve target IP", "error", err)
+		return req, OutcomeSystemError, true
 	}
-	m.debugLogf("TCP request parsed user=%s domain=%s targetIP=%s reqc=%d", user, domain, targetIP, reqc)
+	req.IP = targetIP
+	m.logger.Debug("Parsed TCP request", "user", user, "domain", display, "ip", targetIP, "reqc", reqc)
 
 	if net.ParseIP(targetIP) == nil {
-		log.Printf("Invalid IP address: %q", targetIP)
-		if _, err := conn.Write([]byte("1\n")); err != nil {
-			log.Printf("TCP Write Error (invalid IP): %v", err)
-		}
-		return
+		m.logger.Warn("Invalid IP address", "ip", targetIP)
+		return req, OutcomeSystemError, true
+	}
+
+	g := guard.Default()
+	sourceIP, _ := extractRemoteIP(conn.RemoteAddr().String())
+	if until, banned := g.Blocked(user, sourceIP); banned {
+		m.logger.Warn("Rejected update from banned client", "user", user, "ip", sourceIP, "until", until.Format(time.RFC3339))
+		return req, OutcomeAbuse, true
 	}
 
 	if isDebugMode() && user == "debug" {
 		expectedHash := ComputeTCPHash("debug", salt)
 		if clientHash != expectedHash {
-			m.debugLogf("Debug mode authentication failed expectedHash=%s clientHash=%s", expectedHash, clientHash)
-			if _, err := conn.Write([]byte("1\n")); err != nil {
-				log.Printf("TCP Write Error (debug auth failed): %v", err)
-			}
-			return
-		}
-		m.debugLogf("Debug mode bypass success for domain=%s ip=%s", domain, targetIP)
-		if _, err := conn.Write([]byte("0\n")); err != nil {
-			log.Printf("TCP Write Error (debug success): %v", err)
+			m.logger.Debug("Debug mode authentication failed", "expected_hash", RedactSecret(expectedHash), "client_hash", RedactSecret(clientHash))
+			g.Fail(user, sourceIP)
+			return req, OutcomeAuthFailure, true
 		}
-		return
+		m.logger.Debug("Debug bypass", "domain", display, "ip", targetIP)
+		return req, OutcomeSuccess, true
 	}
 
 	u := config.GetUser(user)
 	if u == nil {
-		m.debugLogf("User %q not found", user)
-		if _, err := conn.Write([]byte("1\n")); err != nil {
-			log.Printf("TCP Write Error (user not found): %v", err)
-		}
-		return
+		m.logger.Warn("Authentication failed: unknown user", "user", user)
+		g.Fail(user, sourceIP)
+		return req, OutcomeAuthFailure, true
 	}
 
-	expectedHash := ComputeTCPHash(u.Password, salt)
+	if !u.AllowsScheme(config.SchemeGnuDIP) {
+		m.logger.Warn("GnuDIP TCP authentication is not allowed", "user", user)
+		g.Fail(user, sourceIP)
+		return req, OutcomeAuthFailure, true
+	}
+	expectedHash := gnuSaltedHash(u.GnuDIPPasswordMD5(), salt)
 
 	if clientHash != expectedHash {
-		m.debugLogf("Authentication failed for user=%s expectedHash=%s clientHash=%s", user, expectedHash, clientHash)
-		if _, err := conn.Write([]byte("1\n")); err != nil {
-			log.Printf("TCP Write Error (auth failed): %v", err)
-		}
-		return
+		m.logger.Warn("Authentication failed", "user", user)
+		m.logger.Debug("Hash mismatch", "user", user, "expected_hash", RedactSecret(expectedHash), "client_hash", RedactSecret(clientHash))
+		g.Fail(user, sourceIP)
+		return req, OutcomeAuthFailure, true
+	}
+	m.logger.Info("Password matched scheme", "user", user, "scheme", config.SchemeGnuDIP)
+	g.Succeed(user, sourceIP)
+	if u.Blocked {
+		m.logger.Warn("Blocked user attempted an update", "user", user)
+		return req, OutcomeAbuse, true
 	}
-	m.debugLogf("Authentication succeeded for user=%s", user)
 
 	conn.SetDeadline(time.Now().Add(60 * time.Second))
 
 	p, err := provider.GetProvider(u)
 	if err != nil {
-		log.Printf("Provider Error: %v", err)
-		if _, writeErr := conn.Write([]byte("1\n")); writeErr != nil {
-			log.Printf("TCP Write Error (provider error): %v", writeErr)
-		}
-		return
+		m.logger.Error("Provider init failed", "user", user, "provider", u.Provider, "error", err)
+		return req, OutcomeSystemError, true
 	}
-	m.debugLogf("Provider initialized for user=%s provider=%s", user, u.Provider)
+	m.logger.Debug("Provider initialized", "user", user, "provider", u.Provider)
 
-	err = p.UpdateRecord(domain, targetIP)
+	changed, err := applyUpdate(p, u, domain, targetIP, reqc)
 	if err != nil {
-		log.Printf("Update Error: %v", err)
-		m.debugLogf("DNS update failed for domain=%s ip=%s error=%v", domain, targetIP, err)
-		if _, writeErr := conn.Write([]byte("1\n")); writeErr != nil {
-			log.Printf("TCP Write Error (update failed): %v", writeErr)
-		}
-	} else {
-		log.Printf("Success: %s -> %s", domain, targetIP)
-		m.debugLogf("DNS update succeeded for domain=%s ip=%s", domain, targetIP)
-		if _, writeErr := conn.Write([]byte("0\n")); writeErr != nil {
-			log.Printf("TCP Write Error (success response): %v", writeErr)
-		}
+		m.logger.Error("DNS update failed", "domain", display, "ip", targetIP, "error", err)
+		return req, outcomeForError(err), true
+	}
+	if !changed {
+		m.logger.Debug("DNS record unchanged", "domain", display, "ip", targetIP)
+		return req, OutcomeNoChange, true
 	}
+	m.logger.Info("DNS record updated", "domain", display, "ip", targetIP)
+	return req, OutcomeSuccess, true
 }
@@ -0,0 +1,80 @@
+package mode
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NewFuture/CloudDDNS/pkg/config"
+)
+
+func TestGnuTCPSession(t *testing.T) {
+	SetDebugMode(true)
+	defer SetDebugMode(false)
+	originalConfig := config.Current()
+	defer config.SetCurrent(originalConfig)
+
+	tests := []struct {
+		name        string
+		maxRequests int
+		idleTimeout int
+		handshake   int
+		lines       []string
+		want        []string
+	}{
+		{name: "single request by default", lines: []string{"0:1.2.3.4", "0:1.2.3.5"}, want: []string{"0"}},
+		{name: "several requests then quit", maxRequests: 5, lines: []string{"0:1.2.3.4", "1", "QUIT", "0:1.2.3.5"}, want: []string{"0", "2"}},
+		{name: "request cap closes session", maxRequests: 2, lines: []string{"0:1.2.3.4", "0:1.2.3.5", "0:1.2.3.6"}, want: []string{"0", "0"}},
+		{name: "failure keeps session open", maxRequests: 2, lines: []string{"9:1.2.3.4", "0:1.2.3.4"}, want: []string{"1", "0"}},
+		{name: "idle timeout closes session", maxRequests: 5, idleTimeout: 1, lines: []string{"0:1.2.3.4"}, want: []string{"0"}},
+		{name: "handshake timeout closes session", maxRequests: 5, handshake: 1, want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.SetCurrent(&config.Config{Server: config.ServerConfig{
+				GnuDIPTCPMaxRequests: tt.maxRequests,
+				GnuDIPTCPIdleTimeout: tt.idleTimeout,
+				TCPHandshakeTimeout:  tt.handshake,
+			}})
+			server, client := net.Pipe()
+			defer client.Close()
+			go NewGnuTCPMode(slog.New(slog.NewTextHandler(t.Output(), &slog.HandlerOptions{Level: slog.LevelDebug}))).Handle(server)
+			client.SetDeadline(time.Now().Add(5 * time.Second))
+
+			reader := bufio.NewReader(client)
+			salt, err := reader.ReadString('\n')
+			if err != nil {
+				t.Fatalf("read salt: %v", err)
+			}
+			hash := ComputeTCPHash("debug", strings.TrimSpace(salt))
+
+			var got []string
+			for _, line := range tt.lines {
+				request := line
+				if !strings.EqualFold(line, gnuTCPQuit) {
+					request = fmt.Sprintf("debug:%s:debug.example.com:%s", hash, line)
+				}
+				if _, err := client.Write([]byte(request + "\n")); err != nil {
+					break
+				}
+				resp, err := reader.ReadString('\n')
+				if err != nil {
+					break
+				}
+				got = append(got, strings.TrimSpace(resp))
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Fatalf("responses = %v, want %v", got, tt.want)
+			}
+			if _, err := reader.ReadString('\n'); err != io.EOF {
+				t.Fatalf("expected session to be closed, got err=%v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package mode
+
+import (
+	"errors"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// hostnameProfile maps Unicode hostnames to IDNA A-labels and validates every
+// label (STD3 characters, hyphen placement, bidi rules and DNS length limits).
+var hostnameProfile = idna.New(
+	idna.MapForLookup(),
+	idna.Transitional(false),
+	idna.BidiRule(),
+	idna.ValidateLabels(true),
+	idna.StrictDomainName(true),
+	idna.VerifyDNSLength(true),
+)
+
+var errNotFQDN = errors.New("hostname must contain at least two labels")
+
+// wildcardPrefix marks a wildcard hostname such as "*.example.com". Only a
+// single "*" as the leftmost label is accepted.
+const wildcardPrefix = "*."
+
+// normalizeHostname converts raw into its lower-case ASCII (punycode) form so
+// providers always receive A-labels. A single trailing dot is accepted, and a
+// leading "*." label is preserved for wildcard records.
+func normalizeHostname(raw string) (string, error) {
+	name := strings.TrimSuffix(strings.TrimSpace(raw), ".")
+	prefix := ""
+	if strings.HasPrefix(name, wildcardPrefix) {
+		prefix, name = wildcardPrefix, name[len(wildcardPrefix):]
+	}
+	if name == "" {
+		return "", errNotFQDN
+	}
+	ascii, err := hostnameProfile.ToASCII(name)
+	if err != nil {
+		return "", err
+	}
+	if !strings.Contains(ascii, ".") {
+		return "", errNotFQDN
+	}
+	return prefix + strings.ToLower(ascii), nil
+}
+
+// isWildcardHostname reports whether a normalized hostname targets a wildcard record.
+func isWildcardHostname(name string) bool {
+	return strings.HasPrefix(name, wildcardPrefix)
+}
+
+// displayHostname renders an ASCII hostname for logs and human-readable
+// responses, appending the Unicode form for internationalized names.
+func displayHostname(ascii string) string {
+	prefix, name := "", ascii
+	if isWildcardHostname(ascii) {
+		prefix, name = wildcardPrefix, ascii[len(wildcardPrefix):]
+	}
+	unicode, err := idna.ToUnicode(name)
+	if err != nil || unicode == name {
+		return ascii
+	}
+	return ascii + " (" + prefix + unicode + ")"
+}
+
+// NormalizeHostname is exported for reuse and testing.
+func NormalizeHostname(raw string) (string, error) { return normalizeHostname(raw) }
@@ -0,0 +1,61 @@
+package mode
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeHostname(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{name: "ascii", input: "cam.example.com", want: "cam.example.com"},
+		{name: "upper case and trailing dot", input: "Cam.Example.COM.", want: "cam.example.com"},
+		{name: "unicode", input: "摄像头.例子.中国", want: "xn--o1q97ryrj.xn--fsqu00a.xn--fiqs8s"},
+		{name: "full-width dot mapped", input: "摄像头。例子。中国", want: "xn--o1q97ryrj.xn--fsqu00a.xn--fiqs8s"},
+		{name: "punycode passthrough", input: "xn--fsqu00a.xn--fiqs8s", want: "xn--fsqu00a.xn--fiqs8s"},
+		{name: "wildcard", input: "*.Example.com", want: "*.example.com"},
+		{name: "unicode wildcard", input: "*.例子.中国", want: "*.xn--fsqu00a.xn--fiqs8s"},
+		{name: "wildcard on tld", input: "*.com", wantErr: true},
+		{name: "bare wildcard", input: "*", wantErr: true},
+		{name: "inner wildcard", input: "cam.*.example.com", wantErr: true},
+		{name: "partial wildcard label", input: "cam*.example.com", wantErr: true},
+		{name: "single label", input: "localhost", wantErr: true},
+		{name: "empty", input: "", wantErr: true},
+		{name: "leading hyphen", input: "-cam.example.com", wantErr: true},
+		{name: "underscore", input: "cam_1.example.com", wantErr: true},
+		{name: "space", input: "my cam.example.com", wantErr: true},
+		{name: "empty label", input: "cam..example.com", wantErr: true},
+		{name: "label too long", input: strings.Repeat("a", 64) + ".example.com", wantErr: true},
+		{name: "name too long", input: strings.Repeat("abcdefghi.", 26) + "com", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizeHostname(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("normalizeHostname(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("normalizeHostname(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDisplayHostname(t *testing.T) {
+	if got := displayHostname("cam.example.com"); got != "cam.example.com" {
+		t.Errorf("displayHostname(ascii) = %q", got)
+	}
+	want := "xn--o1q97ryrj.xn--fsqu00a.xn--fiqs8s (摄像头.例子.中国)"
+	if got := displayHostname("xn--o1q97ryrj.xn--fsqu00a.xn--fiqs8s"); got != want {
+		t.Errorf("displayHostname(idn) = %q, want %q", got, want)
+	}
+	want = "*.xn--fsqu00a.xn--fiqs8s (*.例子.中国)"
+	if got := displayHostname("*.xn--fsqu00a.xn--fiqs8s"); got != want {
+		t.Errorf("displayHostname(wildcard idn) = %q, want %q", got, want)
+	}
+}
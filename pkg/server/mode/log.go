@@ -0,0 +1,87 @@
+package mode
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+var outcomeNames = map[Outcome]string{
+	OutcomeSuccess:       "success",
+	OutcomeAuthFailure:   "auth_failure",
+	OutcomeInvalidDomain: "invalid_domain",
+	OutcomeSystemError:   "system_error",
+	OutcomeNoChange:      "no_change",
+	OutcomeNoHost:        "no_host",
+	OutcomeTooManyHosts:  "too_many_hosts",
+	OutcomeAbuse:         "abuse",
+	OutcomeBadAgent:      "bad_agent",
+	OutcomeDNSError:      "dns_error",
+	OutcomeNotDonator:    "not_donator",
+	OutcomeBadSystem:     "bad_system",
+	OutcomeChallenge:     "challenge",
+}
+
+// String returns the outcome name used in log fields.
+func (o Outcome) String() string {
+	if name, ok := outcomeNames[o]; ok {
+		return name
+	}
+	return fmt.Sprintf("outcome(%d)", int(o))
+}
+
+// loggerOrDefault returns logger, or slog.Default() for modes built without a
+// request logger.
+func loggerOrDefault(logger *slog.Logger) *slog.Logger {
+	if logger == nil {
+		return slog.Default()
+	}
+	return logger
+}
+
+// ModeName returns the short protocol name of a mode for log fields, e.g.
+// "dyn" for *DynMode and "gnuhttp" for *GnuHTTPMode.
+func ModeName(m any) string {
+	name := fmt.Sprintf("%T", m)
+	name = name[strings.LastIndex(name, ".")+1:]
+	return strings.ToLower(strings.TrimSuffix(name, "Mode"))
+}
+
+// LogRequest writes the summary record of one update request with the user,
+// domain (comma-separated for multi-host requests), ip, mode, outcome and
+// duration fields. Failed outcomes are logged as warnings, provider or
+// internal errors as errors, and GnuDIP challenge handshakes at debug level.
+func LogRequest(logger *slog.Logger, mode string, req *Request, outcome Outcome, elapsed time.Duration, attrs ...any) {
+	level := slog.LevelInfo
+	switch outcome {
+	case OutcomeSuccess, OutcomeNoChange:
+	case OutcomeChallenge:
+		level = slog.LevelDebug
+	case OutcomeSystemError, OutcomeDNSError:
+		level = slog.LevelError
+	default:
+		level = slog.LevelWarn
+	}
+	if req == nil {
+		req = &Request{}
+	}
+	domain := req.DisplayDomain()
+	if len(req.Domains) > 1 {
+		names := make([]string, len(req.Domains))
+		for i, d := range req.Domains {
+			names[i] = displayHostname(d)
+		}
+		domain = strings.Join(names, ",")
+	}
+	fields := append([]any{
+		"mode", mode,
+		"user", req.Username,
+		"domain", domain,
+		"ip", req.IP,
+		"outcome", outcome.String(),
+		"duration", elapsed,
+	}, attrs...)
+	logger.Log(context.Background(), level, "ddns request", fields...)
+}
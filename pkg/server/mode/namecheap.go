@@ -0,0 +1,135 @@
+package mode
+
+import (
+	"encoding/xml"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// NamecheapMode implements the Namecheap dynamic DNS protocol:
+// /update?host=<label>&domain=<zone>&password=<pass>&ip=<addr>. host "@" (or
+// empty) targets the zone apex and "*" the wildcard record. Namecheap clients
+// send no username, so the account is located through the users' owned_hosts
+// patterns (config.GetUsersByHost). Replies are the <interface-response> XML
+// document.
+type NamecheapMode struct {
+	*DynMode
+}
+
+func NewNamecheapMode(logger *slog.Logger) Mode {
+	return &NamecheapMode{DynMode: NewDynMode(false, logger)}
+}
+
+// Prepare joins host and domain into the FQDN and resolves the address.
+func (m *NamecheapMode) Prepare(r *http.Request) (*Request, Outcome) {
+	q := r.URL.Query()
+	req := &Request{
+		Password:   getQueryParam(q, "password"),
+		RemoteAddr: r.RemoteAddr,
+	}
+	ip, err := resolveRequestIP(0, getQueryParam(q, "ip"), r.RemoteAddr)
+	if err != nil {
+		m.logger.Error("Invalid RemoteAddr format", "remote", r.RemoteAddr, "error", err)
+		return req, OutcomeSystemError
+	}
+	req.IP = ip
+	if net.ParseIP(ip) == nil {
+		m.logger.Warn("Invalid IP address", "ip", ip)
+		return req, OutcomeSystemError
+	}
+
+	fqdn := namecheapHostname(getQueryParam(q, "host"), getQueryParam(q, "domain"))
+	domain, err := normalizeHostname(fqdn)
+	if err != nil {
+		m.logger.Warn("Invalid Namecheap host", "host", fqdn, "error", err)
+		return req, OutcomeInvalidDomain
+	}
+	req.Domain = domain
+	req.Domains = []string{domain}
+
+	m.logger.Debug("Prepared Namecheap request", "domain", req.DisplayDomain(), "ip", req.IP, "remote", r.RemoteAddr)
+	return req, OutcomeSuccess
+}
+
+// namecheapHostname joins a Namecheap host label with its domain; "@" and an
+// empty host mean the domain itself.
+func namecheapHostname(host, domain string) string {
+	host = strings.TrimSpace(host)
+	if host == "" || host == "@" {
+		return domain
+	}
+	return host + "." + domain
+}
+
+// Process locates the account by hostname when no username was sent and the
+// host has no update key, then performs the regular update. In debug mode the
+// password "debug" alone triggers the debug bypass.
+func (m *NamecheapMode) Process(req *Request) Outcome {
+	if req.Username == "" && isDebugMode() && req.Password == "debug" {
+		req.Username = "debug"
+	}
+	return m.processByHost(req, "Namecheap")
+}
+
+// namecheapResponse is the <interface-response> document Namecheap returns.
+type namecheapResponse struct {
+	XMLName       xml.Name         `xml:"interface-response"`
+	Command       string           `xml:"Command"`
+	Language      string           `xml:"Language"`
+	IP            string           `xml:"IP,omitempty"`
+	ErrCount      int              `xml:"ErrCount"`
+	Errors        *namecheapErrors `xml:"errors,omitempty"`
+	ResponseCount int              `xml:"ResponseCount"`
+	Done          bool             `xml:"Done"`
+}
+
+type namecheapErrors struct {
+	Err1 string `xml:"Err1"`
+}
+
+// Respond writes the <interface-response> XML. ErrCount is 0 on success;
+// failures carry a single Err1 message.
+func (m *NamecheapMode) Respond(w http.ResponseWriter, req *Request, outcome Outcome) {
+	resp := namecheapResponse{Command: "SETDNSHOST", Language: "eng", Done: true}
+	if req != nil {
+		resp.IP = req.IP
+	}
+	if msg := namecheapError(outcome); msg != "" {
+		resp.ErrCount = 1
+		resp.Errors = &namecheapErrors{Err1: msg}
+	}
+
+	body, err := xml.MarshalIndent(resp, "", "  ")
+	if err != nil {
+		m.logger.Error("Failed to encode Namecheap response", "error", err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+	if _, err := w.Write(append([]byte(xml.Header), body...)); err != nil {
+		m.logger.Error("HTTP write error", "error", err)
+	}
+}
+
+// namecheapError returns the Err1 message for a failed outcome, or "" on success.
+func namecheapError(outcome Outcome) string {
+	switch outcome {
+	case OutcomeSuccess, OutcomeNoChange:
+		return ""
+	case OutcomeAuthFailure:
+		return "Passwords do not match"
+	case OutcomeInvalidDomain:
+		return "Domain name not found"
+	case OutcomeNoHost:
+		return "No Records updated. A record not Found;"
+	case OutcomeAbuse:
+		return "Domain is blocked"
+	case OutcomeNotDonator:
+		return "Wildcard records are not enabled for this domain"
+	case OutcomeDNSError:
+		return "DNS provider error, record not updated"
+	default:
+		return "An unexpected error has occurred"
+	}
+}
@@ -0,0 +1,80 @@
+package mode
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// OrayMode implements the Oray (花生壳) /ph/update protocol. Requests follow
+// DynDNS2 conventions but only the Oray parameters (hostname, myip) are
+// read, and results use the Oray return vocabulary.
+type OrayMode struct {
+	*DynMode
+}
+
+func NewOrayMode(logger *slog.Logger) Mode {
+	dyn := NewDynMode(false, logger)
+	dyn.hostParams = []string{"hostname"}
+	dyn.ipParams = []string{"myip"}
+	return &OrayMode{DynMode: dyn}
+}
+
+// Respond writes one Oray return code per hostname:
+//   - OutcomeSuccess       -> "good <ip>"
+//   - OutcomeNoChange      -> "nochg <ip>"
+//   - OutcomeAuthFailure   -> "badauth"
+//   - OutcomeInvalidDomain -> "notfqdn"
+//   - OutcomeTooManyHosts  -> "notfqdn"
+//   - OutcomeNoHost        -> "nohost"
+//   - OutcomeAbuse         -> "abuse"
+//   - OutcomeNotDonator    -> "!donator"
+//   - any other outcome    -> "911"
+func (m *OrayMode) Respond(w http.ResponseWriter, req *Request, outcome Outcome) {
+	ip := ""
+	if req != nil {
+		ip = req.IP
+	}
+
+	var body string
+	if req != nil && len(req.Results) > 0 {
+		lines := make([]string, len(req.Results))
+		for i, r := range req.Results {
+			lines[i] = orayResultLine(r.Outcome, ip)
+		}
+		body = strings.Join(lines, "\n")
+	} else {
+		body = orayResultLine(outcome, ip)
+	}
+
+	if _, err := w.Write([]byte(body)); err != nil {
+		m.logger.Error("Failed to write Oray response", "body", body, "error", err)
+	}
+}
+
+// orayResultLine renders a single Oray return code.
+func orayResultLine(outcome Outcome, ip string) string {
+	var code string
+	switch outcome {
+	case OutcomeSuccess:
+		code = "good"
+	case OutcomeNoChange:
+		code = "nochg"
+	case OutcomeAuthFailure:
+		return "badauth"
+	case OutcomeInvalidDomain, OutcomeTooManyHosts:
+		return "notfqdn"
+	case OutcomeNoHost:
+		return "nohost"
+	case OutcomeAbuse:
+		return "abuse"
+	case OutcomeNotDonator:
+		return "!donator"
+	default:
+		return "911"
+	}
+	if ip != "" {
+		return code + " " + ip
+	}
+	return code
+}
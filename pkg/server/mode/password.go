@@ -0,0 +1,128 @@
+package mode
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/NewFuture/CloudDDNS/pkg/config"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Argon2id parameters for new hashes (RFC 9106 second recommended option).
+const (
+	argon2Time    = 3
+	argon2Memory  = 64 * 1024
+	argon2Threads = 4
+	argon2KeyLen  = 32
+	argon2SaltLen = 16
+)
+
+// passwordChecks verifies a client password against the stored secret for
+// each scheme that compares them directly. The GnuDIP scheme is checked by
+// the challenge handlers instead.
+var passwordChecks = map[string]func(stored, input string) bool{
+	config.SchemePlain: func(stored, input string) bool {
+		return subtle.ConstantTimeCompare([]byte(stored), []byte(input)) == 1
+	},
+	config.SchemeMD5: func(stored, input string) bool {
+		sum := md5.Sum([]byte(stored))
+		return strings.EqualFold(hex.EncodeToString(sum[:]), input)
+	},
+	config.SchemeSHA256: func(stored, input string) bool {
+		sum := sha256.Sum256([]byte(stored))
+		return strings.EqualFold(hex.EncodeToString(sum[:]), input)
+	},
+	config.SchemeBase64: func(stored, input string) bool {
+		decoded, err := base64.StdEncoding.DecodeString(input)
+		return err == nil && string(decoded) == stored
+	},
+	config.SchemeStoredMD5: func(stored, input string) bool {
+		sum := md5.Sum([]byte(input))
+		return strings.EqualFold(stored, hex.EncodeToString(sum[:]))
+	},
+	config.SchemeStoredSHA256: func(stored, input string) bool {
+		sum := sha256.Sum256([]byte(input))
+		return strings.EqualFold(stored, hex.EncodeToString(sum[:]))
+	},
+	config.SchemeStoredBase64: func(stored, input string) bool {
+		decoded, err := base64.StdEncoding.DecodeString(stored)
+		return err == nil && string(decoded) == input
+	},
+	config.SchemeBcrypt: func(stored, input string) bool {
+		return config.IsBcryptHash(stored) && bcrypt.CompareHashAndPassword([]byte(stored), []byte(input)) == nil
+	},
+	config.SchemeArgon2id: func(stored, input string) bool {
+		ok, err := verifyArgon2id(stored, input)
+		return err == nil && ok
+	},
+}
+
+// matchPassword returns the first scheme under which input matches stored.
+func matchPassword(schemes []string, stored, input string) (string, bool) {
+	for _, scheme := range schemes {
+		if check, ok := passwordChecks[scheme]; ok && check(stored, input) {
+			return scheme, true
+		}
+	}
+	return "", false
+}
+
+// verifyPassword checks input against stored with the default schemes for
+// stored, as used when a user configures no password_schemes.
+func verifyPassword(storedPassword, inputPassword string) bool {
+	_, ok := matchPassword(config.DefaultPasswordSchemes(storedPassword), storedPassword, inputPassword)
+	return ok
+}
+
+// authenticateUser verifies a client password against the user's stored
+// secret (password_hash, or password) under the user's allowed schemes, and
+// logs which scheme accepted it.
+func authenticateUser(logger *slog.Logger, u *config.UserConfig, input string) bool {
+	scheme, ok := matchPassword(u.SchemesFor(u.AuthSecret()), u.AuthSecret(), input)
+	if ok {
+		logger.Info("Password matched scheme", "user", u.Username, "scheme", scheme)
+	}
+	return ok
+}
+
+// HashPassword returns the value to store for password under scheme: a
+// password_hash for bcrypt or argon2id, or the gnudip_md5 value for gnudip.
+func HashPassword(scheme, password string) (string, error) {
+	switch scheme {
+	case config.SchemeBcrypt:
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		return string(hash), err
+	case config.SchemeArgon2id:
+		salt := make([]byte, argon2SaltLen)
+		if _, err := rand.Read(salt); err != nil {
+			return "", err
+		}
+		key := argon2.IDKey([]byte(password), salt, argon2Time, argon2Memory, argon2Threads, argon2KeyLen)
+		return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, argon2Memory, argon2Time, argon2Threads,
+			base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+	case config.SchemeGnuDIP:
+		sum := md5.Sum([]byte(password))
+		return hex.EncodeToString(sum[:]), nil
+	default:
+		return "", fmt.Errorf("unsupported hash scheme %q", scheme)
+	}
+}
+
+// verifyArgon2id checks input against a PHC-formatted argon2id hash. Hashes
+// with parameters that argon2 cannot run safely are rejected with an error.
+func verifyArgon2id(encoded, input string) (bool, error) {
+	h, err := config.ParseArgon2Hash(encoded)
+	if err != nil {
+		return false, err
+	}
+	computed := argon2.IDKey([]byte(input), h.Salt, h.Time, h.Memory, h.Threads, uint32(len(h.Key)))
+	return subtle.ConstantTimeCompare(computed, h.Key) == 1, nil
+}
@@ -0,0 +1,130 @@
+package mode
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/NewFuture/CloudDDNS/pkg/config"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestAuthenticateUserSchemes(t *testing.T) {
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("s3cret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("bcrypt: %v", err)
+	}
+	salt := []byte("0123456789abcdef")
+	argonHash := fmt.Sprintf("$argon2id$v=%d$m=1024,t=1,p=1$%s$%s", argon2.Version,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(argon2.IDKey([]byte("s3cret"), salt, 1, 1024, 1, 32)))
+	md5Sum := md5.Sum([]byte("s3cret"))
+	md5Hex := hex.EncodeToString(md5Sum[:])
+
+	tests := []struct {
+		name  string
+		user  config.UserConfig
+		input string
+		want  bool
+	}{
+		{name: "legacy plaintext", user: config.UserConfig{Password: "s3cret"}, input: "s3cret", want: true},
+		{name: "legacy md5 of secret", user: config.UserConfig{Password: "s3cret"}, input: md5Hex, want: true},
+		{name: "plain only rejects md5", user: config.UserConfig{Password: "s3cret", PasswordSchemes: []string{"plain"}}, input: md5Hex, want: false},
+		{name: "plain only accepts plaintext", user: config.UserConfig{Password: "s3cret", PasswordSchemes: []string{"plain"}}, input: "s3cret", want: true},
+		{name: "md5 only rejects plaintext", user: config.UserConfig{Password: "s3cret", PasswordSchemes: []string{"md5"}}, input: "s3cret", want: false},
+		{name: "gnudip only rejects direct password", user: config.UserConfig{Password: "s3cret", PasswordSchemes: []string{"gnudip"}}, input: "s3cret", want: false},
+		{name: "bcrypt hash", user: config.UserConfig{Password: "api-secret", PasswordHash: string(bcryptHash)}, input: "s3cret", want: true},
+		{name: "bcrypt hash rejects api secret", user: config.UserConfig{Password: "api-secret", PasswordHash: string(bcryptHash)}, input: "api-secret", want: false},
+		{name: "bcrypt hash rejects hash itself", user: config.UserConfig{Password: "api-secret", PasswordHash: string(bcryptHash)}, input: string(bcryptHash), want: false},
+		{name: "argon2id hash", user: config.UserConfig{Password: "api-secret", PasswordHash: argonHash}, input: "s3cret", want: true},
+		{name: "argon2id wrong password", user: config.UserConfig{Password: "api-secret", PasswordHash: argonHash}, input: "wrong", want: false},
+		{name: "argon2id not allowed by schemes", user: config.UserConfig{PasswordHash: argonHash, PasswordSchemes: []string{"bcrypt"}}, input: "s3cret", want: false},
+		// argon2.IDKey panics on t=0 or p=0; such hashes must fail closed.
+		{name: "argon2id zero iterations", user: config.UserConfig{PasswordHash: strings.Replace(argonHash, "t=1", "t=0", 1)}, input: "s3cret", want: false},
+		{name: "argon2id zero parallelism", user: config.UserConfig{PasswordHash: strings.Replace(argonHash, "p=1", "p=0", 1)}, input: "s3cret", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := tt.user
+			u.Username = "alice"
+			if got := authenticateUser(slog.Default(), &u, tt.input); got != tt.want {
+				t.Fatalf("authenticateUser(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGnuDIPSchemeRequired(t *testing.T) {
+	originalConfig := config.Current()
+	defer config.SetCurrent(originalConfig)
+	config.SetCurrent(&config.Config{Users: []config.UserConfig{
+		{Username: "alice", Password: "s3cret", Provider: "unknown", PasswordSchemes: []string{"plain"}},
+	}})
+
+	salt, _, _ := gnuChallenges.issue("alice", "192.0.2.1")
+	req := &Request{Username: "alice", Password: ComputeTCPHash("s3cret", salt), Salt: salt, Domain: "home.example.com", IP: "1.2.3.4"}
+	if outcome := NewGnuHTTPMode(slog.New(slog.NewTextHandler(t.Output(), nil))).Process(req); outcome != OutcomeAuthFailure {
+		t.Fatalf("salted GnuDIP login without the gnudip scheme: outcome %v, want %v", outcome, OutcomeAuthFailure)
+	}
+}
+
+func TestHashPasswordRoundTrip(t *testing.T) {
+	for _, scheme := range []string{config.SchemeBcrypt, config.SchemeArgon2id} {
+		t.Run(scheme, func(t *testing.T) {
+			hash, err := HashPassword(scheme, "s3cret")
+			if err != nil {
+				t.Fatalf("HashPassword: %v", err)
+			}
+			u := &config.UserConfig{Username: "alice", Password: "api-secret", PasswordHash: hash}
+			if !authenticateUser(slog.Default(), u, "s3cret") {
+				t.Fatalf("hash %q should verify the original password", hash)
+			}
+			if authenticateUser(slog.Default(), u, "S3cret") {
+				t.Fatalf("hash %q should reject a different password", hash)
+			}
+		})
+	}
+	if _, err := HashPassword("rot13", "s3cret"); err == nil {
+		t.Fatal("unknown scheme should fail")
+	}
+}
+
+func TestGnuDIPMD5Secret(t *testing.T) {
+	originalConfig := config.Current()
+	defer config.SetCurrent(originalConfig)
+
+	hash, err := HashPassword(config.SchemeBcrypt, "s3cret")
+	if err != nil {
+		t.Fatalf("HashPassword: %v", err)
+	}
+	gnuMD5, _ := HashPassword(config.SchemeGnuDIP, "s3cret")
+	config.SetCurrent(&config.Config{Users: []config.UserConfig{
+		{Username: "alice", Password: "api-secret", Provider: "unknown", PasswordHash: hash, GnuDIPMD5: gnuMD5},
+		{Username: "bob", Password: "api-secret", Provider: "unknown", PasswordHash: hash},
+	}})
+
+	tests := []struct {
+		user string
+		want Outcome
+	}{
+		// Authentication passes and the unknown provider fails afterwards.
+		{user: "alice", want: OutcomeSystemError},
+		// Without gnudip_md5 a slow-hash user does not accept GnuDIP challenges.
+		{user: "bob", want: OutcomeAuthFailure},
+	}
+	for _, tt := range tests {
+		t.Run(tt.user, func(t *testing.T) {
+			salt, _, _ := gnuChallenges.issue(tt.user, "192.0.2.1")
+			req := &Request{Username: tt.user, Password: ComputeTCPHash("s3cret", salt), Salt: salt, Domain: "home.example.com", IP: "1.2.3.4"}
+			if outcome := NewGnuHTTPMode(slog.New(slog.NewTextHandler(t.Output(), nil))).Process(req); outcome != tt.want {
+				t.Fatalf("outcome = %v, want %v", outcome, tt.want)
+			}
+		})
+	}
+}
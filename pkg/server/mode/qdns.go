@@ -0,0 +1,146 @@
+package mode
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/NewFuture/CloudDDNS/pkg/config"
+	"github.com/NewFuture/CloudDDNS/pkg/provider"
+)
+
+// MX preferences used for the 3322 mx parameter; backmx=YES publishes the
+// exchanger as a lower-priority backup.
+const (
+	qdnsMXPriority     = 10
+	qdnsBackMXPriority = 20
+)
+
+// QDNSMode implements the 3322/qDNS /dyndns/update protocol. On top of the
+// DynDNS2 parameters it checks system, mirrors the address to *.<host> when
+// wildcard=ON, removes that record when wildcard=OFF and publishes an MX
+// record for mx.
+// Only the dynamic system is served: statdns and custom hosts are managed
+// records on 3322 with no equivalent here, so they are answered with badsys
+// rather than silently updated like dyndns hosts. Responses use the DynDNS2
+// vocabulary plus badsys.
+type QDNSMode struct {
+	*DynMode
+}
+
+func NewQDNSMode(logger *slog.Logger) Mode {
+	return &QDNSMode{DynMode: NewDynMode(false, logger)}
+}
+
+func (m *QDNSMode) Prepare(r *http.Request) (*Request, Outcome) {
+	q := r.URL.Query()
+	switch system := strings.ToLower(getQueryParam(q, "system")); system {
+	case "", "dyndns":
+	default:
+		// statdns and custom are deliberately rejected: 3322 manages those
+		// hosts itself, and treating them as dyndns would update records the
+		// client did not ask to be dynamic.
+		m.logger.Warn("Unsupported qDNS system", "system", system)
+		return &Request{}, OutcomeBadSystem
+	}
+
+	req, outcome := m.DynMode.Prepare(r)
+	if outcome != OutcomeSuccess {
+		return req, outcome
+	}
+
+	wildcard := getQueryParam(q, "wildcard")
+	req.Wildcard = strings.EqualFold(wildcard, "ON")
+	req.ClearWildcard = strings.EqualFold(wildcard, "OFF")
+	req.BackMX = strings.EqualFold(getQueryParam(q, "backmx"), "YES")
+	if mx := getQueryParam(q, "mx"); mx != "" && !strings.EqualFold(mx, "NO") {
+		normalized, err := normalizeHostname(mx)
+		if err != nil || isWildcardHostname(normalized) {
+			m.logger.Warn("Invalid qDNS mx host", "mx", mx, "error", err)
+			return req, OutcomeInvalidDomain
+		}
+		req.MX = normalized
+	}
+	m.logger.Debug("Prepared qDNS options", "wildcard", req.Wildcard, "clear_wildcard", req.ClearWildcard, "mx", req.MX, "backmx", req.BackMX)
+	return req, OutcomeSuccess
+}
+
+// Process updates the A records like DynMode, then applies the wildcard and
+// MX options to every host whose own update was accepted.
+func (m *QDNSMode) Process(req *Request) Outcome {
+	if m.debugBypass(req) {
+		return OutcomeSuccess
+	}
+
+	u, p, outcome := m.authorize(req)
+	if outcome != OutcomeSuccess {
+		return outcome
+	}
+
+	req.Results = updateHosts(m.logger, p, u, req.Domains, req.IP, req.Reqc)
+	for i := range req.Results {
+		r := &req.Results[i]
+		if r.Outcome != OutcomeSuccess && r.Outcome != OutcomeNoChange {
+			continue
+		}
+		changed, err := m.applyOptions(p, u, req, r.Domain)
+		if err != nil {
+			m.logger.Error("qDNS option update failed", "domain", displayHostname(r.Domain), "error", err)
+			r.Outcome = outcomeForError(err)
+		} else if changed {
+			r.Outcome = OutcomeSuccess
+		}
+	}
+	return summarizeResults(req.Results)
+}
+
+// applyOptions writes the wildcard and MX records requested for domain.
+func (m *QDNSMode) applyOptions(p provider.Provider, u *config.UserConfig, req *Request, domain string) (bool, error) {
+	changed := false
+	if req.Wildcard && !isWildcardHostname(domain) {
+		c, err := applyUpdate(p, u, wildcardPrefix+domain, req.IP, req.Reqc)
+		if err != nil {
+			return false, err
+		}
+		changed = changed || c
+	}
+	if req.ClearWildcard && !isWildcardHostname(domain) {
+		c, err := clearWildcard(p, u, wildcardPrefix+domain)
+		if err != nil {
+			return false, err
+		}
+		changed = changed || c
+	}
+	// MX records are left untouched while the host is offline.
+	if req.MX != "" && req.Reqc != 1 {
+		opts := recordOptions(u, domain)
+		opts.Type = provider.RecordTypeMX
+		opts.Priority = qdnsMXPriority
+		if req.BackMX {
+			opts.Priority = qdnsBackMXPriority
+		}
+		c, err := p.UpdateRecord(domain, req.MX, opts)
+		if err != nil {
+			return changed, err
+		}
+		changed = changed || c
+	}
+	return changed, nil
+}
+
+// clearWildcard deletes the wildcard record for wildcard=OFF. Users without
+// allow_wildcard cannot have published one here, and clients send
+// wildcard=OFF by default, so for them it is a no-op rather than !donator.
+func clearWildcard(p provider.Provider, u *config.UserConfig, wildcard string) (bool, error) {
+	if !u.AllowWildcard {
+		return false, nil
+	}
+	opts := recordOptions(u, wildcard)
+	if _, err := p.GetRecord(wildcard, opts); errors.Is(err, provider.ErrRecordNotFound) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, p.DeleteRecord(wildcard, opts)
+}
@@ -0,0 +1,87 @@
+package mode
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/NewFuture/CloudDDNS/pkg/config"
+	"github.com/NewFuture/CloudDDNS/pkg/provider"
+)
+
+func TestQDNSApplyOptions(t *testing.T) {
+	tests := []struct {
+		name      string
+		user      config.UserConfig
+		records   map[string]string
+		req       Request
+		wantCalls []string
+		wantOpts  []provider.RecordOptions
+		wantErr   error
+	}{
+		{
+			name:      "wildcard mirrors address",
+			user:      config.UserConfig{AllowWildcard: true},
+			req:       Request{IP: "1.2.3.4", Wildcard: true},
+			wantCalls: []string{"update *.host.example.com 1.2.3.4"},
+			wantOpts:  []provider.RecordOptions{{}},
+		},
+		{
+			name:    "wildcard requires permission",
+			user:    config.UserConfig{},
+			req:     Request{IP: "1.2.3.4", Wildcard: true},
+			wantErr: errWildcardNotAllowed,
+		},
+		{
+			name:      "wildcard off clears record",
+			user:      config.UserConfig{AllowWildcard: true},
+			records:   map[string]string{"*.host.example.com": "1.2.3.4"},
+			req:       Request{IP: "1.2.3.4", ClearWildcard: true},
+			wantCalls: []string{"delete *.host.example.com"},
+			wantOpts:  []provider.RecordOptions{{}},
+		},
+		{
+			name: "wildcard off without record",
+			user: config.UserConfig{AllowWildcard: true},
+			req:  Request{IP: "1.2.3.4", ClearWildcard: true},
+		},
+		{
+			name:    "wildcard off ignored without permission",
+			records: map[string]string{"*.host.example.com": "1.2.3.4"},
+			req:     Request{IP: "1.2.3.4", ClearWildcard: true},
+		},
+		{
+			name:      "mx record",
+			req:       Request{IP: "1.2.3.4", MX: "mail.example.com"},
+			wantCalls: []string{"update host.example.com mail.example.com"},
+			wantOpts:  []provider.RecordOptions{{Type: provider.RecordTypeMX, Priority: qdnsMXPriority}},
+		},
+		{
+			name:      "backup mx record",
+			req:       Request{IP: "1.2.3.4", MX: "mail.example.com", BackMX: true},
+			wantCalls: []string{"update host.example.com mail.example.com"},
+			wantOpts:  []provider.RecordOptions{{Type: provider.RecordTypeMX, Priority: qdnsBackMXPriority}},
+		},
+		{
+			name: "mx untouched while offline",
+			req:  Request{IP: "0.0.0.0", Reqc: 1, MX: "mail.example.com"},
+		},
+	}
+
+	m := NewQDNSMode(nil).(*QDNSMode)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &fakeProvider{records: tt.records}
+			_, err := m.applyOptions(p, &tt.user, &tt.req, "host.example.com")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("applyOptions() error = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(p.calls, tt.wantCalls) {
+				t.Fatalf("provider calls = %v, want %v", p.calls, tt.wantCalls)
+			}
+			if !reflect.DeepEqual(p.opts, tt.wantOpts) {
+				t.Fatalf("record options = %+v, want %+v", p.opts, tt.wantOpts)
+			}
+		})
+	}
+}
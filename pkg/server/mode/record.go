@@ -0,0 +1,145 @@
+package mode
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"github.com/NewFuture/CloudDDNS/pkg/config"
+	"github.com/NewFuture/CloudDDNS/pkg/provider"
+)
+
+// recordOptions resolves the TTL, line and remark that apply to domain for u.
+func recordOptions(u *config.UserConfig, domain string) provider.RecordOptions {
+	rc := u.RecordFor(domain)
+	return provider.RecordOptions{TTL: rc.TTL, Line: rc.Line, Remark: rc.Remark}
+}
+
+// errHostNotAllowed is returned when the user's apex policy forbids updating
+// the requested record; errWildcardNotAllowed when wildcards are not granted.
+var (
+	errHostNotAllowed     = errors.New("host not allowed by user policy")
+	errWildcardNotAllowed = errors.New("wildcard not allowed by user policy")
+)
+
+// checkHostPolicy rejects zone apex and wildcard updates the user has not been
+// granted. The zone is resolved by the provider so delegated subzones count as
+// their own apex.
+func checkHostPolicy(p provider.Provider, u *config.UserConfig, domain string) error {
+	_, subDomain, err := p.SplitDomain(domain)
+	if err != nil {
+		return err
+	}
+	if subDomain == "@" && !u.ApexAllowed() {
+		return fmt.Errorf("%w: zone apex %s", errHostNotAllowed, domain)
+	}
+	if isWildcardHostname(domain) && !u.AllowWildcard {
+		return fmt.Errorf("%w: %s", errWildcardNotAllowed, domain)
+	}
+	return nil
+}
+
+// outcomeForError maps a failed update to the protocol-neutral outcome. Any
+// error not raised by local policy comes from the provider API.
+func outcomeForError(err error) Outcome {
+	switch {
+	case errors.Is(err, errHostNotAllowed), errors.Is(err, provider.ErrZoneNotFound):
+		return OutcomeNoHost
+	case errors.Is(err, errWildcardNotAllowed):
+		return OutcomeNotDonator
+	default:
+		return OutcomeDNSError
+	}
+}
+
+// updateHosts applies the update to every domain concurrently and returns the
+// per-host outcomes in request order. Repeated hostnames are written once and
+// share the result so concurrent writers never race on the same record.
+// Failures are logged through logger at error level.
+func updateHosts(logger *slog.Logger, p provider.Provider, u *config.UserConfig, domains []string, ip string, reqc int) []HostResult {
+	results := make([]HostResult, len(domains))
+	first := make(map[string]int, len(domains))
+	var wg sync.WaitGroup
+	for i, domain := range domains {
+		results[i].Domain = domain
+		if _, seen := first[domain]; seen {
+			continue
+		}
+		first[domain] = i
+		wg.Add(1)
+		go func(i int, domain string) {
+			defer wg.Done()
+			changed, err := applyUpdate(p, u, domain, ip, reqc)
+			switch {
+			case err != nil:
+				logger.Error("DNS update failed", "domain", displayHostname(domain), "ip", ip, "error", err)
+				results[i].Outcome = outcomeForError(err)
+			case !changed:
+				logger.Debug("DNS record unchanged", "domain", displayHostname(domain), "ip", ip)
+				results[i].Outcome = OutcomeNoChange
+			default:
+				logger.Info("DNS record updated", "domain", displayHostname(domain), "ip", ip)
+				results[i].Outcome = OutcomeSuccess
+			}
+		}(i, domain)
+	}
+	wg.Wait()
+
+	for i := range results {
+		results[i].Outcome = results[first[results[i].Domain]].Outcome
+	}
+	return results
+}
+
+// summarizeResults folds per-host outcomes into the single outcome used by
+// protocols that report one status per request: a shared outcome is returned
+// as-is, and a mix counts as success when at least one host was accepted.
+func summarizeResults(results []HostResult) Outcome {
+	if len(results) == 0 {
+		return OutcomeSuccess
+	}
+	summary := results[0].Outcome
+	mixed, accepted := false, false
+	for _, r := range results {
+		if r.Outcome != summary {
+			mixed = true
+		}
+		if r.Outcome == OutcomeSuccess || r.Outcome == OutcomeNoChange {
+			accepted = true
+		}
+	}
+	if mixed && accepted {
+		return OutcomeSuccess
+	}
+	return summary
+}
+
+// applyUpdate writes ip to domain through the provider. Offline requests
+// (reqc=1) follow the user's offline policy instead of always publishing
+// 0.0.0.0: the record can be deleted, paused or pointed at a parking IP.
+// changed is false when the provider reported the record was already current.
+func applyUpdate(p provider.Provider, u *config.UserConfig, domain, ip string, reqc int) (bool, error) {
+	if err := checkHostPolicy(p, u, domain); err != nil {
+		return false, err
+	}
+	opts := recordOptions(u, domain)
+	if reqc != 1 {
+		return p.UpdateRecord(domain, ip, opts)
+	}
+
+	switch u.Offline {
+	case config.OfflineDelete:
+		return true, p.DeleteRecord(domain, opts)
+	case config.OfflinePause:
+		// Nothing to pause when the record was never created.
+		if err := p.SetRecordStatus(domain, false, opts); err != nil && !errors.Is(err, provider.ErrRecordNotFound) {
+			return false, err
+		}
+		return true, nil
+	case config.OfflinePark:
+		return p.UpdateRecord(domain, u.ParkingIP, opts)
+	default:
+		return p.UpdateRecord(domain, ip, opts)
+	}
+}
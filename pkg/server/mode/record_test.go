@@ -0,0 +1,244 @@
+package mode
+
+import (
+	"errors"
+	"log/slog"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/NewFuture/CloudDDNS/pkg/config"
+	"github.com/NewFuture/CloudDDNS/pkg/provider"
+)
+
+// fakeProvider records the calls made through the provider.Provider interface.
+// records holds existing record values keyed by fakeRecordKey and is kept up
+// to date by writes when non-nil; hosts under a zone listed in missingZones
+// are reported as not hosted by the account.
+type fakeProvider struct {
+	mu           sync.Mutex
+	calls        []string
+	opts         []provider.RecordOptions
+	statusErr    error
+	records      map[string]string
+	recordOpts   map[string]provider.RecordOptions
+	missingZones map[string]bool
+}
+
+func (f *fakeProvider) UpdateRecord(domain, ip string, opts provider.RecordOptions) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, "update "+domain+" "+ip)
+	f.opts = append(f.opts, opts)
+	key := fakeRecordKey(domain, opts)
+	changed := f.records[key] != ip
+	if f.records != nil {
+		f.records[key] = ip
+		if f.recordOpts == nil {
+			f.recordOpts = map[string]provider.RecordOptions{}
+		}
+		f.recordOpts[key] = opts
+	}
+	return changed, nil
+}
+
+// fakeRecordKey keys A records by domain and other types by "<type> <domain>".
+func fakeRecordKey(domain string, opts provider.RecordOptions) string {
+	if opts.Type == "" || opts.Type == provider.RecordTypeA {
+		return domain
+	}
+	return opts.Type + " " + domain
+}
+
+func (f *fakeProvider) DeleteRecord(domain string, opts provider.RecordOptions) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, "delete "+domain)
+	f.opts = append(f.opts, opts)
+	delete(f.records, fakeRecordKey(domain, opts))
+	return nil
+}
+
+func (f *fakeProvider) GetRecord(domain string, opts provider.RecordOptions) (provider.Record, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key := fakeRecordKey(domain, opts)
+	value, ok := f.records[key]
+	if !ok {
+		return provider.Record{}, provider.ErrRecordNotFound
+	}
+	saved := f.recordOpts[key]
+	return provider.Record{Value: value, TTL: saved.TTL, Priority: saved.Priority, Remark: saved.Remark, Enabled: true}, nil
+}
+
+func (f *fakeProvider) SplitDomain(domain string) (string, string, error) {
+	zone, sub, err := provider.ParseDomain(domain)
+	if err == nil && f.missingZones[zone] {
+		return "", "", provider.ErrZoneNotFound
+	}
+	return zone, sub, err
+}
+
+func (f *fakeProvider) SetRecordStatus(domain string, enabled bool, opts provider.RecordOptions) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.opts = append(f.opts, opts)
+	if enabled {
+		f.calls = append(f.calls, "enable "+domain)
+	} else {
+		f.calls = append(f.calls, "pause "+domain)
+	}
+	return f.statusErr
+}
+
+func TestApplyUpdateOfflinePolicies(t *testing.T) {
+	tests := []struct {
+		name      string
+		user      config.UserConfig
+		reqc      int
+		ip        string
+		statusErr error
+		want      string
+	}{
+		{name: "normal update ignores policy", user: config.UserConfig{Offline: config.OfflineDelete}, reqc: 0, ip: "1.2.3.4", want: "update host.example.com 1.2.3.4"},
+		{name: "default policy writes zero IP", user: config.UserConfig{}, reqc: 1, ip: "0.0.0.0", want: "update host.example.com 0.0.0.0"},
+		{name: "explicit zero policy", user: config.UserConfig{Offline: config.OfflineZero}, reqc: 1, ip: "0.0.0.0", want: "update host.example.com 0.0.0.0"},
+		{name: "delete policy", user: config.UserConfig{Offline: config.OfflineDelete}, reqc: 1, ip: "0.0.0.0", want: "delete host.example.com"},
+		{name: "pause policy", user: config.UserConfig{Offline: config.OfflinePause}, reqc: 1, ip: "0.0.0.0", want: "pause host.example.com"},
+		{name: "pause missing record", user: config.UserConfig{Offline: config.OfflinePause}, reqc: 1, ip: "0.0.0.0", statusErr: provider.ErrRecordNotFound, want: "pause host.example.com"},
+		{name: "park policy", user: config.UserConfig{Offline: config.OfflinePark, ParkingIP: "192.0.2.1"}, reqc: 1, ip: "0.0.0.0", want: "update host.example.com 192.0.2.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &fakeProvider{statusErr: tt.statusErr}
+			if _, err := applyUpdate(p, &tt.user, "host.example.com", tt.ip, tt.reqc); err != nil {
+				t.Fatalf("applyUpdate() error = %v", err)
+			}
+			if len(p.calls) != 1 || p.calls[0] != tt.want {
+				t.Fatalf("provider calls = %v, want [%s]", p.calls, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyUpdatePassesRecordOptions(t *testing.T) {
+	u := &config.UserConfig{
+		RecordConfig: config.RecordConfig{TTL: 600, Line: "default"},
+		Hosts: []config.HostConfig{
+			{Pattern: "*.lan.example.com", RecordConfig: config.RecordConfig{TTL: 60, Line: "telecom", Remark: "lan"}},
+		},
+	}
+
+	tests := []struct {
+		domain string
+		want   provider.RecordOptions
+	}{
+		{domain: "cam.lan.example.com", want: provider.RecordOptions{TTL: 60, Line: "telecom", Remark: "lan"}},
+		{domain: "www.example.com", want: provider.RecordOptions{TTL: 600, Line: "default"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.domain, func(t *testing.T) {
+			p := &fakeProvider{}
+			if _, err := applyUpdate(p, u, tt.domain, "1.2.3.4", 0); err != nil {
+				t.Fatalf("applyUpdate() error = %v", err)
+			}
+			if len(p.opts) != 1 || p.opts[0] != tt.want {
+				t.Fatalf("record options = %+v, want %+v", p.opts, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyUpdateHostPolicy(t *testing.T) {
+	deny := false
+	tests := []struct {
+		name        string
+		user        config.UserConfig
+		domain      string
+		wantErr     error
+		wantOutcome Outcome
+	}{
+		{name: "apex allowed by default", user: config.UserConfig{}, domain: "example.com"},
+		{name: "apex denied", user: config.UserConfig{AllowApex: &deny}, domain: "example.com", wantErr: errHostNotAllowed, wantOutcome: OutcomeNoHost},
+		{name: "subdomain unaffected by apex flag", user: config.UserConfig{AllowApex: &deny}, domain: "www.example.com"},
+		{name: "wildcard denied by default", user: config.UserConfig{}, domain: "*.example.com", wantErr: errWildcardNotAllowed, wantOutcome: OutcomeNotDonator},
+		{name: "nested wildcard denied by default", user: config.UserConfig{}, domain: "*.lab.example.com", wantErr: errWildcardNotAllowed, wantOutcome: OutcomeNotDonator},
+		{name: "wildcard allowed", user: config.UserConfig{AllowWildcard: true}, domain: "*.example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &fakeProvider{}
+			_, err := applyUpdate(p, &tt.user, tt.domain, "1.2.3.4", 0)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("applyUpdate() error = %v, want %v", err, tt.wantErr)
+				}
+				if len(p.calls) != 0 {
+					t.Fatalf("provider should not be called, got %v", p.calls)
+				}
+				if got := outcomeForError(err); got != tt.wantOutcome {
+					t.Fatalf("outcomeForError() = %v, want %v", got, tt.wantOutcome)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyUpdate() error = %v", err)
+			}
+			if len(p.calls) != 1 || p.calls[0] != "update "+tt.domain+" 1.2.3.4" {
+				t.Fatalf("provider calls = %v", p.calls)
+			}
+		})
+	}
+}
+
+func TestOutcomeForProviderError(t *testing.T) {
+	if got := outcomeForError(errors.New("InvalidAccessKeyId.NotFound")); got != OutcomeDNSError {
+		t.Fatalf("outcomeForError() = %v, want OutcomeDNSError", got)
+	}
+}
+
+func TestUpdateHosts(t *testing.T) {
+	p := &fakeProvider{
+		records:      map[string]string{"b.example.com": "1.2.3.4"},
+		missingZones: map[string]bool{"example.org": true},
+	}
+	domains := []string{"a.example.com", "b.example.com", "c.example.org", "a.example.com"}
+	results := updateHosts(slog.Default(), p, &config.UserConfig{}, domains, "1.2.3.4", 0)
+
+	want := []HostResult{
+		{Domain: "a.example.com", Outcome: OutcomeSuccess},
+		{Domain: "b.example.com", Outcome: OutcomeNoChange},
+		{Domain: "c.example.org", Outcome: OutcomeNoHost},
+		{Domain: "a.example.com", Outcome: OutcomeSuccess},
+	}
+	if !reflect.DeepEqual(results, want) {
+		t.Fatalf("updateHosts() = %+v, want %+v", results, want)
+	}
+	if len(p.calls) != 2 {
+		t.Fatalf("expected repeated hostname to be written once, got calls %v", p.calls)
+	}
+}
+
+func TestSummarizeResults(t *testing.T) {
+	tests := []struct {
+		name    string
+		results []HostResult
+		want    Outcome
+	}{
+		{name: "single host", results: []HostResult{{Outcome: OutcomeNoHost}}, want: OutcomeNoHost},
+		{name: "all unchanged", results: []HostResult{{Outcome: OutcomeNoChange}, {Outcome: OutcomeNoChange}}, want: OutcomeNoChange},
+		{name: "mixed with accepted host", results: []HostResult{{Outcome: OutcomeNoHost}, {Outcome: OutcomeNoChange}}, want: OutcomeSuccess},
+		{name: "mixed failures", results: []HostResult{{Outcome: OutcomeNoHost}, {Outcome: OutcomeSystemError}}, want: OutcomeNoHost},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := summarizeResults(tt.results); got != tt.want {
+				t.Fatalf("summarizeResults() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
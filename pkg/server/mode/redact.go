@@ -0,0 +1,134 @@
+package mode
+
+import (
+	"fmt"
+	"mime"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync/atomic"
+)
+
+// Redacted replaces credentials in debug log lines.
+const Redacted = "[REDACTED]"
+
+var logUnredacted atomic.Bool
+
+// sensitiveParams lists query and form keys whose values are credentials.
+var sensitiveParams = map[string]bool{
+	"pass":     true,
+	"password": true,
+	"pwd":      true,
+	"pw":       true,
+	"sign":     true,
+	"token":    true,
+	"key":      true,
+	"secret":   true,
+	"hash":     true,
+}
+
+// SetLogUnredacted disables credential redaction in debug logs. It is meant
+// for troubleshooting client signatures and must be enabled explicitly.
+func SetLogUnredacted(enabled bool) {
+	logUnredacted.Store(enabled)
+}
+
+// RedactSecret masks a password, token or hash for logging.
+func RedactSecret(v string) string {
+	if v == "" || logUnredacted.Load() {
+		return v
+	}
+	return Redacted
+}
+
+// RedactAuthorization keeps only the scheme of an Authorization header.
+func RedactAuthorization(h string) string {
+	if h == "" || logUnredacted.Load() {
+		return h
+	}
+	if scheme, _, ok := strings.Cut(h, " "); ok {
+		return scheme + " " + Redacted
+	}
+	return Redacted
+}
+
+// RedactQuery masks the values of credential parameters in a raw query or
+// form-encoded body. Keys without a value are masked too, since FreeDNS
+// clients send their update token as a bare key.
+func RedactQuery(raw string) string {
+	if raw == "" || logUnredacted.Load() {
+		return raw
+	}
+	parts := strings.Split(raw, "&")
+	for i, part := range parts {
+		if part == "" {
+			continue
+		}
+		key, _, ok := strings.Cut(part, "=")
+		if !ok {
+			parts[i] = Redacted
+			continue
+		}
+		if name, err := url.QueryUnescape(key); err == nil && sensitiveParams[strings.ToLower(name)] {
+			parts[i] = key + "=" + Redacted
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// RedactURL renders a request URL for logging with credentials masked,
+// including the token segment of FreeDNS v2 paths.
+func RedactURL(u *url.URL) string {
+	if logUnredacted.Load() {
+		return u.String()
+	}
+	path := u.EscapedPath()
+	if rest, ok := strings.CutPrefix(path, FreeDNSV2Prefix); ok && rest != "" {
+		_, tail, _ := strings.Cut(rest, "/")
+		path = FreeDNSV2Prefix + Redacted
+		if strings.Contains(rest, "/") {
+			path += "/" + tail
+		}
+	}
+	if u.RawQuery == "" {
+		return path
+	}
+	return path + "?" + RedactQuery(u.RawQuery)
+}
+
+// RedactBody renders a request body for logging. Form bodies are masked like
+// query strings; other payloads are replaced by their size.
+func RedactBody(contentType string, body []byte) string {
+	if len(body) == 0 || logUnredacted.Load() {
+		return string(body)
+	}
+	if mt, _, _ := mime.ParseMediaType(contentType); mt == "application/x-www-form-urlencoded" {
+		return RedactQuery(string(body))
+	}
+	return fmt.Sprintf("%s (%d bytes)", Redacted, len(body))
+}
+
+// signMeta matches the sign meta tag of a GnuDIP handshake page.
+var signMeta = regexp.MustCompile(`(?i)(<meta\s+name="sign"\s+content=")[^"]*(")`)
+
+// RedactResponse renders a response body for logging with the GnuDIP
+// challenge sign masked.
+func RedactResponse(body string) string {
+	if logUnredacted.Load() {
+		return body
+	}
+	return signMeta.ReplaceAllString(body, "${1}"+Redacted+"${2}")
+}
+
+// redactTCPLine masks the hash field of a GnuDIP "user:hash:domain:reqc:addr" line.
+func redactTCPLine(line string) string {
+	if logUnredacted.Load() {
+		return line
+	}
+	parts := strings.SplitN(line, ":", 3)
+	if len(parts) < 2 {
+		return line
+	}
+	parts[1] = RedactSecret(parts[1])
+	return strings.Join(parts, ":")
+}
@@ -0,0 +1,78 @@
+package mode
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestRedaction(t *testing.T) {
+	parse := func(raw string) *url.URL {
+		u, err := url.Parse(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return u
+	}
+
+	tests := []struct {
+		name string
+		got  func() string
+		want string
+	}{
+		{
+			name: "dyndns query",
+			got:  func() string { return RedactURL(parse("/nic/update?user=alice&pass=s3cret&hostname=h.example.com")) },
+			want: "/nic/update?user=alice&pass=[REDACTED]&hostname=h.example.com",
+		},
+		{
+			name: "gnudip sign and mixed case keys",
+			got: func() string {
+				return RedactURL(parse("/cgi-bin/gdipupdt.cgi?salt=abc&time=1&Sign=deadbeef&PassWord=x"))
+			},
+			want: "/cgi-bin/gdipupdt.cgi?salt=abc&time=1&Sign=[REDACTED]&PassWord=[REDACTED]",
+		},
+		{
+			name: "freedns bare token",
+			got:  func() string { return RedactURL(parse("/dynamic/update.php?tok3n&address=1.2.3.4")) },
+			want: "/dynamic/update.php?[REDACTED]&address=1.2.3.4",
+		},
+		{
+			name: "freedns v2 path",
+			got:  func() string { return RedactURL(parse("/u/tok3n/?address=1.2.3.4")) },
+			want: "/u/[REDACTED]/?address=1.2.3.4",
+		},
+		{
+			name: "duckdns token",
+			got:  func() string { return RedactURL(parse("/update?domains=home&token=abc&ip=")) },
+			want: "/update?domains=home&token=[REDACTED]&ip=",
+		},
+		{name: "basic auth", got: func() string { return RedactAuthorization("Basic dXNlcjpwYXNz") }, want: "Basic [REDACTED]"},
+		{name: "bare auth", got: func() string { return RedactAuthorization("tok3n") }, want: "[REDACTED]"},
+		{name: "form body", got: func() string {
+			return RedactBody("application/x-www-form-urlencoded; charset=utf-8", []byte("user=a&password=b"))
+		}, want: "user=a&password=[REDACTED]"},
+		{name: "json body", got: func() string { return RedactBody("application/json", []byte(`{"password":"b"}`)) }, want: "[REDACTED] (16 bytes)"},
+		{name: "tcp line", got: func() string { return redactTCPLine("alice:0123abcd:h.example.com:0:1.2.3.4") }, want: "alice:[REDACTED]:h.example.com:0:1.2.3.4"},
+		{name: "gnudip handshake page", got: func() string {
+			return RedactResponse(`<meta name="salt" content="abc">` + "\n" + `<meta name="sign" content="0123abcd">`)
+		}, want: `<meta name="salt" content="abc">` + "\n" + `<meta name="sign" content="[REDACTED]">`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.got(); got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	SetLogUnredacted(true)
+	defer SetLogUnredacted(false)
+	raw := "/nic/update?user=alice&pass=s3cret"
+	if got := RedactURL(parse(raw)); got != raw {
+		t.Fatalf("unredacted URL = %q, want %q", got, raw)
+	}
+	if got := RedactSecret("0123abcd"); got != "0123abcd" {
+		t.Fatalf("unredacted secret = %q", got)
+	}
+}
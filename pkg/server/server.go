@@ -2,29 +2,32 @@ package server
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"log/slog"
 	"net"
 	"net/http"
-	"sync/atomic"
+	"strings"
+	"time"
 
+	"github.com/NewFuture/CloudDDNS/pkg/config"
+	"github.com/NewFuture/CloudDDNS/pkg/guard"
+	"github.com/NewFuture/CloudDDNS/pkg/logging"
 	"github.com/NewFuture/CloudDDNS/pkg/server/mode"
 )
 
-var debugEnabled atomic.Bool
-
-// SetDebug enables or disables debug logging.
+// SetDebug enables or disables debug-level logging and the debug account.
 func SetDebug(enabled bool) {
-	debugEnabled.Store(enabled)
+	logging.SetDebug(enabled)
 	mode.SetDebugMode(enabled)
 }
 
-func debugLogf(format string, args ...interface{}) {
-	if !debugEnabled.Load() {
-		return
-	}
-	log.Printf("[DEBUG] "+format, args...)
+// SetDebugUnredacted disables masking of passwords, tokens and hashes in
+// debug logs.
+func SetDebugUnredacted(enabled bool) {
+	mode.SetLogUnredacted(enabled)
 }
 
 type loggingResponseWriter struct {
@@ -52,16 +55,46 @@ func StartTCP(port int) {
 	if err != nil {
 		log.Fatalf("TCP Listen Error: %v", err)
 	}
-	log.Printf("GnuDIP TCP Server listening on :%d", port)
+	slog.Info("GnuDIP TCP Server listening", "port", port)
+	serveTCP(listener, newTCPLimiter(config.Current().Server))
+}
 
+// serveTCP accepts connections until the listener is closed. Connections over
+// a limit get an immediate "1" and are closed without reaching the handler.
+func serveTCP(listener net.Listener, limiter *tcpLimiter) {
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
-			log.Printf("TCP Accept Error: %v", err)
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			slog.Error("TCP accept error", "error", err)
+			continue
+		}
+		remote := conn.RemoteAddr().String()
+		ip, _, err := net.SplitHostPort(remote)
+		if err != nil {
+			ip = remote
+		}
+		if reason := limiter.acquire(ip); reason != "" {
+			metrics.countRejection(reason)
+			slog.Debug("Rejected TCP connection", "remote", remote, "limit", reason)
+			conn.SetDeadline(time.Now().Add(rejectWriteTimeout))
+			_, _ = conn.Write([]byte("1\n"))
+			conn.Close()
 			continue
 		}
-		debugLogf("Accepted TCP connection from %s", conn.RemoteAddr().String())
-		go mode.NewGnuTCPMode(debugLogf).Handle(conn)
+		metrics.tcpAccepted.Add(1)
+		metrics.tcpActive.Add(1)
+		logger := slog.With("request_id", logging.NewRequestID(), "remote", remote)
+		logger.Debug("Accepted TCP connection")
+		go func() {
+			defer func() {
+				limiter.release(ip)
+				metrics.tcpActive.Add(-1)
+			}()
+			mode.NewGnuTCPMode(logger).Handle(conn)
+		}()
 	}
 }
 
@@ -72,46 +105,140 @@ func handleDDNSUpdate(w http.ResponseWriter, r *http.Request) {
 
 func handleDDNSUpdateWithMode(w http.ResponseWriter, r *http.Request, numericResponse bool) {
 	const maxLoggedBody = 4096 // cap logged body to 4KB to prevent excessive memory usage
+	start := time.Now()
+	requestID := logging.NewRequestID()
+	logger := slog.With("request_id", requestID)
+	w.Header().Set("X-Request-ID", requestID)
+
 	limitedBody := io.LimitReader(r.Body, maxLoggedBody)
 	bodyBytes, err := io.ReadAll(limitedBody)
 	if err != nil {
-		debugLogf("HTTP request body read error after %d bytes (logging partial body): %v", len(bodyBytes), err)
+		logger.Debug("HTTP request body read error, logging partial body", "bytes", len(bodyBytes), "error", err)
 	}
 	r.Body = io.NopCloser(bytes.NewReader(bodyBytes))
-	debugLogf("HTTP request rawURL=%q auth=%q body=%q", r.URL.String(), r.Header.Get("Authorization"), string(bodyBytes))
+	logger.Debug("HTTP request", "method", r.Method, "url", mode.RedactURL(r.URL),
+		"auth", mode.RedactAuthorization(r.Header.Get("Authorization")),
+		"body", mode.RedactBody(r.Header.Get("Content-Type"), bodyBytes),
+		"remote", r.RemoteAddr)
 
 	lrw := &loggingResponseWriter{ResponseWriter: w, status: http.StatusOK}
 	var m mode.Mode
 	if numericResponse {
-		m = mode.NewGnuHTTPMode(debugLogf)
+		m = mode.NewGnuHTTPMode(logger)
 	} else {
 		switch r.URL.Path {
 		case "/nic/update":
 			if shouldUseGnuHTTPMode(r) {
-				m = mode.NewGnuHTTPMode(debugLogf)
+				m = mode.NewGnuHTTPMode(logger)
 			} else {
-				m = mode.NewDynMode(false, debugLogf)
+				m = mode.NewDynMode(false, logger)
 			}
+		case "/dyndns/update":
+			m = mode.NewQDNSMode(logger)
+		case "/api/autodns.cfm":
+			m = mode.NewDtDNSMode(logger)
+		case "/ph/update":
+			m = mode.NewOrayMode(logger)
+		case "/dynamic/update.php":
+			m = mode.NewFreeDNSMode(logger)
 		case "/dyn/generic.php", "/dyn/tomato.php", "/dyn/ez-ipupdate.php":
-			m = mode.NewEasyDNSMode(debugLogf)
+			m = mode.NewEasyDNSMode(logger)
 		default:
-			debugLogf("Unmatched HTTP path=%s method=%s defaulting to DynDNS mode", r.URL.Path, r.Method)
-			m = mode.NewDynMode(false, debugLogf)
+			if strings.HasPrefix(r.URL.Path, mode.FreeDNSV2Prefix) {
+				m = mode.NewFreeDNSMode(logger)
+				break
+			}
+			if shouldUseDuckDNSMode(r) {
+				m = mode.NewDuckDNSMode(logger)
+				break
+			}
+			if shouldUseNamecheapMode(r) {
+				m = mode.NewNamecheapMode(logger)
+				break
+			}
+			logger.Debug("Unmatched HTTP path, defaulting to DynDNS mode", "path", r.URL.Path, "method", r.Method)
+			m = mode.NewDynMode(false, logger)
 		}
 	}
-	debugLogf("Selected mode for path %s: %T", r.URL.Path, m)
+	logger.Debug("Selected mode", "mode", mode.ModeName(m), "path", r.URL.Path)
 	req, outcome := m.Prepare(r)
 	if outcome == mode.OutcomeSuccess {
-		outcome = m.Process(req)
+		outcome = processGuarded(logger, m, req, r.RemoteAddr)
 	}
 	m.Respond(lrw, req, outcome)
-	debugLogf("HTTP response status=%d body=%q", lrw.status, lrw.body.String())
+	mode.LogRequest(logger, mode.ModeName(m), req, outcome, time.Since(start), "status", lrw.status, "remote", r.RemoteAddr)
+	logger.Debug("HTTP response", "status", lrw.status, "body", mode.RedactResponse(lrw.body.String()))
+}
+
+// withRequestLog gives handlers outside the DDNS update flow a request ID and
+// a request logger carrying it (see logging.FromContext), and writes one
+// access record per request.
+func withRequestLog(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		requestID := logging.NewRequestID()
+		logger := slog.With("request_id", requestID)
+		w.Header().Set("X-Request-ID", requestID)
+		lrw := &loggingResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(lrw, r.WithContext(logging.NewContext(r.Context(), logger)))
+		logger.Info("http request", "method", r.Method, "path", r.URL.Path,
+			"status", lrw.status, "remote", r.RemoteAddr, "duration", time.Since(start))
+	})
+}
+
+// processGuarded runs Process unless the username or source IP is serving a
+// brute-force ban, and records authentication failures of requests that
+// carried credentials; any other outcome means the credentials were accepted
+// and clears the failure counts. Banned requests get the protocol's abuse response.
+func processGuarded(logger *slog.Logger, m mode.Mode, req *mode.Request, remoteAddr string) mode.Outcome {
+	g := guard.Default()
+	ip := remoteIP(remoteAddr)
+	if until, banned := g.Blocked(req.Username, ip); banned {
+		logger.Warn("Rejected update from banned client", "user", req.Username, "ip", ip, "until", until.Format(time.RFC3339))
+		return mode.OutcomeAbuse
+	}
+	outcome := m.Process(req)
+	switch {
+	case req.Password == "" && req.Sign == "":
+	case outcome == mode.OutcomeAuthFailure:
+		g.Fail(req.Username, ip)
+	default:
+		g.Succeed(req.Username, ip)
+	}
+	return outcome
+}
+
+// remoteIP strips the port from a request's RemoteAddr.
+func remoteIP(remoteAddr string) string {
+	ip, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+	return ip
 }
 
 func handleCGIUpdate(w http.ResponseWriter, r *http.Request) {
 	handleDDNSUpdateWithMode(w, r, true)
 }
 
+// shouldUseDuckDNSMode detects DuckDNS requests, which identify the user by
+// token and list hosts in domains instead of carrying credentials.
+func shouldUseDuckDNSMode(r *http.Request) bool {
+	q := r.URL.Query()
+	return mode.GetQueryParam(q, "token") != "" && mode.GetQueryParam(q, "domains") != ""
+}
+
+// shouldUseNamecheapMode detects Namecheap requests, which split the hostname
+// into host and domain and carry only a password.
+func shouldUseNamecheapMode(r *http.Request) bool {
+	q := r.URL.Query()
+	if _, _, ok := r.BasicAuth(); ok || !q.Has("host") {
+		return false
+	}
+	return mode.GetQueryParam(q, "domain") != "" && mode.GetQueryParam(q, "password") != "" &&
+		mode.GetQueryParam(q, "user", "username") == ""
+}
+
 // shouldUseGnuHTTPMode detects GnuDIP-style HTTP requests that should use the two-step
 // challenge/response flow instead of DynDNS handling (time/sign markers or user without password).
 func shouldUseGnuHTTPMode(r *http.Request) bool {
@@ -148,10 +275,15 @@ func StartHTTP(port int) {
 	http.HandleFunc("/dyn/tomato.php", handleDDNSUpdate)      // easyDNS
 	http.HandleFunc("/dyn/ez-ipupdate.php", handleDDNSUpdate) // easyDNS
 	http.HandleFunc("/api/autodns.cfm", handleDDNSUpdate)     // DtDNS
+	http.HandleFunc("/dynamic/update.php", handleDDNSUpdate)  // FreeDNS
+	http.HandleFunc(mode.FreeDNSV2Prefix, handleDDNSUpdate)   // FreeDNS v2
 	http.HandleFunc("/cgi-bin/gdipupdt.cgi", handleCGIUpdate)
+	http.Handle(mode.CloudflarePrefix, withRequestLog(mode.NewCloudflareAPI()))
+	http.HandleFunc("/metrics", handleMetrics)
+	http.Handle("/admin/bans", withRequestLog(http.HandlerFunc(handleAdminBans)))
 	http.HandleFunc("/", handleDDNSUpdate)
 
-	log.Printf("HTTP Server listening on :%d", port)
+	slog.Info("HTTP Server listening", "port", port)
 	if err := http.ListenAndServe(fmt.Sprintf(":%d", port), nil); err != nil {
 		log.Fatalf("HTTP Server Error: %v", err)
 	}
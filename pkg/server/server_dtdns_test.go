@@ -17,11 +17,11 @@ import (
 // Note: nochg and nohost are documented by Now-DNS but map to good/notfqdn in this implementation
 func TestNowDNSUpdateEndpoint(t *testing.T) {
 	// Save original config and restore after test
-	originalConfig := config.GlobalConfig
-	defer func() { config.GlobalConfig = originalConfig }()
+	originalConfig := config.Current()
+	defer config.SetCurrent(originalConfig)
 
 	// Setup test config
-	config.GlobalConfig = config.Config{
+	config.SetCurrent(&config.Config{
 		Users: []config.UserConfig{
 			{
 				Username: "user@example.com",
@@ -29,7 +29,7 @@ func TestNowDNSUpdateEndpoint(t *testing.T) {
 				Provider: "aliyun",
 			},
 		},
-	}
+	})
 
 	handler := http.HandlerFunc(handleDDNSUpdate)
 
@@ -154,7 +154,7 @@ func TestNowDNSUpdateEndpoint(t *testing.T) {
 		}
 	})
 
-	t.Run("Now-DNS format - 911 for system error (invalid provider)", func(t *testing.T) {
+	t.Run("Now-DNS format - dnserr for provider error (invalid credentials)", func(t *testing.T) {
 		req := httptest.NewRequest("GET", "/update?hostname=test.example.com&myip=1.2.3.4", nil)
 		req.SetBasicAuth("user@example.com", "api_token")
 		req.RemoteAddr = "192.168.1.100:12345"
@@ -167,9 +167,9 @@ func TestNowDNSUpdateEndpoint(t *testing.T) {
 		}
 
 		response := strings.TrimSpace(w.Body.String())
-		// With test credentials, provider will fail, returning 911
-		if response != "911" {
-			t.Errorf("Expected '911' for system error, got '%s'", response)
+		// With test credentials, the provider API call fails, returning dnserr
+		if response != "dnserr" {
+			t.Errorf("Expected 'dnserr' for provider error, got '%s'", response)
 		}
 	})
 }
@@ -177,11 +177,11 @@ func TestNowDNSUpdateEndpoint(t *testing.T) {
 // TestDtDNSModeResponseCodes tests the DtDNS mode specifically
 func TestDtDNSModeResponseCodes(t *testing.T) {
 	// Save original config and restore after test
-	originalConfig := config.GlobalConfig
-	defer func() { config.GlobalConfig = originalConfig }()
+	originalConfig := config.Current()
+	defer config.SetCurrent(originalConfig)
 
 	// Setup test config
-	config.GlobalConfig = config.Config{
+	config.SetCurrent(&config.Config{
 		Users: []config.UserConfig{
 			{
 				Username: "testuser",
@@ -189,9 +189,9 @@ func TestDtDNSModeResponseCodes(t *testing.T) {
 				Provider: "aliyun",
 			},
 		},
-	}
+	})
 
-	dynMode := mode.NewDynMode(false, debugLogf)
+	dynMode := mode.NewDynMode(false, nil)
 
 	t.Run("DtDNS mode Prepare extracts hostname from id parameter", func(t *testing.T) {
 		req := httptest.NewRequest("GET", "/api/autodns.cfm?id=test.example.com&ip=1.2.3.4", nil)
@@ -302,7 +302,7 @@ func TestDtDNSModeResponseCodes(t *testing.T) {
 		}
 	})
 
-	t.Run("DtDNS HTTP path uses DynDNS mode with Basic Auth and remote IP", func(t *testing.T) {
+	t.Run("DtDNS HTTP path uses DtDNS mode with Basic Auth and remote IP", func(t *testing.T) {
 		defer SetDebug(false)
 		SetDebug(true) // Enable debug bypass
 
@@ -317,9 +317,74 @@ func TestDtDNSModeResponseCodes(t *testing.T) {
 			t.Fatalf("Expected status 200, got %d", w.Code)
 		}
 
-		response := strings.TrimSpace(w.Body.String())
-		if !strings.HasPrefix(response, "good") {
-			t.Fatalf("Expected response starting with 'good', got %q", response)
+		response := w.Body.String()
+		if response != "Host test.example.com now points to 203.0.113.10." {
+			t.Fatalf("Expected DtDNS success sentence, got %q", response)
 		}
 	})
 }
+
+// TestDtDNSModeSentences covers the DtDNS /api/autodns.cfm replies and the
+// hostname-based account lookup used when clients send only id and pw.
+func TestDtDNSModeSentences(t *testing.T) {
+	originalConfig := config.Current()
+	defer config.SetCurrent(originalConfig)
+	config.SetCurrent(&config.Config{
+		Users: []config.UserConfig{
+			{
+				Username:   "dtuser",
+				Password:   "dtpass",
+				Provider:   "unknown",
+				OwnedHosts: []string{"*.dt.example.com"},
+			},
+		},
+	})
+
+	dtMode := mode.NewDtDNSMode(nil)
+
+	responds := []struct {
+		name    string
+		req     *mode.Request
+		outcome mode.Outcome
+		want    string
+	}{
+		{name: "success", req: &mode.Request{Domain: "host.dt.example.com", IP: "1.2.3.4"}, outcome: mode.OutcomeSuccess, want: "Host host.dt.example.com now points to 1.2.3.4."},
+		{name: "no change", req: &mode.Request{Domain: "host.dt.example.com", IP: "1.2.3.4"}, outcome: mode.OutcomeNoChange, want: "Host host.dt.example.com now points to 1.2.3.4."},
+		{name: "bad password", req: &mode.Request{Domain: "host.dt.example.com", IP: "1.2.3.4"}, outcome: mode.OutcomeAuthFailure, want: "Incorrect password for host host.dt.example.com."},
+		{name: "unknown host", req: &mode.Request{Domain: "other.example.com", IP: "1.2.3.4"}, outcome: mode.OutcomeNoHost, want: "The hostname other.example.com does not exist."},
+		{name: "invalid hostname", req: &mode.Request{}, outcome: mode.OutcomeInvalidDomain, want: "No valid hostname was specified."},
+		{name: "server error", req: &mode.Request{Domain: "host.dt.example.com", IP: "1.2.3.4"}, outcome: mode.OutcomeDNSError, want: "Server error, host host.dt.example.com was not updated."},
+	}
+	for _, tt := range responds {
+		t.Run("Respond "+tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			dtMode.Respond(w, tt.req, tt.outcome)
+			if got := w.Body.String(); got != tt.want {
+				t.Errorf("Respond() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	requests := []struct {
+		name string
+		url  string
+		want string
+	}{
+		{name: "host lookup without username", url: "/api/autodns.cfm?id=host.dt.example.com&pw=dtpass&ip=1.2.3.4", want: "Server error, host host.dt.example.com was not updated."},
+		{name: "host lookup with wrong password", url: "/api/autodns.cfm?id=host.dt.example.com&pw=wrong&ip=1.2.3.4", want: "Incorrect password for host host.dt.example.com."},
+		{name: "host not matching any user", url: "/api/autodns.cfm?id=host.other.com&pw=dtpass&ip=1.2.3.4", want: "Incorrect password for host host.other.com."},
+		{name: "idn host echoed in unicode", url: "/api/autodns.cfm?id=xn--fsqu00a.dt.example.com&pw=dtpass&ip=1.2.3.4", want: "Server error, host xn--fsqu00a.dt.example.com (例子.dt.example.com) was not updated."},
+		{name: "explicit user still accepted", url: "/api/autodns.cfm?id=host.dt.example.com&user=dtuser&pw=wrong&ip=1.2.3.4", want: "Incorrect password for host host.dt.example.com."},
+	}
+	for _, tt := range requests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.url, nil)
+			req.RemoteAddr = "10.0.0.1:1234"
+			w := httptest.NewRecorder()
+			handleDDNSUpdate(w, req)
+			if got := w.Body.String(); got != tt.want {
+				t.Errorf("response = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
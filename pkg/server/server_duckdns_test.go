@@ -0,0 +1,59 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/NewFuture/CloudDDNS/pkg/config"
+)
+
+// TestDuckDNSEndpoint covers the DuckDNS style /update?domains=&token= handler.
+func TestDuckDNSEndpoint(t *testing.T) {
+	originalConfig := config.Current()
+	defer config.SetCurrent(originalConfig)
+	config.SetCurrent(&config.Config{
+		Users: []config.UserConfig{
+			{
+				Username: "duck",
+				Password: "secret",
+				Provider: "unknown",
+				DuckDNS:  config.DuckDNSConfig{Token: "duck-token", Zone: "ddns.example.com"},
+			},
+		},
+	})
+	handler := http.HandlerFunc(handleDDNSUpdate)
+
+	tests := []struct {
+		name   string
+		url    string
+		debug  bool
+		remote string
+		want   string
+	}{
+		{name: "debug token ok", url: "/update?domains=home&token=debug&ip=1.2.3.4", debug: true, want: "OK"},
+		{name: "verbose ipv4 and ipv6", url: "/update?domains=home&token=debug&ip=1.2.3.4&ipv6=2001:db8::1&verbose=true", debug: true, want: "OK\n1.2.3.4\n2001:db8::1\nUPDATED"},
+		{name: "verbose remote address", url: "/update?domains=home&token=debug&verbose=true", debug: true, remote: "203.0.113.7:5555", want: "OK\n203.0.113.7\n\nUPDATED"},
+		{name: "verbose txt", url: "/update?domains=home&token=debug&txt=acme-value&verbose=true", debug: true, want: "OK\nacme-value\n\nUPDATED"},
+		{name: "unknown token", url: "/update?domains=home&token=wrong&ip=1.2.3.4", want: "KO"},
+		{name: "invalid ip", url: "/update?domains=home&token=duck-token&ip=not-an-ip", want: "KO"},
+		{name: "invalid name", url: "/update?domains=-bad&token=duck-token&ip=1.2.3.4", want: "KO"},
+		{name: "provider failure", url: "/update?domains=home&token=duck-token&ip=1.2.3.4", want: "KO"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetDebug(tt.debug)
+			defer SetDebug(false)
+			req := httptest.NewRequest("GET", tt.url, nil)
+			if tt.remote != "" {
+				req.RemoteAddr = tt.remote
+			}
+			w := httptest.NewRecorder()
+			handler(w, req)
+			if got := w.Body.String(); got != tt.want {
+				t.Fatalf("response = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,8 +1,12 @@
 package server
 
 import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"strings"
 	"testing"
 
@@ -33,13 +37,13 @@ func TestDynDNSEndpoint(t *testing.T) {
 }
 
 func TestDynDNSAuthAndValidation(t *testing.T) {
-	originalConfig := config.GlobalConfig
-	defer func() { config.GlobalConfig = originalConfig }()
-	config.GlobalConfig = config.Config{
+	originalConfig := config.Current()
+	defer config.SetCurrent(originalConfig)
+	config.SetCurrent(&config.Config{
 		Users: []config.UserConfig{
 			{Username: "user", Password: "pass", Provider: "aliyun"},
 		},
-	}
+	})
 	handler := http.HandlerFunc(handleDDNSUpdate)
 
 	t.Run("auth failure wrong password", func(t *testing.T) {
@@ -72,6 +76,98 @@ func TestDynDNSAuthAndValidation(t *testing.T) {
 		}
 	})
 
+	t.Run("invalid hostname label", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/update?hostname=-cam.example.com&myip=1.2.3.4", nil)
+		req.SetBasicAuth("user", "pass")
+		w := httptest.NewRecorder()
+		handler(w, req)
+		if strings.TrimSpace(w.Body.String()) != "notfqdn" {
+			t.Fatalf("expected notfqdn for invalid label, got %q", w.Body.String())
+		}
+	})
+
+	t.Run("internationalized hostname", func(t *testing.T) {
+		defer SetDebug(false)
+		SetDebug(true)
+		req := httptest.NewRequest("GET", "/update?hostname="+url.QueryEscape("摄像头.例子.中国")+"&myip=1.2.3.4", nil)
+		req.SetBasicAuth("debug", "debug")
+		w := httptest.NewRecorder()
+		handler(w, req)
+		if resp := strings.TrimSpace(w.Body.String()); resp != "good 1.2.3.4" {
+			t.Fatalf("expected good for IDN hostname, got %q", resp)
+		}
+	})
+
+	t.Run("multiple hostnames one line per host", func(t *testing.T) {
+		defer SetDebug(false)
+		SetDebug(true)
+		req := httptest.NewRequest("GET", "/nic/update?hostname=a.example.com,b.example.com&myip=1.2.3.4", nil)
+		req.SetBasicAuth("debug", "debug")
+		w := httptest.NewRecorder()
+		handler(w, req)
+		if resp := w.Body.String(); resp != "good 1.2.3.4\ngood 1.2.3.4" {
+			t.Fatalf("expected one good line per host, got %q", resp)
+		}
+	})
+
+	t.Run("multiple hostnames with invalid entry", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/nic/update?hostname=a.example.com,-bad.example.com&myip=1.2.3.4", nil)
+		req.SetBasicAuth("user", "pass")
+		w := httptest.NewRecorder()
+		handler(w, req)
+		if strings.TrimSpace(w.Body.String()) != "notfqdn" {
+			t.Fatalf("expected notfqdn when any hostname is invalid, got %q", w.Body.String())
+		}
+	})
+
+	t.Run("too many hostnames", func(t *testing.T) {
+		hosts := make([]string, 21)
+		for i := range hosts {
+			hosts[i] = fmt.Sprintf("h%d.example.com", i)
+		}
+		req := httptest.NewRequest("GET", "/nic/update?hostname="+strings.Join(hosts, ",")+"&myip=1.2.3.4", nil)
+		req.SetBasicAuth("user", "pass")
+		w := httptest.NewRecorder()
+		handler(w, req)
+		if strings.TrimSpace(w.Body.String()) != "numhost" {
+			t.Fatalf("expected numhost, got %q", w.Body.String())
+		}
+	})
+
+	t.Run("wildcard without permission", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/nic/update?hostname=*.example.com&myip=1.2.3.4", nil)
+		req.SetBasicAuth("user", "pass")
+		w := httptest.NewRecorder()
+		handler(w, req)
+		if strings.TrimSpace(w.Body.String()) != "!donator" {
+			t.Fatalf("expected !donator, got %q", w.Body.String())
+		}
+	})
+
+	t.Run("blocked user", func(t *testing.T) {
+		updateFirstUser(t, func(u *config.UserConfig) { u.Blocked = true })
+		req := httptest.NewRequest("GET", "/nic/update?hostname=test.example.com&myip=1.2.3.4", nil)
+		req.SetBasicAuth("user", "pass")
+		w := httptest.NewRecorder()
+		handler(w, req)
+		if strings.TrimSpace(w.Body.String()) != "abuse" {
+			t.Fatalf("expected abuse, got %q", w.Body.String())
+		}
+	})
+
+	t.Run("missing user agent when required", func(t *testing.T) {
+		defer func() { config.Current().Server.RequireUserAgent = false }()
+		config.Current().Server.RequireUserAgent = true
+		req := httptest.NewRequest("GET", "/nic/update?hostname=test.example.com&myip=1.2.3.4", nil)
+		req.SetBasicAuth("user", "pass")
+		req.Header.Del("User-Agent")
+		w := httptest.NewRecorder()
+		handler(w, req)
+		if strings.TrimSpace(w.Body.String()) != "badagent" {
+			t.Fatalf("expected badagent, got %q", w.Body.String())
+		}
+	})
+
 	t.Run("missing domain", func(t *testing.T) {
 		req := httptest.NewRequest("GET", "/update?myip=1.2.3.4", nil)
 		req.SetBasicAuth("user", "pass")
@@ -83,9 +179,7 @@ func TestDynDNSAuthAndValidation(t *testing.T) {
 	})
 
 	t.Run("system error provider failure", func(t *testing.T) {
-		originalProvider := config.GlobalConfig.Users[0].Provider
-		defer func() { config.GlobalConfig.Users[0].Provider = originalProvider }()
-		config.GlobalConfig.Users[0].Provider = "unknown"
+		updateFirstUser(t, func(u *config.UserConfig) { u.Provider = "unknown" })
 		req := httptest.NewRequest("GET", "/update?hostname=test.example.com&myip=1.2.3.4", nil)
 		req.SetBasicAuth("user", "pass")
 		w := httptest.NewRecorder()
@@ -109,3 +203,72 @@ func TestDynDNSAuthAndValidation(t *testing.T) {
 		}
 	})
 }
+
+// TestDynDNSHostKeys covers Hurricane Electric style updates, where the
+// username is the hostname (or omitted) and the password is its update key.
+func TestDynDNSHostKeys(t *testing.T) {
+	originalConfig := config.Current()
+	defer config.SetCurrent(originalConfig)
+	config.SetCurrent(&config.Config{
+		Users: []config.UserConfig{
+			{
+				Username: "account",
+				Password: "account-secret",
+				Provider: "unknown",
+				HostKeys: []config.HostKeyConfig{{Host: "dyn.example.com", Key: "host-key"}},
+			},
+			{
+				Username:        "hashed",
+				Password:        "secret",
+				Provider:        "unknown",
+				PasswordHash:    "$2a$10$abcdefghijklmnopqrstuuABCDEFGHIJKLMNOPQRSTUVWXYZ01234",
+				PasswordSchemes: []string{config.SchemeBcrypt},
+				HostKeys:        []config.HostKeyConfig{{Host: "nas.example.com", Key: "nas-key"}},
+			},
+			{
+				Username: "blocked",
+				Password: "secret",
+				Provider: "unknown",
+				Blocked:  true,
+				HostKeys: []config.HostKeyConfig{{Host: "cam.example.com", Key: "cam-key"}},
+			},
+		},
+	})
+	handler := http.HandlerFunc(handleDDNSUpdate)
+	sum := md5.Sum([]byte("host-key"))
+	keyMD5 := hex.EncodeToString(sum[:])
+
+	tests := []struct {
+		name      string
+		url       string
+		basicUser string
+		basicPass string
+		want      string
+	}{
+		// Provider "unknown" fails after authentication, so an accepted key yields 911.
+		{name: "username is hostname", url: "/nic/update?hostname=dyn.example.com&myip=1.2.3.4", basicUser: "dyn.example.com", basicPass: "host-key", want: "911"},
+		{name: "hostname and password only", url: "/nic/update?hostname=dyn.example.com&password=host-key&myip=1.2.3.4", want: "911"},
+		{name: "wrong host key", url: "/nic/update?hostname=dyn.example.com&myip=1.2.3.4", basicUser: "dyn.example.com", basicPass: "wrong", want: "badauth"},
+		{name: "key of another host", url: "/nic/update?hostname=www.example.com&myip=1.2.3.4", basicUser: "www.example.com", basicPass: "host-key", want: "badauth"},
+		{name: "key cannot update other hosts", url: "/nic/update?hostname=dyn.example.com,www.example.com&password=host-key&myip=1.2.3.4", want: "badauth"},
+		{name: "account credentials still work", url: "/nic/update?hostname=dyn.example.com&myip=1.2.3.4", basicUser: "account", basicPass: "account-secret", want: "911"},
+		// Host keys are compared as plain secrets whatever the owner's password schemes.
+		{name: "host key of bcrypt-only user", url: "/nic/update?hostname=nas.example.com&password=nas-key&myip=1.2.3.4", want: "911"},
+		{name: "md5 of host key is not the key", url: "/nic/update?hostname=dyn.example.com&password=" + keyMD5 + "&myip=1.2.3.4", want: "badauth"},
+		{name: "blocked owner", url: "/nic/update?hostname=cam.example.com&myip=1.2.3.4", basicUser: "cam.example.com", basicPass: "cam-key", want: "abuse"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.url, nil)
+			if tt.basicUser != "" {
+				req.SetBasicAuth(tt.basicUser, tt.basicPass)
+			}
+			w := httptest.NewRecorder()
+			handler(w, req)
+			if got := strings.TrimSpace(w.Body.String()); got != tt.want {
+				t.Fatalf("response = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
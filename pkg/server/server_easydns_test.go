@@ -10,10 +10,10 @@ import (
 )
 
 func TestEasyDNSHostIDParameterWithProviderError(t *testing.T) {
-	originalConfig := config.GlobalConfig
-	defer func() { config.GlobalConfig = originalConfig }()
+	originalConfig := config.Current()
+	defer config.SetCurrent(originalConfig)
 
-	config.GlobalConfig = config.Config{
+	config.SetCurrent(&config.Config{
 		Users: []config.UserConfig{
 			{
 				Username: "testuser",
@@ -21,7 +21,7 @@ func TestEasyDNSHostIDParameterWithProviderError(t *testing.T) {
 				Provider: "aliyun",
 			},
 		},
-	}
+	})
 
 	handler := http.HandlerFunc(handleDDNSUpdate)
 
@@ -41,10 +41,10 @@ func TestEasyDNSHostIDParameterWithProviderError(t *testing.T) {
 }
 
 func TestEasyDNSResponseCodes(t *testing.T) {
-	originalConfig := config.GlobalConfig
-	defer func() { config.GlobalConfig = originalConfig }()
+	originalConfig := config.Current()
+	defer config.SetCurrent(originalConfig)
 
-	config.GlobalConfig = config.Config{
+	config.SetCurrent(&config.Config{
 		Users: []config.UserConfig{
 			{
 				Username: "user",
@@ -52,7 +52,7 @@ func TestEasyDNSResponseCodes(t *testing.T) {
 				Provider: "aliyun",
 			},
 		},
-	}
+	})
 
 	handler := http.HandlerFunc(handleDDNSUpdate)
 
@@ -79,8 +79,8 @@ func TestEasyDNSResponseCodes(t *testing.T) {
 	})
 
 	t.Run("Provider error", func(t *testing.T) {
-		originalConfigForProvider := config.GlobalConfig
-		config.GlobalConfig = config.Config{
+		originalConfigForProvider := config.Current()
+		config.SetCurrent(&config.Config{
 			Users: []config.UserConfig{
 				{
 					Username: "user",
@@ -88,8 +88,8 @@ func TestEasyDNSResponseCodes(t *testing.T) {
 					Provider: "unknown",
 				},
 			},
-		}
-		defer func() { config.GlobalConfig = originalConfigForProvider }()
+		})
+		defer config.SetCurrent(originalConfigForProvider)
 
 		req := httptest.NewRequest("GET", "/dyn/generic.php?user=user&pass=pass&hostname=test.example.com&myip=1.2.3.4", nil)
 		w := httptest.NewRecorder()
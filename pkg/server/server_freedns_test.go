@@ -0,0 +1,79 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/NewFuture/CloudDDNS/pkg/config"
+	"github.com/NewFuture/CloudDDNS/pkg/state"
+)
+
+// TestFreeDNSEndpoint covers the legacy /dynamic/update.php?<token> and the
+// v2 /u/<token>/ forms.
+func TestFreeDNSEndpoint(t *testing.T) {
+	originalConfig := config.Current()
+	originalState := state.Default()
+	defer func() {
+		config.SetCurrent(originalConfig)
+		state.SetDefault(originalState)
+	}()
+	config.SetCurrent(&config.Config{
+		Users: []config.UserConfig{
+			{Username: "free", Password: "secret", Provider: "unknown"},
+			{Username: "blocked", Password: "secret", Provider: "unknown", Blocked: true},
+		},
+	})
+
+	store, err := state.Open(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatalf("state.Open() error = %v", err)
+	}
+	state.SetDefault(store)
+	token, err := store.IssueFreeDNSToken("free", "home.example.com")
+	if err != nil {
+		t.Fatalf("IssueFreeDNSToken() error = %v", err)
+	}
+	blockedToken, err := store.IssueFreeDNSToken("blocked", "cam.example.com")
+	if err != nil {
+		t.Fatalf("IssueFreeDNSToken() error = %v", err)
+	}
+	orphanToken, err := store.IssueFreeDNSToken("removed", "old.example.com")
+	if err != nil {
+		t.Fatalf("IssueFreeDNSToken() error = %v", err)
+	}
+
+	handler := http.HandlerFunc(handleDDNSUpdate)
+	tests := []struct {
+		name       string
+		url        string
+		debug      bool
+		wantPrefix string
+	}{
+		{name: "legacy debug token", url: "/dynamic/update.php?debug&address=1.2.3.4", debug: true, wantPrefix: "Updated debug to 1.2.3.4 in "},
+		{name: "v2 debug token", url: "/u/debug/?ip=2001:db8::1", debug: true, wantPrefix: "Updated debug to 2001:db8::1 in "},
+		{name: "v2 remote address", url: "/u/debug/", debug: true, wantPrefix: "Updated debug to 192.0.2.1 in "},
+		{name: "missing token", url: "/dynamic/update.php", wantPrefix: "ERROR: Unable to locate this record"},
+		{name: "unknown token", url: "/u/not-a-token/", wantPrefix: "ERROR: Unable to locate this record"},
+		{name: "token of removed user", url: "/u/" + orphanToken + "/", wantPrefix: "ERROR: Unable to locate this record"},
+		{name: "invalid address", url: "/dynamic/update.php?" + token + "&address=bogus", wantPrefix: "ERROR: Invalid address"},
+		{name: "blocked user", url: "/u/" + blockedToken + "/", wantPrefix: "ERROR: Host cam.example.com has been blocked"},
+		{name: "provider failure", url: "/dynamic/update.php?" + token + "&address=1.2.3.4", wantPrefix: "ERROR: Unable to update home.example.com, please try again later"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetDebug(tt.debug)
+			defer SetDebug(false)
+			req := httptest.NewRequest("GET", tt.url, nil)
+			req.RemoteAddr = "192.0.2.1:4000"
+			w := httptest.NewRecorder()
+			handler(w, req)
+			if got := w.Body.String(); !strings.HasPrefix(got, tt.wantPrefix) {
+				t.Fatalf("response = %q, want prefix %q", got, tt.wantPrefix)
+			}
+		})
+	}
+}
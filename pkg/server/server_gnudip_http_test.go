@@ -13,10 +13,10 @@ import (
 )
 
 func TestGnuDIPHTTPHandlers(t *testing.T) {
-	originalConfig := config.GlobalConfig
-	defer func() { config.GlobalConfig = originalConfig }()
+	originalConfig := config.Current()
+	defer config.SetCurrent(originalConfig)
 
-	config.GlobalConfig = config.Config{
+	config.SetCurrent(&config.Config{
 		Users: []config.UserConfig{
 			{
 				Username: "testuser",
@@ -24,7 +24,7 @@ func TestGnuDIPHTTPHandlers(t *testing.T) {
 				Provider: "aliyun",
 			},
 		},
-	}
+	})
 
 	handler := http.HandlerFunc(handleDDNSUpdate)
 	cgiHandler := http.HandlerFunc(handleCGIUpdate)
@@ -96,11 +96,13 @@ func TestGnuDIPHTTPHandlers(t *testing.T) {
 	})
 
 	t.Run("GnuDIP HTTP second step with salt-based pass", func(t *testing.T) {
-		timeParam := "1234567890"
-		salt := "abcdefghij"
+		challenge := httptest.NewRecorder()
+		handler(challenge, httptest.NewRequest("GET", "/nic/update?user=testuser&domn=test.example.com", nil))
+		timeParam := getMetaContent(challenge.Body.String(), "time")
+		salt := getMetaContent(challenge.Body.String(), "salt")
+		sign := getMetaContent(challenge.Body.String(), "sign")
 		inner := md5.Sum([]byte("testpass"))
 		pass := fmt.Sprintf("%x", md5.Sum([]byte(fmt.Sprintf("%x.%s", inner, salt))))
-		sign := fmt.Sprintf("%x", md5.Sum([]byte(fmt.Sprintf("%s:%s:%s", "testuser", timeParam, "testpass"))))
 		req := httptest.NewRequest("GET", fmt.Sprintf("/nic/update?user=testuser&domn=test.example.com&time=%s&sign=%s&salt=%s&pass=%s&addr=1.2.3.4", timeParam, sign, salt, pass), nil)
 		req.RemoteAddr = "203.0.113.10:4321"
 		w := httptest.NewRecorder()
@@ -111,7 +113,7 @@ func TestGnuDIPHTTPHandlers(t *testing.T) {
 			t.Fatalf("Expected status 200, got %d", w.Code)
 		}
 
-		response := strings.TrimSpace(w.Body.String())
+		response := getMetaContent(w.Body.String(), "retc")
 		if response == "badauth" {
 			t.Fatalf("Expected GnuDIP processing, got DynDNS auth failure response")
 		}
@@ -120,6 +122,21 @@ func TestGnuDIPHTTPHandlers(t *testing.T) {
 		}
 	})
 
+	t.Run("GnuDIP HTTP second step with forged challenge fails", func(t *testing.T) {
+		timeParam := "1234567890"
+		salt := "abcdefghij"
+		inner := md5.Sum([]byte("testpass"))
+		pass := fmt.Sprintf("%x", md5.Sum([]byte(fmt.Sprintf("%x.%s", inner, salt))))
+		req := httptest.NewRequest("GET", fmt.Sprintf("/nic/update?user=testuser&domn=test.example.com&time=%s&salt=%s&pass=%s&addr=1.2.3.4", timeParam, salt, pass), nil)
+		w := httptest.NewRecorder()
+
+		handler(w, req)
+
+		if response := getMetaContent(w.Body.String(), "retc"); response != "1" {
+			t.Fatalf("Expected GnuDIP failure code '1' for a challenge the server never issued, got '%s'", response)
+		}
+	})
+
 	t.Run("GnuDIP HTTP second step with salt but wrong sign fails", func(t *testing.T) {
 		timeParam := "1234567890"
 		salt := "abcdefghij"
@@ -135,7 +152,7 @@ func TestGnuDIPHTTPHandlers(t *testing.T) {
 			t.Fatalf("Expected status 200, got %d", w.Code)
 		}
 
-		response := strings.TrimSpace(w.Body.String())
+		response := getMetaContent(w.Body.String(), "retc")
 		if response != "1" {
 			t.Fatalf("Expected auth failure numeric '1', got '%s'", response)
 		}
@@ -151,7 +168,7 @@ func TestGnuDIPHTTPHandlers(t *testing.T) {
 			t.Fatalf("Expected status 200, got %d", w.Code)
 		}
 
-		response := strings.TrimSpace(w.Body.String())
+		response := getMetaContent(w.Body.String(), "retc")
 		if response != "0" && response != "1" {
 			t.Fatalf("Expected numeric '0' or '1', got '%s'", response)
 		}
@@ -168,7 +185,7 @@ func TestGnuDIPHTTPHandlers(t *testing.T) {
 			t.Fatalf("Expected status 200, got %d", w.Code)
 		}
 
-		response := strings.TrimSpace(w.Body.String())
+		response := getMetaContent(w.Body.String(), "retc")
 		if response != "0" && response != "1" && response != "2" {
 			t.Fatalf("Expected numeric response, got '%s'", response)
 		}
@@ -185,7 +202,7 @@ func TestGnuDIPHTTPHandlers(t *testing.T) {
 			t.Fatalf("Expected status 200, got %d", w.Code)
 		}
 
-		response := strings.TrimSpace(w.Body.String())
+		response := getMetaContent(w.Body.String(), "retc")
 		if response != "0" && response != "1" {
 			t.Fatalf("Expected numeric '0' or '1', got '%s'", response)
 		}
@@ -209,9 +226,9 @@ func TestGnuDIPHTTPHandlers(t *testing.T) {
 			!strings.Contains(response, `<meta name="addr"`) {
 			t.Fatalf("Expected challenge response with salt/time/addr meta tags, got '%s'", response)
 		}
-		// sign might be empty if no user provided, so we check it's present but allow empty
-		if !strings.Contains(response, `<meta name="sign"`) {
-			t.Fatalf("Expected sign meta tag (even if empty), got '%s'", response)
+		// The sign is issued even without a user, so it reveals nothing about accounts.
+		if getMetaContent(response, "sign") == "" {
+			t.Fatalf("Expected a sign meta tag, got '%s'", response)
 		}
 	})
 
@@ -265,7 +282,7 @@ func TestGnuDIPHTTPHandlers(t *testing.T) {
 			t.Fatalf("Step 2: Expected status 200, got %d", w2.Code)
 		}
 
-		response2 := strings.TrimSpace(w2.Body.String())
+		response2 := getMetaContent(w2.Body.String(), "retc")
 		t.Logf("Step 2 response: %s", response2)
 
 		// Should return numeric code (0=success, 1=failure, 2=offline)
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NewFuture/CloudDDNS/pkg/config"
+	"github.com/NewFuture/CloudDDNS/pkg/guard"
+)
+
+func TestAuthGuardBansAndAdmin(t *testing.T) {
+	originalConfig := config.Current()
+	defer config.SetCurrent(originalConfig)
+	defer guard.SetDefault(guard.Default())
+
+	config.SetCurrent(&config.Config{
+		Server: config.ServerConfig{AdminToken: "admin-secret"},
+		Users:  []config.UserConfig{{Username: "testuser", Password: "testpass", Provider: "unknown"}},
+	})
+	guard.SetDefault(guard.New(guard.Policy{MaxFailures: 2, Ban: time.Minute, MaxBan: time.Hour, Window: time.Hour}))
+
+	update := func(path string) string {
+		req := httptest.NewRequest("GET", path, nil)
+		req.RemoteAddr = "198.51.100.7:5555"
+		w := httptest.NewRecorder()
+		handleDDNSUpdate(w, req)
+		return strings.TrimSpace(w.Body.String())
+	}
+	admin := func(method, query, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/admin/bans"+query, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		handleAdminBans(w, req)
+		return w
+	}
+
+	// A GnuDIP handshake carries no credentials and must not count as a failure.
+	for i := 0; i < 3; i++ {
+		update("/nic/update?user=testuser&domn=test.example.com")
+	}
+	if bans := guard.Default().Bans(); len(bans) != 0 {
+		t.Fatalf("handshakes should not be counted, got bans %+v", bans)
+	}
+
+	wrong := "/nic/update?user=testuser&pass=wrong&hostname=test.example.com&myip=1.2.3.4"
+	for i := 0; i < 2; i++ {
+		if got := update(wrong); got != "badauth" {
+			t.Fatalf("failure %d: expected badauth, got %q", i+1, got)
+		}
+	}
+	if got := update("/nic/update?user=testuser&pass=testpass&hostname=test.example.com&myip=1.2.3.4"); got != "abuse" {
+		t.Fatalf("banned user with the right password: expected abuse, got %q", got)
+	}
+	if got := update("/update?user=other&pass=x&hostname=test.example.com&myip=1.2.3.4"); got != "abuse" {
+		t.Fatalf("banned source IP on another path: expected abuse, got %q", got)
+	}
+
+	if w := admin("GET", "", ""); w.Code != http.StatusUnauthorized {
+		t.Fatalf("admin without token: status %d, want 401", w.Code)
+	}
+	w := admin("GET", "", "admin-secret")
+	var listed struct {
+		Bans []guard.Ban `json:"bans"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &listed); err != nil {
+		t.Fatalf("decode bans: %v (%s)", err, w.Body.String())
+	}
+	if len(listed.Bans) != 2 || listed.Bans[0].Key != "ip:198.51.100.7" || listed.Bans[1].Key != "user:testuser" {
+		t.Fatalf("listed bans = %+v", listed.Bans)
+	}
+
+	if w := admin("DELETE", "?ip=198.51.100.7", "admin-secret"); !strings.Contains(w.Body.String(), `"cleared":1`) {
+		t.Fatalf("clear ip: %s", w.Body.String())
+	}
+	if w := admin("DELETE", "", "admin-secret"); !strings.Contains(w.Body.String(), `"cleared":1`) {
+		t.Fatalf("clear all: %s", w.Body.String())
+	}
+	if got := update("/nic/update?user=testuser&pass=testpass&hostname=test.example.com&myip=1.2.3.4"); got == "abuse" {
+		t.Fatal("request should be allowed again after clearing bans")
+	}
+
+	// Wrong admin tokens are throttled like update credentials.
+	for i := 0; i < 2; i++ {
+		if w := admin("GET", "", "guess"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("wrong admin token %d: status %d, want 401", i+1, w.Code)
+		}
+	}
+	if w := admin("GET", "", "admin-secret"); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("banned admin source: status %d, want 429", w.Code)
+	}
+
+	config.Current().Server.AdminToken = ""
+	if w := admin("GET", "", "admin-secret"); w.Code != http.StatusNotFound {
+		t.Fatalf("admin without configured token: status %d, want 404", w.Code)
+	}
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/NewFuture/CloudDDNS/pkg/config"
+)
+
+// TestNamecheapEndpoint covers /update?host=&domain=&password=&ip= requests and
+// their <interface-response> XML replies.
+func TestNamecheapEndpoint(t *testing.T) {
+	originalConfig := config.Current()
+	defer config.SetCurrent(originalConfig)
+	config.SetCurrent(&config.Config{
+		Users: []config.UserConfig{
+			{
+				Username:   "nc",
+				Password:   "ddns-pass",
+				Provider:   "unknown",
+				OwnedHosts: []string{"*.example.com", "example.com"},
+			},
+		},
+	})
+	handler := http.HandlerFunc(handleDDNSUpdate)
+
+	tests := []struct {
+		name    string
+		url     string
+		debug   bool
+		wantErr string
+		wantIP  string
+	}{
+		{name: "debug password", url: "/update?host=www&domain=example.com&password=debug&ip=1.2.3.4", debug: true, wantIP: "1.2.3.4"},
+		{name: "apex host", url: "/update?host=@&domain=example.com&password=debug", debug: true, wantIP: "192.0.2.1"},
+		{name: "wrong password", url: "/update?host=www&domain=example.com&password=wrong&ip=1.2.3.4", wantErr: "Passwords do not match", wantIP: "1.2.3.4"},
+		{name: "host outside owned hosts", url: "/update?host=www&domain=example.org&password=ddns-pass&ip=1.2.3.4", wantErr: "Passwords do not match", wantIP: "1.2.3.4"},
+		{name: "invalid domain", url: "/update?host=www&domain=-bad&password=ddns-pass&ip=1.2.3.4", wantErr: "Domain name not found", wantIP: "1.2.3.4"},
+		{name: "provider failure", url: "/update?host=www&domain=example.com&password=ddns-pass&ip=1.2.3.4", wantErr: "An unexpected error has occurred", wantIP: "1.2.3.4"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetDebug(tt.debug)
+			defer SetDebug(false)
+			req := httptest.NewRequest("GET", tt.url, nil)
+			req.RemoteAddr = "192.0.2.1:4000"
+			w := httptest.NewRecorder()
+			handler(w, req)
+
+			var resp struct {
+				XMLName  xml.Name `xml:"interface-response"`
+				IP       string   `xml:"IP"`
+				ErrCount int      `xml:"ErrCount"`
+				Err1     string   `xml:"errors>Err1"`
+				Done     bool     `xml:"Done"`
+			}
+			if err := xml.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("invalid XML response %q: %v", w.Body.String(), err)
+			}
+			wantCount := 0
+			if tt.wantErr != "" {
+				wantCount = 1
+			}
+			if resp.ErrCount != wantCount || resp.Err1 != tt.wantErr || !resp.Done || resp.IP != tt.wantIP {
+				t.Fatalf("response = %+v, want ErrCount=%d Err1=%q IP=%s Done=true", resp, wantCount, tt.wantErr, tt.wantIP)
+			}
+		})
+	}
+}
+
+// TestShouldUseNamecheapMode checks that DynDNS requests sharing the /update
+// path are not mistaken for Namecheap ones.
+func TestShouldUseNamecheapMode(t *testing.T) {
+	tests := []struct {
+		url       string
+		basicAuth bool
+		want      bool
+	}{
+		{url: "/update?host=@&domain=example.com&password=p", want: true},
+		{url: "/update?host=www&domain=example.com&password=p&ip=1.2.3.4", want: true},
+		{url: "/update?domain=www.example.com&password=p", want: false},
+		{url: "/update?host=www&domain=example.com&username=u&password=p", want: false},
+		{url: "/update?host=www&domain=example.com&password=p", basicAuth: true, want: false},
+		{url: "/update?hostname=www.example.com&myip=1.2.3.4", want: false},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.url, nil)
+		if tt.basicAuth {
+			req.SetBasicAuth("u", "p")
+		}
+		if got := shouldUseNamecheapMode(req); got != tt.want {
+			t.Errorf("shouldUseNamecheapMode(%s) = %t, want %t", tt.url, got, tt.want)
+		}
+	}
+}
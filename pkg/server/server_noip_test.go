@@ -11,10 +11,10 @@ import (
 
 // TestNoIPNicUpdate verifies authentication failure handling on the No-IP /nic/update endpoint.
 func TestNoIPNicUpdate(t *testing.T) {
-	originalConfig := config.GlobalConfig
-	defer func() { config.GlobalConfig = originalConfig }()
+	originalConfig := config.Current()
+	defer config.SetCurrent(originalConfig)
 
-	config.GlobalConfig = config.Config{
+	config.SetCurrent(&config.Config{
 		Users: []config.UserConfig{
 			{
 				Username: "noipuser",
@@ -22,7 +22,7 @@ func TestNoIPNicUpdate(t *testing.T) {
 				Provider: "aliyun",
 			},
 		},
-	}
+	})
 
 	handler := http.HandlerFunc(handleDDNSUpdate)
 	req := httptest.NewRequest("GET", "/nic/update?hostname=test.example.com&myip=1.2.3.4", nil)
@@ -43,14 +43,14 @@ func TestNoIPNicUpdate(t *testing.T) {
 }
 
 func TestNoIPNicUpdateAdditionalBehaviors(t *testing.T) {
-	originalConfig := config.GlobalConfig
-	defer func() { config.GlobalConfig = originalConfig }()
+	originalConfig := config.Current()
+	defer config.SetCurrent(originalConfig)
 
-	config.GlobalConfig = config.Config{
+	config.SetCurrent(&config.Config{
 		Users: []config.UserConfig{
 			{Username: "user", Password: "pass", Provider: "aliyun"},
 		},
-	}
+	})
 	handler := http.HandlerFunc(handleDDNSUpdate)
 
 	t.Run("success with debug bypass", func(t *testing.T) {
@@ -91,9 +91,7 @@ func TestNoIPNicUpdateAdditionalBehaviors(t *testing.T) {
 	})
 
 	t.Run("provider error returns 911", func(t *testing.T) {
-		originalProvider := config.GlobalConfig.Users[0].Provider
-		defer func() { config.GlobalConfig.Users[0].Provider = originalProvider }()
-		config.GlobalConfig.Users[0].Provider = "unknown"
+		updateFirstUser(t, func(u *config.UserConfig) { u.Provider = "unknown" })
 		req := httptest.NewRequest("GET", "/nic/update?hostname=test.example.com&myip=1.2.3.4", nil)
 		req.SetBasicAuth("user", "pass")
 		w := httptest.NewRecorder()
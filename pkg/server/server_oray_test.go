@@ -3,10 +3,10 @@ package server
 import (
 	"net/http"
 	"net/http/httptest"
-	"strings"
 	"testing"
 
 	"github.com/NewFuture/CloudDDNS/pkg/config"
+	"github.com/NewFuture/CloudDDNS/pkg/server/mode"
 )
 
 // testMethods is a helper to test both GET and POST methods
@@ -22,11 +22,11 @@ func testMethods(t *testing.T, testFunc func(t *testing.T, method string)) {
 // TestOrayEndpoint tests the /ph/update endpoint specific to Oray protocol
 func TestOrayEndpoint(t *testing.T) {
 	// Save original config and restore after test
-	originalConfig := config.GlobalConfig
-	defer func() { config.GlobalConfig = originalConfig }()
+	originalConfig := config.Current()
+	defer config.SetCurrent(originalConfig)
 
 	// Setup test config
-	config.GlobalConfig = config.Config{
+	config.SetCurrent(&config.Config{
 		Users: []config.UserConfig{
 			{
 				Username: "testuser",
@@ -34,7 +34,7 @@ func TestOrayEndpoint(t *testing.T) {
 				Provider: "aliyun",
 			},
 		},
-	}
+	})
 
 	// Create a test HTTP handler using the actual handleDDNSUpdate
 	handler := http.HandlerFunc(handleDDNSUpdate)
@@ -53,9 +53,9 @@ func TestOrayEndpoint(t *testing.T) {
 			}
 
 			response := w.Body.String()
-			// Should return "911" or "good" prefix (911 because test credentials don't have real provider access)
-			if response != "911" && !strings.HasPrefix(response, "good ") && response != "good" {
-				t.Errorf("Expected '911' or 'good' prefix, got '%s'", response)
+			// Oray has no dnserr code: provider API failures with test credentials report 911
+			if response != "911" {
+				t.Errorf("Expected '911', got '%s'", response)
 			}
 		})
 	})
@@ -73,8 +73,8 @@ func TestOrayEndpoint(t *testing.T) {
 			}
 
 			response := w.Body.String()
-			if response != "911" && !strings.HasPrefix(response, "good ") && response != "good" {
-				t.Errorf("Expected '911' or 'good' prefix, got '%s'", response)
+			if response != "911" {
+				t.Errorf("Expected '911', got '%s'", response)
 			}
 		})
 	})
@@ -92,9 +92,9 @@ func TestOrayEndpoint(t *testing.T) {
 			}
 
 			response := w.Body.String()
-			// Should NOT return notfqdn since hostname should be recognized
-			if response == "notfqdn" {
-				t.Errorf("Expected to parse 'hostname' parameter correctly, got 'notfqdn'")
+			// hostname is recognized, so the request reaches the provider (911 with test credentials)
+			if response != "911" {
+				t.Errorf("Expected to parse 'hostname' parameter correctly, got '%s'", response)
 			}
 		})
 	})
@@ -113,8 +113,8 @@ func TestOrayEndpoint(t *testing.T) {
 
 			response := w.Body.String()
 			// Should process the request (will fail at provider level with 911, but not at parameter parsing)
-			if response == "notfqdn" {
-				t.Errorf("Expected to parse parameters correctly, got 'notfqdn'")
+			if response != "911" {
+				t.Errorf("Expected to parse parameters correctly, got '%s'", response)
 			}
 		})
 	})
@@ -134,8 +134,8 @@ func TestOrayEndpoint(t *testing.T) {
 
 			response := w.Body.String()
 			// Should attempt to use RemoteAddr IP
-			if response == "notfqdn" {
-				t.Errorf("Expected to auto-detect IP from RemoteAddr, got 'notfqdn'")
+			if response != "911" {
+				t.Errorf("Expected to auto-detect IP from RemoteAddr, got '%s'", response)
 			}
 		})
 	})
@@ -221,14 +221,10 @@ func TestOrayEndpoint(t *testing.T) {
 
 			handler(w, req)
 
-			response := strings.TrimSpace(w.Body.String())
+			response := w.Body.String()
 			// In debug mode, should return success with IP
-			if !strings.HasPrefix(response, "good ") && response != "good" {
-				t.Errorf("Expected 'good' prefix in debug mode, got '%s'", response)
-			}
-			// Should include the IP in the response
-			if strings.HasPrefix(response, "good ") && !strings.Contains(response, "1.2.3.4") {
-				t.Errorf("Expected response to include IP '1.2.3.4', got '%s'", response)
+			if response != "good 1.2.3.4" {
+				t.Errorf("Expected 'good 1.2.3.4' in debug mode, got '%s'", response)
 			}
 		})
 	})
@@ -243,11 +239,8 @@ func TestOrayEndpoint(t *testing.T) {
 
 			response := w.Body.String()
 			// Should parse parameters correctly despite case differences
-			if response == "notfqdn" {
-				t.Errorf("Expected case-insensitive parameter parsing, got 'notfqdn'")
-			}
-			if response != "911" && !strings.HasPrefix(response, "good ") && response != "good" {
-				t.Errorf("Expected '911' or 'good' prefix, got '%s'", response)
+			if response != "911" {
+				t.Errorf("Expected case-insensitive parameter parsing to reach the provider, got '%s'", response)
 			}
 		})
 	})
@@ -262,9 +255,9 @@ func TestOrayEndpoint(t *testing.T) {
 
 			handler(w, req)
 
-			response := strings.TrimSpace(w.Body.String())
-			if !strings.HasPrefix(response, "good") {
-				t.Errorf("Expected 'good' for valid IPv6, got '%s'", response)
+			response := w.Body.String()
+			if response != "good 2001:db8::1" {
+				t.Errorf("Expected 'good 2001:db8::1' for valid IPv6, got '%s'", response)
 			}
 		})
 	})
@@ -280,8 +273,8 @@ func TestOrayEndpoint(t *testing.T) {
 			handler(w, req)
 
 			response := w.Body.String()
-			if !strings.HasPrefix(response, "good") {
-				t.Errorf("Expected 'good' for subdomain, got '%s'", response)
+			if response != "good 1.2.3.4" {
+				t.Errorf("Expected 'good 1.2.3.4' for subdomain, got '%s'", response)
 			}
 		})
 	})
@@ -296,9 +289,9 @@ func TestOrayEndpoint(t *testing.T) {
 			handler(w, req)
 
 			response := w.Body.String()
-			// Should use Basic Auth credentials and not return badauth
-			if response == "badauth" {
-				t.Errorf("Expected Basic Auth to be preferred over query params, got 'badauth'")
+			// Should use Basic Auth credentials and reach the provider (911 with test credentials)
+			if response != "911" {
+				t.Errorf("Expected Basic Auth to be preferred over query params, got '%s'", response)
 			}
 		})
 	})
@@ -307,11 +300,11 @@ func TestOrayEndpoint(t *testing.T) {
 // TestOrayProtocolCompatibility verifies Oray-specific protocol behaviors
 func TestOrayProtocolCompatibility(t *testing.T) {
 	// Save original config and restore after test
-	originalConfig := config.GlobalConfig
-	defer func() { config.GlobalConfig = originalConfig }()
+	originalConfig := config.Current()
+	defer config.SetCurrent(originalConfig)
 
 	// Setup test config
-	config.GlobalConfig = config.Config{
+	config.SetCurrent(&config.Config{
 		Users: []config.UserConfig{
 			{
 				Username: "orayuser",
@@ -319,7 +312,7 @@ func TestOrayProtocolCompatibility(t *testing.T) {
 				Provider: "aliyun",
 			},
 		},
-	}
+	})
 
 	handler := http.HandlerFunc(handleDDNSUpdate)
 
@@ -337,10 +330,10 @@ func TestOrayProtocolCompatibility(t *testing.T) {
 			}
 
 			response := w.Body.String()
-			// With invalid provider credentials, should get 911 (system error)
+			// With invalid provider credentials, should get 911
 			// With valid credentials, would get "good <ip>"
-			if response != "911" && !strings.HasPrefix(response, "good ") && response != "good" {
-				t.Errorf("Expected valid response format, got '%s'", response)
+			if response != "911" {
+				t.Errorf("Expected '911', got '%s'", response)
 			}
 		})
 	})
@@ -361,12 +354,79 @@ func TestOrayProtocolCompatibility(t *testing.T) {
 
 			response := w.Body.String()
 			// Should successfully parse and use RemoteAddr
-			if response == "notfqdn" {
-				t.Errorf("Expected to handle missing myip by using RemoteAddr, got 'notfqdn'")
+			if response != "911" {
+				t.Errorf("Expected to handle missing myip by using RemoteAddr, got '%s'", response)
+			}
+		})
+	})
+
+	t.Run("Oray ignores DynDNS-only parameters", func(t *testing.T) {
+		testMethods(t, func(t *testing.T, method string) {
+			req := httptest.NewRequest(method, "/ph/update?domn=oray.example.com&myip=1.2.3.4", nil)
+			req.SetBasicAuth("orayuser", "oraypass")
+			w := httptest.NewRecorder()
+
+			handler(w, req)
+
+			if response := w.Body.String(); response != "notfqdn" {
+				t.Errorf("Expected 'notfqdn' without the Oray hostname parameter, got '%s'", response)
+			}
+		})
+	})
+
+	t.Run("Oray return code: !donator (wildcard not allowed)", func(t *testing.T) {
+		testMethods(t, func(t *testing.T, method string) {
+			req := httptest.NewRequest(method, "/ph/update?hostname=*.example.com&myip=1.2.3.4", nil)
+			req.SetBasicAuth("orayuser", "oraypass")
+			w := httptest.NewRecorder()
+
+			handler(w, req)
+
+			if response := w.Body.String(); response != "!donator" {
+				t.Errorf("Expected '!donator', got '%s'", response)
+			}
+		})
+	})
+
+	t.Run("Oray return code: nohost (apex not allowed)", func(t *testing.T) {
+		deny := false
+		updateFirstUser(t, func(u *config.UserConfig) { u.AllowApex = &deny })
+		testMethods(t, func(t *testing.T, method string) {
+			req := httptest.NewRequest(method, "/ph/update?hostname=example.com&myip=1.2.3.4", nil)
+			req.SetBasicAuth("orayuser", "oraypass")
+			w := httptest.NewRecorder()
+
+			handler(w, req)
+
+			if response := w.Body.String(); response != "nohost" {
+				t.Errorf("Expected 'nohost', got '%s'", response)
 			}
 		})
 	})
 
+	t.Run("Oray return code: abuse (blocked user)", func(t *testing.T) {
+		updateFirstUser(t, func(u *config.UserConfig) { u.Blocked = true })
+		testMethods(t, func(t *testing.T, method string) {
+			req := httptest.NewRequest(method, "/ph/update?hostname=oray.example.com&myip=1.2.3.4", nil)
+			req.SetBasicAuth("orayuser", "oraypass")
+			w := httptest.NewRecorder()
+
+			handler(w, req)
+
+			if response := w.Body.String(); response != "abuse" {
+				t.Errorf("Expected 'abuse', got '%s'", response)
+			}
+		})
+	})
+
+	t.Run("Oray return code: nochg", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		mode.NewOrayMode(nil).Respond(w, &mode.Request{Domain: "oray.example.com", IP: "1.2.3.4"}, mode.OutcomeNoChange)
+		if response := w.Body.String(); response != "nochg 1.2.3.4" {
+			t.Errorf("Expected 'nochg 1.2.3.4', got '%s'", response)
+		}
+	})
+
 	t.Run("Oray response format for successful update", func(t *testing.T) {
 		testMethods(t, func(t *testing.T, method string) {
 			defer SetDebug(false)
@@ -378,19 +438,10 @@ func TestOrayProtocolCompatibility(t *testing.T) {
 
 			handler(w, req)
 
-			response := strings.TrimSpace(w.Body.String())
+			response := w.Body.String()
 			// Oray expects: "good <ip>" for successful updates
-			expectedPrefix := "good"
-			if !strings.HasPrefix(response, expectedPrefix) {
-				t.Errorf("Expected response to start with '%s', got '%s'", expectedPrefix, response)
-			}
-
-			// Should include the IP address in the response
-			parts := strings.Fields(response)
-			if len(parts) >= 2 && parts[0] == "good" {
-				if parts[1] != "1.2.3.4" {
-					t.Logf("Note: IP in response is '%s', expected '1.2.3.4'", parts[1])
-				}
+			if response != "good 1.2.3.4" {
+				t.Errorf("Expected 'good 1.2.3.4', got '%s'", response)
 			}
 		})
 	})
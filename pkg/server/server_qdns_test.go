@@ -33,13 +33,13 @@ func TestQDNSEndpoint(t *testing.T) {
 }
 
 func TestQDNSAuthReqcAndValidation(t *testing.T) {
-	originalConfig := config.GlobalConfig
-	defer func() { config.GlobalConfig = originalConfig }()
-	config.GlobalConfig = config.Config{
+	originalConfig := config.Current()
+	defer config.SetCurrent(originalConfig)
+	config.SetCurrent(&config.Config{
 		Users: []config.UserConfig{
 			{Username: "user", Password: "pass", Provider: "aliyun"},
 		},
-	}
+	})
 	handler := http.HandlerFunc(handleDDNSUpdate)
 
 	t.Run("auth failure wrong password", func(t *testing.T) {
@@ -89,10 +89,44 @@ func TestQDNSAuthReqcAndValidation(t *testing.T) {
 		}
 	})
 
+	t.Run("unsupported system returns badsys", func(t *testing.T) {
+		for _, system := range []string{"unknown", "statdns", "custom"} {
+			req := httptest.NewRequest("GET", "/dyndns/update?system="+system+"&hostname=qdns.example.com&myip=1.2.3.4", nil)
+			req.SetBasicAuth("user", "pass")
+			w := httptest.NewRecorder()
+			handler(w, req)
+			if w.Body.String() != "badsys" {
+				t.Fatalf("system=%s: expected badsys, got %q", system, w.Body.String())
+			}
+		}
+	})
+
+	t.Run("supported systems with wildcard and mx", func(t *testing.T) {
+		defer SetDebug(false)
+		SetDebug(true)
+		for _, system := range []string{"", "dyndns", "DynDNS"} {
+			req := httptest.NewRequest("GET", "/dyndns/update?system="+system+"&hostname=qdns.example.com&myip=1.2.3.4&wildcard=ON&mx=mail.example.com&backmx=YES", nil)
+			req.SetBasicAuth("debug", "debug")
+			w := httptest.NewRecorder()
+			handler(w, req)
+			if w.Body.String() != "good 1.2.3.4" {
+				t.Fatalf("system=%s: expected good 1.2.3.4, got %q", system, w.Body.String())
+			}
+		}
+	})
+
+	t.Run("invalid mx host returns notfqdn", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/dyndns/update?hostname=qdns.example.com&myip=1.2.3.4&mx=-bad", nil)
+		req.SetBasicAuth("user", "pass")
+		w := httptest.NewRecorder()
+		handler(w, req)
+		if w.Body.String() != "notfqdn" {
+			t.Fatalf("expected notfqdn, got %q", w.Body.String())
+		}
+	})
+
 	t.Run("provider error returns 911", func(t *testing.T) {
-		originalProvider := config.GlobalConfig.Users[0].Provider
-		defer func() { config.GlobalConfig.Users[0].Provider = originalProvider }()
-		config.GlobalConfig.Users[0].Provider = "unknown"
+		updateFirstUser(t, func(u *config.UserConfig) { u.Provider = "unknown" })
 		req := httptest.NewRequest("GET", "/dyndns/update?domn=qdns.example.com&myip=1.2.3.4", nil)
 		req.SetBasicAuth("user", "pass")
 		w := httptest.NewRecorder()
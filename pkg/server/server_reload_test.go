@@ -0,0 +1,72 @@
+package server
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/NewFuture/CloudDDNS/pkg/config"
+)
+
+// TestConfigReloadDuringRequests reloads the configuration while updates are
+// being served; run with -race to check that requests only see complete
+// configuration snapshots.
+func TestConfigReloadDuringRequests(t *testing.T) {
+	originalConfig := config.Current()
+	defer config.SetCurrent(originalConfig)
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	write := func(password string) {
+		content := fmt.Sprintf("server:\n  require_user_agent: false\nusers:\n  - username: \"reload\"\n    password: %q\n    provider: \"unknown\"\n", password)
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("first")
+	if err := config.LoadConfig(path); err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+
+	paths := []string{
+		"/nic/update?user=reload&pass=first&hostname=h.example.com&myip=1.2.3.4",
+		"/nic/update?user=reload&pass=second&hostname=h.example.com&myip=1.2.3.4",
+		"/nic/update?user=reload&domn=h.example.com",
+	}
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for _, p := range paths {
+		wg.Add(1)
+		go func(p string) {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				w := httptest.NewRecorder()
+				handleDDNSUpdate(w, httptest.NewRequest("GET", p, nil))
+				if w.Body.Len() == 0 {
+					t.Errorf("empty response for %s", p)
+					return
+				}
+			}
+		}(p)
+	}
+
+	for i := 0; i < 50; i++ {
+		write([]string{"first", "second"}[i%2])
+		if err := config.LoadConfig(path); err != nil {
+			t.Errorf("reload %d: %v", i, err)
+		}
+	}
+	close(stop)
+	wg.Wait()
+
+	if u := config.GetUser("reload"); u == nil || u.Password != "second" {
+		t.Fatalf("user after reloads = %+v", u)
+	}
+}
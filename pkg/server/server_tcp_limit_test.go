@@ -0,0 +1,108 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NewFuture/CloudDDNS/pkg/config"
+)
+
+func TestTCPLimiter(t *testing.T) {
+	t.Run("global and per-IP caps", func(t *testing.T) {
+		l := newTCPLimiter(config.ServerConfig{TCPMaxConns: 3, TCPMaxConnsPerIP: 2})
+		steps := []struct {
+			ip   string
+			want string
+		}{
+			{"192.0.2.1", ""},
+			{"192.0.2.1", ""},
+			{"192.0.2.1", rejectPerIP},
+			{"192.0.2.2", ""},
+			{"192.0.2.3", rejectGlobal},
+		}
+		for i, s := range steps {
+			if got := l.acquire(s.ip); got != s.want {
+				t.Fatalf("step %d acquire(%s) = %q, want %q", i, s.ip, got, s.want)
+			}
+		}
+		l.release("192.0.2.1")
+		if got := l.acquire("192.0.2.3"); got != "" {
+			t.Fatalf("acquire after release = %q, want admitted", got)
+		}
+		if got := l.acquire("192.0.2.1"); got != rejectGlobal {
+			t.Fatalf("acquire at global cap = %q, want %q", got, rejectGlobal)
+		}
+	})
+
+	t.Run("accept rate", func(t *testing.T) {
+		now := time.Unix(1700000000, 0)
+		l := newTCPLimiter(config.ServerConfig{TCPAcceptRate: 2})
+		l.now = func() time.Time { return now }
+		for i, want := range []string{"", "", rejectRate} {
+			if got := l.acquire("192.0.2.1"); got != want {
+				t.Fatalf("burst %d acquire = %q, want %q", i, got, want)
+			}
+		}
+		now = now.Add(500 * time.Millisecond)
+		if got := l.acquire("192.0.2.1"); got != "" {
+			t.Fatalf("acquire after refill = %q, want admitted", got)
+		}
+		if got := l.acquire("192.0.2.1"); got != rejectRate {
+			t.Fatalf("acquire with empty bucket = %q, want %q", got, rejectRate)
+		}
+	})
+}
+
+func TestServeTCPRejectsOverLimit(t *testing.T) {
+	originalConfig := config.Current()
+	defer config.SetCurrent(originalConfig)
+	config.SetCurrent(&config.Config{})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to create listener: %v", err)
+	}
+	defer listener.Close()
+	go serveTCP(listener, newTCPLimiter(config.ServerConfig{TCPMaxConnsPerIP: 1}))
+
+	before := metrics.tcpRejectedPerIP.Load()
+
+	first, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer first.Close()
+	first.SetDeadline(time.Now().Add(5 * time.Second))
+	if salt, err := bufio.NewReader(first).ReadString('\n'); err != nil || strings.TrimSpace(salt) == "" {
+		t.Fatalf("Expected salt on first connection, got %q (%v)", salt, err)
+	}
+
+	second, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer second.Close()
+	second.SetDeadline(time.Now().Add(5 * time.Second))
+	response, err := bufio.NewReader(second).ReadString('\n')
+	if err != nil {
+		t.Fatalf("Failed to read rejection: %v", err)
+	}
+	if response != "1\n" {
+		t.Fatalf("Expected fast rejection '1', got %q", response)
+	}
+	if got := metrics.tcpRejectedPerIP.Load() - before; got != 1 {
+		t.Fatalf("per-IP rejections = %d, want 1", got)
+	}
+
+	w := httptest.NewRecorder()
+	handleMetrics(w, httptest.NewRequest("GET", "/metrics", nil))
+	want := fmt.Sprintf(`cloudddns_tcp_connections_rejected_total{reason="per_ip"} %d`, metrics.tcpRejectedPerIP.Load())
+	if !strings.Contains(w.Body.String(), want) {
+		t.Fatalf("metrics output missing %q:\n%s", want, w.Body.String())
+	}
+}
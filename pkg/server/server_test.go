@@ -4,8 +4,10 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
+	"log/slog"
 	"net"
 	"net/http"
 	"net/http/httptest"
@@ -14,6 +16,8 @@ import (
 	"time"
 
 	"github.com/NewFuture/CloudDDNS/pkg/config"
+	"github.com/NewFuture/CloudDDNS/pkg/guard"
+	"github.com/NewFuture/CloudDDNS/pkg/logging"
 	"github.com/NewFuture/CloudDDNS/pkg/server/mode"
 )
 
@@ -36,33 +40,268 @@ func TestComputeMD5Hash(t *testing.T) {
 	}
 }
 
-func TestDebugLoggingToggle(t *testing.T) {
+// captureLogs routes the structured logger (and the standard log package
+// behind it) to a buffer at info level for the duration of the test.
+func captureLogs(t *testing.T, format string) *bytes.Buffer {
+	t.Helper()
+	originalLogger := slog.Default()
 	originalOutput := log.Writer()
 	originalFlags := log.Flags()
-	defer func() {
+	t.Cleanup(func() {
+		SetDebug(false)
+		slog.SetDefault(originalLogger)
 		log.SetOutput(originalOutput)
 		log.SetFlags(originalFlags)
-		SetDebug(false)
-	}()
+	})
 
 	var buf bytes.Buffer
-	log.SetOutput(&buf)
-	log.SetFlags(0)
+	if err := logging.Setup(&buf, "info", format); err != nil {
+		t.Fatalf("logging.Setup: %v", err)
+	}
+	return &buf
+}
+
+// updateFirstUser publishes a copy of the current config with the first
+// user modified, restoring the original snapshot when the test ends. The
+// published config is shared and must not be changed in place.
+func updateFirstUser(t *testing.T, modify func(u *config.UserConfig)) {
+	t.Helper()
+	original := config.Current()
+	t.Cleanup(func() { config.SetCurrent(original) })
+
+	cfg := *original
+	cfg.Users = append([]config.UserConfig(nil), original.Users...)
+	modify(&cfg.Users[0])
+	config.SetCurrent(&cfg)
+}
+
+func TestDebugLoggingToggle(t *testing.T) {
+	buf := captureLogs(t, "text")
 
 	SetDebug(false)
-	debugLogf("should not log")
+	slog.Debug("should not log")
 	if buf.Len() != 0 {
 		t.Fatalf("expected no debug output when disabled, got %q", buf.String())
 	}
 
 	buf.Reset()
 	SetDebug(true)
-	debugLogf("debug message %s", "on")
-	if !strings.Contains(buf.String(), "[DEBUG] debug message on") {
+	slog.Debug("debug message on")
+	if !strings.Contains(buf.String(), `level=DEBUG msg="debug message on"`) {
 		t.Fatalf("expected debug output when enabled, got %q", buf.String())
 	}
 }
 
+func TestDebugLogRedactsCredentials(t *testing.T) {
+	buf := captureLogs(t, "text")
+	SetDebug(true)
+
+	req := httptest.NewRequest("POST", "/nic/update?hostname=test.example.com&pass=querypass", strings.NewReader("password=formpass"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth("testuser", "testpass")
+	handleDDNSUpdate(httptest.NewRecorder(), req)
+
+	for _, secret := range []string{req.Header.Get("Authorization"), "querypass", "formpass"} {
+		if strings.Contains(buf.String(), secret) {
+			t.Fatalf("debug log leaked %q: %q", secret, buf.String())
+		}
+	}
+	if !strings.Contains(buf.String(), `auth="Basic [REDACTED]"`) {
+		t.Fatalf("expected redacted auth in debug log, got %q", buf.String())
+	}
+
+	// The GnuDIP handshake page carries the challenge sign.
+	buf.Reset()
+	w := httptest.NewRecorder()
+	handleDDNSUpdate(w, httptest.NewRequest("GET", "/nic/update?user=testuser&domn=test.example.com", nil))
+	sign := getMetaContent(w.Body.String(), "sign")
+	if sign == "" || strings.Contains(buf.String(), sign) {
+		t.Fatalf("debug log leaked the handshake sign %q: %q", sign, buf.String())
+	}
+	if !strings.Contains(buf.String(), `content=\"[REDACTED]\"`) {
+		t.Fatalf("expected redacted sign in debug log, got %q", buf.String())
+	}
+
+	buf.Reset()
+	SetDebugUnredacted(true)
+	defer SetDebugUnredacted(false)
+	req = httptest.NewRequest("GET", "/nic/update?hostname=test.example.com&pass=querypass", nil)
+	handleDDNSUpdate(httptest.NewRecorder(), req)
+	if !strings.Contains(buf.String(), "pass=querypass") {
+		t.Fatalf("expected unredacted URL when opted in, got %q", buf.String())
+	}
+}
+
+func TestRequestLogFields(t *testing.T) {
+	originalConfig := config.Current()
+	defer config.SetCurrent(originalConfig)
+	config.SetCurrent(&config.Config{})
+	buf := captureLogs(t, "json")
+	SetDebug(true)
+
+	req := httptest.NewRequest("GET", "/nic/update?hostname=a.example.com,b.example.com&myip=1.2.3.4", nil)
+	req.SetBasicAuth("debug", "debug")
+	w := httptest.NewRecorder()
+	handleDDNSUpdate(w, req)
+
+	requestID := w.Header().Get("X-Request-ID")
+	if requestID == "" {
+		t.Fatal("response is missing X-Request-ID")
+	}
+	var summary map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var rec map[string]any
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("log line is not JSON: %q (%v)", line, err)
+		}
+		if rec["request_id"] != requestID {
+			t.Fatalf("log line without the request ID %s: %q", requestID, line)
+		}
+		if rec["msg"] == "ddns request" {
+			summary = rec
+		}
+	}
+	want := map[string]any{
+		"level":   "INFO",
+		"mode":    "dyn",
+		"user":    "debug",
+		"domain":  "a.example.com,b.example.com",
+		"ip":      "1.2.3.4",
+		"outcome": "success",
+	}
+	for k, v := range want {
+		if summary[k] != v {
+			t.Fatalf("summary %s = %v, want %v (record %v)", k, summary[k], v, summary)
+		}
+	}
+	if _, ok := summary["duration"].(float64); !ok {
+		t.Fatalf("summary duration missing: %v", summary)
+	}
+}
+
+// TestFailureLogsCarryRequestID checks that failures inside the modes are
+// logged at warn or error with the request ID, so log_level: warn keeps them.
+func TestFailureLogsCarryRequestID(t *testing.T) {
+	originalConfig := config.Current()
+	defer config.SetCurrent(originalConfig)
+	config.SetCurrent(&config.Config{Users: []config.UserConfig{{
+		Username:         "broken",
+		Password:         "secret",
+		Provider:         "unknown",
+		CloudflareTokens: []string{"cf-token"},
+	}}})
+	defer guard.SetDefault(guard.Default())
+	guard.SetDefault(guard.New(guard.Policy{MaxFailures: 5, Ban: time.Minute, MaxBan: time.Hour, Window: time.Hour}))
+	buf := captureLogs(t, "json")
+	if err := logging.Setup(buf, "warn", "json"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		handler http.Handler
+		path    string
+		token   string
+		level   string
+		msg     string
+	}{
+		{
+			name:    "provider init failure",
+			handler: http.HandlerFunc(handleDDNSUpdate),
+			path:    "/nic/update?user=broken&pass=secret&hostname=h.example.com&myip=1.2.3.4",
+			level:   "ERROR",
+			msg:     "Provider init failed",
+		},
+		{
+			name:    "cloudflare provider failure",
+			handler: withRequestLog(mode.NewCloudflareAPI()),
+			path:    "/client/v4/zones",
+			token:   "cf-token",
+			level:   "ERROR",
+			msg:     "Provider init failed",
+		},
+		{
+			name:    "cloudflare wrong token",
+			handler: withRequestLog(mode.NewCloudflareAPI()),
+			path:    "/client/v4/zones",
+			token:   "wrong",
+			level:   "WARN",
+			msg:     "Cloudflare API authentication failed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf.Reset()
+			req := httptest.NewRequest("GET", tt.path, nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			w := httptest.NewRecorder()
+			tt.handler.ServeHTTP(w, req)
+
+			requestID := w.Header().Get("X-Request-ID")
+			for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+				var rec map[string]any
+				if err := json.Unmarshal([]byte(line), &rec); err != nil {
+					t.Fatalf("log line is not JSON: %q (%v)", line, err)
+				}
+				if rec["msg"] == tt.msg {
+					if rec["level"] != tt.level || rec["request_id"] != requestID {
+						t.Fatalf("record = %v, want level %s and request_id %s", rec, tt.level, requestID)
+					}
+					return
+				}
+			}
+			t.Fatalf("no %q record at log_level warn in %q", tt.msg, buf.String())
+		})
+	}
+}
+
+// TestHostResolvedModesAuthenticateOnce checks that DtDNS and Namecheap,
+// which find the account by hostname, verify the password only once.
+func TestHostResolvedModesAuthenticateOnce(t *testing.T) {
+	originalConfig := config.Current()
+	defer config.SetCurrent(originalConfig)
+	config.SetCurrent(&config.Config{Users: []config.UserConfig{
+		{Username: "owner", Password: "secret", Provider: "unknown", OwnedHosts: []string{"cam.example.com"}},
+	}})
+	buf := captureLogs(t, "json")
+
+	for _, path := range []string{
+		"/api/autodns.cfm?id=cam.example.com&pw=secret&ip=1.2.3.4",
+		"/update?host=cam&domain=example.com&password=secret&ip=1.2.3.4",
+	} {
+		t.Run(path, func(t *testing.T) {
+			buf.Reset()
+			handleDDNSUpdate(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+			if n := strings.Count(buf.String(), "Password matched scheme"); n != 1 {
+				t.Fatalf("password verified %d times, want 1: %s", n, buf.String())
+			}
+		})
+	}
+}
+
+// TestGnuHTTPHandshakeLogsAtDebug checks that issuing a GnuDIP challenge is
+// not reported as an authentication failure at warn level.
+func TestGnuHTTPHandshakeLogsAtDebug(t *testing.T) {
+	originalConfig := config.Current()
+	defer config.SetCurrent(originalConfig)
+	config.SetCurrent(&config.Config{Users: []config.UserConfig{{Username: "alice", Password: "secret"}}})
+	buf := captureLogs(t, "json")
+	if err := logging.Setup(buf, "warn", "json"); err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	handleCGIUpdate(w, httptest.NewRequest("GET", "/cgi-bin/gdipupdt.cgi?user=alice", nil))
+	if !strings.Contains(w.Body.String(), `<meta name="salt"`) {
+		t.Fatalf("handshake body = %q, want a challenge page", w.Body.String())
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("handshake logged at warn level: %q", buf.String())
+	}
+}
+
 func TestSaltGeneration(t *testing.T) {
 	// Test that salt format is correct
 	now := time.Now()
@@ -247,11 +486,11 @@ func TestProtocolMessageParsing(t *testing.T) {
 
 func TestAuthenticationFlow(t *testing.T) {
 	// Save original config and restore after test
-	originalConfig := config.GlobalConfig
-	defer func() { config.GlobalConfig = originalConfig }()
+	originalConfig := config.Current()
+	defer config.SetCurrent(originalConfig)
 
 	// Setup test config
-	config.GlobalConfig = config.Config{
+	config.SetCurrent(&config.Config{
 		Users: []config.UserConfig{
 			{
 				Username: "testuser",
@@ -259,7 +498,7 @@ func TestAuthenticationFlow(t *testing.T) {
 				Provider: "aliyun",
 			},
 		},
-	}
+	})
 
 	user := "testuser"
 	password := "testpass"
@@ -312,11 +551,11 @@ func TestDomainAndIPExtraction(t *testing.T) {
 // Integration test for TCP server handler
 func TestTCPServerIntegration(t *testing.T) {
 	// Save original config and restore after test
-	originalConfig := config.GlobalConfig
-	defer func() { config.GlobalConfig = originalConfig }()
+	originalConfig := config.Current()
+	defer config.SetCurrent(originalConfig)
 
 	// Setup test config
-	config.GlobalConfig = config.Config{
+	config.SetCurrent(&config.Config{
 		Users: []config.UserConfig{
 			{
 				Username: "testuser",
@@ -324,7 +563,7 @@ func TestTCPServerIntegration(t *testing.T) {
 				Provider: "aliyun",
 			},
 		},
-	}
+	})
 
 	// Start TCP server on random port
 	listener, err := net.Listen("tcp", "127.0.0.1:0")
@@ -354,7 +593,7 @@ func TestTCPServerIntegration(t *testing.T) {
 				if err != nil {
 					return // Listener closed
 				}
-				go mode.NewGnuTCPMode(debugLogf).Handle(conn)
+				go mode.NewGnuTCPMode(slog.Default()).Handle(conn)
 			}
 		}
 	}()
@@ -454,6 +693,38 @@ func TestTCPServerIntegration(t *testing.T) {
 		}
 	})
 
+	t.Run("Debug account echoes auto-detected address", func(t *testing.T) {
+		defer SetDebug(false)
+		SetDebug(true)
+
+		conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+		if err != nil {
+			t.Fatalf("Failed to connect: %v", err)
+		}
+		defer conn.Close()
+
+		reader := bufio.NewReader(conn)
+		salt, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Failed to read salt: %v", err)
+		}
+		salt = strings.TrimSpace(salt)
+
+		hash := mode.ComputeTCPHash("debug", salt)
+		request := fmt.Sprintf("%s:%s:debug.example.com:2\n", "debug", hash)
+		if _, err := conn.Write([]byte(request)); err != nil {
+			t.Fatalf("Failed to send request: %v", err)
+		}
+
+		response, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Failed to read response: %v", err)
+		}
+		if response = strings.TrimSpace(response); response != "0:127.0.0.1" {
+			t.Errorf("Expected '0:127.0.0.1' for reqc=2, got '%s'", response)
+		}
+	})
+
 	t.Run("Failed authentication - wrong password", func(t *testing.T) {
 		conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port))
 		if err != nil {
@@ -695,17 +966,10 @@ func TestVerifyPassword(t *testing.T) {
 }
 
 func TestUnmatchedPathDefaultsToDynModeAndLogs(t *testing.T) {
-	originalConfig := config.GlobalConfig
-	originalOutput := log.Writer()
-	originalFlags := log.Flags()
-	defer func() {
-		config.GlobalConfig = originalConfig
-		log.SetOutput(originalOutput)
-		log.SetFlags(originalFlags)
-		SetDebug(false)
-	}()
+	originalConfig := config.Current()
+	defer config.SetCurrent(originalConfig)
 
-	config.GlobalConfig = config.Config{
+	config.SetCurrent(&config.Config{
 		Users: []config.UserConfig{
 			{
 				Username: "testuser",
@@ -713,11 +977,9 @@ func TestUnmatchedPathDefaultsToDynModeAndLogs(t *testing.T) {
 				Provider: "aliyun",
 			},
 		},
-	}
+	})
 
-	var buf bytes.Buffer
-	log.SetOutput(&buf)
-	log.SetFlags(0)
+	buf := captureLogs(t, "text")
 	SetDebug(true)
 
 	req := httptest.NewRequest("GET", "/unmatched/path?user=testuser&pass=wrongpass&domn=test.example.com&addr=1.2.3.4", nil)
@@ -735,7 +997,7 @@ func TestUnmatchedPathDefaultsToDynModeAndLogs(t *testing.T) {
 	}
 
 	logOutput := buf.String()
-	if !strings.Contains(logOutput, "Unmatched HTTP path=/unmatched/path") || !strings.Contains(logOutput, "method=GET") {
+	if !strings.Contains(logOutput, `msg="Unmatched HTTP path, defaulting to DynDNS mode"`) || !strings.Contains(logOutput, "path=/unmatched/path") || !strings.Contains(logOutput, "method=GET") {
 		t.Fatalf("expected debug log for unmatched path and method, got %q", logOutput)
 	}
 }
@@ -743,11 +1005,11 @@ func TestUnmatchedPathDefaultsToDynModeAndLogs(t *testing.T) {
 // Integration test for HTTP server handler
 func TestHTTPServerIntegration(t *testing.T) {
 	// Save original config and restore after test
-	originalConfig := config.GlobalConfig
-	defer func() { config.GlobalConfig = originalConfig }()
+	originalConfig := config.Current()
+	defer config.SetCurrent(originalConfig)
 
 	// Setup test config
-	config.GlobalConfig = config.Config{
+	config.SetCurrent(&config.Config{
 		Users: []config.UserConfig{
 			{
 				Username: "testuser",
@@ -755,7 +1017,7 @@ func TestHTTPServerIntegration(t *testing.T) {
 				Provider: "aliyun",
 			},
 		},
-	}
+	})
 
 	// Create a test HTTP handler using the actual handleDDNSUpdate
 	handler := http.HandlerFunc(handleDDNSUpdate)
@@ -771,10 +1033,10 @@ func TestHTTPServerIntegration(t *testing.T) {
 		}
 
 		response := w.Body.String()
-		// Will return "911" because provider credentials are invalid (test credentials)
+		// Will return "dnserr" because provider credentials are invalid (test credentials)
 		// In real usage with valid credentials, it would return "good <ip>"
-		if response != "911" && !strings.HasPrefix(response, "good ") {
-			t.Errorf("Expected '911' or 'good ' prefix, got '%s'", response)
+		if response != "dnserr" && !strings.HasPrefix(response, "good ") {
+			t.Errorf("Expected 'dnserr' or 'good ' prefix, got '%s'", response)
 		}
 	})
 
@@ -790,8 +1052,8 @@ func TestHTTPServerIntegration(t *testing.T) {
 		}
 
 		response := w.Body.String()
-		if response != "911" && !strings.HasPrefix(response, "good ") {
-			t.Errorf("Expected '911' or 'good ' prefix, got '%s'", response)
+		if response != "dnserr" && !strings.HasPrefix(response, "good ") {
+			t.Errorf("Expected 'dnserr' or 'good ' prefix, got '%s'", response)
 		}
 	})
 
@@ -806,9 +1068,9 @@ func TestHTTPServerIntegration(t *testing.T) {
 		}
 
 		response := w.Body.String()
-		// Will return "911" because provider credentials are invalid (test credentials)
-		if response != "911" && !strings.HasPrefix(response, "good ") {
-			t.Errorf("Expected '911' or 'good ' prefix, got '%s'", response)
+		// Will return "dnserr" because provider credentials are invalid (test credentials)
+		if response != "dnserr" && !strings.HasPrefix(response, "good ") {
+			t.Errorf("Expected 'dnserr' or 'good ' prefix, got '%s'", response)
 		}
 	})
 
@@ -823,9 +1085,9 @@ func TestHTTPServerIntegration(t *testing.T) {
 		}
 
 		response := w.Body.String()
-		// Will return "911" because provider credentials are invalid (test credentials)
-		if response != "911" && !strings.HasPrefix(response, "good ") {
-			t.Errorf("Expected '911' or 'good ' prefix, got '%s'", response)
+		// Will return "dnserr" because provider credentials are invalid (test credentials)
+		if response != "dnserr" && !strings.HasPrefix(response, "good ") {
+			t.Errorf("Expected 'dnserr' or 'good ' prefix, got '%s'", response)
 		}
 	})
 
@@ -857,9 +1119,9 @@ func TestHTTPServerIntegration(t *testing.T) {
 		}
 
 		response := w.Body.String()
-		// Will return "911" because provider credentials are invalid (test credentials)
-		if response != "911" && !strings.HasPrefix(response, "good ") {
-			t.Errorf("Expected '911' or 'good ' prefix, got '%s'", response)
+		// Will return "dnserr" because provider credentials are invalid (test credentials)
+		if response != "dnserr" && !strings.HasPrefix(response, "good ") {
+			t.Errorf("Expected 'dnserr' or 'good ' prefix, got '%s'", response)
 		}
 	})
 
@@ -939,9 +1201,9 @@ func TestHTTPServerIntegration(t *testing.T) {
 		}
 
 		response := w.Body.String()
-		// Will return "911" because provider credentials are invalid (test credentials)
-		if response != "911" && !strings.HasPrefix(response, "good ") {
-			t.Errorf("Expected '911' or 'good ' prefix, got '%s'", response)
+		// Will return "dnserr" because provider credentials are invalid (test credentials)
+		if response != "dnserr" && !strings.HasPrefix(response, "good ") {
+			t.Errorf("Expected 'dnserr' or 'good ' prefix, got '%s'", response)
 		}
 	})
 
@@ -957,15 +1219,15 @@ func TestHTTPServerIntegration(t *testing.T) {
 		}
 
 		response := w.Body.String()
-		// Will return "911" because provider credentials are invalid (test credentials)
-		if response != "911" && !strings.HasPrefix(response, "good ") {
-			t.Errorf("Expected '911' or 'good ' prefix, got '%s'", response)
+		// Will return "dnserr" because provider credentials are invalid (test credentials)
+		if response != "dnserr" && !strings.HasPrefix(response, "good ") {
+			t.Errorf("Expected 'dnserr' or 'good ' prefix, got '%s'", response)
 		}
 	})
 }
 
 func TestDDNSServicePrefersBasicAuth(t *testing.T) {
-	service := mode.NewDynMode(false, debugLogf)
+	service := mode.NewDynMode(false, slog.Default())
 	req := httptest.NewRequest("GET", "/?user=queryUser&pass=queryPass&domain=test.example.com&addr=1.1.1.1", nil)
 	req.RemoteAddr = "10.0.0.2:12345"
 	req.SetBasicAuth("headerUser", "headerPass")
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"sync"
+	"time"
+
+	"github.com/NewFuture/CloudDDNS/pkg/config"
+)
+
+// Reasons a TCP connection is refused, also used as the metrics label.
+const (
+	rejectRate   = "rate"
+	rejectGlobal = "global"
+	rejectPerIP  = "per_ip"
+)
+
+// rejectWriteTimeout bounds the "1\n" written to a refused connection so a
+// client that never reads cannot hold the accept loop.
+const rejectWriteTimeout = time.Second
+
+// tcpLimiter enforces the global and per-source-IP connection caps and the
+// accept rate of the GnuDIP TCP listener. Zero values disable a limit.
+type tcpLimiter struct {
+	mu       sync.Mutex
+	maxConns int
+	maxPerIP int
+	active   int
+	perIP    map[string]int
+
+	// Token bucket refilled at rate per second, holding at most burst tokens.
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+}
+
+func newTCPLimiter(cfg config.ServerConfig) *tcpLimiter {
+	burst := cfg.TCPAcceptRate
+	if burst < 1 {
+		burst = 1
+	}
+	return &tcpLimiter{
+		maxConns: cfg.TCPMaxConns,
+		maxPerIP: cfg.TCPMaxConnsPerIP,
+		perIP:    make(map[string]int),
+		rate:     cfg.TCPAcceptRate,
+		burst:    burst,
+		tokens:   burst,
+		now:      time.Now,
+	}
+}
+
+// acquire admits a connection from ip, returning the rejection reason or ""
+// when it may proceed. Every admitted connection must be released.
+func (l *tcpLimiter) acquire(ip string) string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.rate > 0 {
+		now := l.now()
+		if !l.last.IsZero() {
+			l.tokens += now.Sub(l.last).Seconds() * l.rate
+			if l.tokens > l.burst {
+				l.tokens = l.burst
+			}
+		}
+		l.last = now
+		if l.tokens < 1 {
+			return rejectRate
+		}
+		l.tokens--
+	}
+	if l.maxConns > 0 && l.active >= l.maxConns {
+		return rejectGlobal
+	}
+	if l.maxPerIP > 0 && l.perIP[ip] >= l.maxPerIP {
+		return rejectPerIP
+	}
+	l.active++
+	l.perIP[ip]++
+	return ""
+}
+
+// release frees the slot taken by an admitted connection from ip.
+func (l *tcpLimiter) release(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.active--
+	if l.perIP[ip] <= 1 {
+		delete(l.perIP, ip)
+	} else {
+		l.perIP[ip]--
+	}
+}
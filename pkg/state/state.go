@@ -0,0 +1,214 @@
+package state
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// freeDNSTokenBytes 为 FreeDNS 更新 token 的随机字节数 (编码后 40 个十六进制字符)
+const freeDNSTokenBytes = 20
+
+// FreeDNSToken 一个 FreeDNS 更新 token 对应的用户与主机
+type FreeDNSToken struct {
+	Username string    `json:"username"`
+	Host     string    `json:"host"`
+	Created  time.Time `json:"created"`
+}
+
+// data 为持久化到 JSON 文件的内容
+type data struct {
+	FreeDNSTokens map[string]FreeDNSToken `json:"freedns_tokens,omitempty"`
+}
+
+// Store 保存运行时生成、需要跨重启保留的状态 (如 FreeDNS token)，每次修改后整体写回文件。
+// 读取前检查文件是否被替换或修改 (inode、修改时间、大小)，有变化时重新加载，
+// 因此服务运行期间 freedns-token 命令生成 (同一主机的旧 token 随之失效) 或以 -revoke 吊销的 token 无需重启即可生效
+type Store struct {
+	mu   sync.RWMutex
+	path string
+	data data
+	// info 为上次读取或写入时的文件信息，文件不存在时为 nil
+	info os.FileInfo
+}
+
+// Open 读取 path 指向的状态文件，文件不存在时返回空状态，首次写入时创建
+func Open(path string) (*Store, error) {
+	s := &Store{path: path}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// load 读取状态文件并记录其文件信息，失败时保留原有状态；调用方需持有写锁
+func (s *Store) load() error {
+	info, err := os.Stat(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		s.data, s.info = data{}, nil
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	raw, err := os.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+	var d data
+	if err := json.Unmarshal(raw, &d); err != nil {
+		return err
+	}
+	s.data, s.info = d, info
+	return nil
+}
+
+// reload 在状态文件自上次读取或写入后发生变化时重新加载；读取失败 (如写入途中的文件) 时沿用内存中的状态
+func (s *Store) reload() {
+	info, err := os.Stat(s.path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	s.mu.RLock()
+	same := sameFile(s.info, info)
+	s.mu.RUnlock()
+	if same {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_ = s.load()
+}
+
+// sameFile 比较两次 Stat 的结果，nil 表示文件不存在
+func sameFile(a, b os.FileInfo) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return os.SameFile(a, b) && a.ModTime().Equal(b.ModTime()) && a.Size() == b.Size()
+}
+
+// IssueFreeDNSToken 为用户的主机生成新的随机 token 并保存，同一主机此前的 token 随之失效
+func (s *Store) IssueFreeDNSToken(username, host string) (string, error) {
+	buf := make([]byte, freeDNSTokenBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(buf)
+
+	s.reload()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.data.FreeDNSTokens == nil {
+		s.data.FreeDNSTokens = make(map[string]FreeDNSToken)
+	}
+	for t, entry := range s.data.FreeDNSTokens {
+		if entry.Username == username && entry.Host == host {
+			delete(s.data.FreeDNSTokens, t)
+		}
+	}
+	s.data.FreeDNSTokens[token] = FreeDNSToken{Username: username, Host: host, Created: time.Now().UTC()}
+	return token, s.save()
+}
+
+// RevokeFreeDNSToken 吊销用户主机的 token，返回是否存在被吊销的 token
+func (s *Store) RevokeFreeDNSToken(username, host string) (bool, error) {
+	s.reload()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	revoked := false
+	for t, entry := range s.data.FreeDNSTokens {
+		if entry.Username == username && entry.Host == host {
+			delete(s.data.FreeDNSTokens, t)
+			revoked = true
+		}
+	}
+	if !revoked {
+		return false, nil
+	}
+	return true, s.save()
+}
+
+// LookupFreeDNSToken 查找 token 对应的用户与主机
+func (s *Store) LookupFreeDNSToken(token string) (FreeDNSToken, bool) {
+	s.reload()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	entry, ok := s.data.FreeDNSTokens[token]
+	return entry, ok
+}
+
+// FreeDNSTokens 返回全部 token，按用户名与主机排序
+func (s *Store) FreeDNSTokens() []FreeDNSTokenEntry {
+	s.reload()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	entries := make([]FreeDNSTokenEntry, 0, len(s.data.FreeDNSTokens))
+	for token, entry := range s.data.FreeDNSTokens {
+		entries = append(entries, FreeDNSTokenEntry{Token: token, FreeDNSToken: entry})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Username != entries[j].Username {
+			return entries[i].Username < entries[j].Username
+		}
+		return entries[i].Host < entries[j].Host
+	})
+	return entries
+}
+
+// FreeDNSTokenEntry 带 token 本身的列表项
+type FreeDNSTokenEntry struct {
+	Token string
+	FreeDNSToken
+}
+
+// save 先写临时文件再重命名，避免中途失败留下不完整的状态文件；调用方需持有写锁
+func (s *Store) save() error {
+	raw, err := json.MarshalIndent(s.data, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(raw); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return err
+	}
+	// 记录写入后的文件信息，避免下次读取时把自己的写入当作外部修改
+	if info, err := os.Stat(s.path); err == nil {
+		s.info = info
+	}
+	return nil
+}
+
+var current atomic.Pointer[Store]
+
+// SetDefault 设置服务进程使用的全局状态
+func SetDefault(s *Store) {
+	current.Store(s)
+}
+
+// Default 返回全局状态，未初始化时为 nil
+func Default() *Store {
+	return current.Load()
+}
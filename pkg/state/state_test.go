@@ -0,0 +1,145 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenMissingFile(t *testing.T) {
+	s, err := Open(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if _, ok := s.LookupFreeDNSToken("anything"); ok {
+		t.Fatal("empty state should not contain tokens")
+	}
+}
+
+func TestIssueFreeDNSToken(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	first, err := s.IssueFreeDNSToken("alice", "home.example.com")
+	if err != nil {
+		t.Fatalf("IssueFreeDNSToken() error = %v", err)
+	}
+	other, err := s.IssueFreeDNSToken("alice", "nas.example.com")
+	if err != nil {
+		t.Fatalf("IssueFreeDNSToken() error = %v", err)
+	}
+	second, err := s.IssueFreeDNSToken("alice", "home.example.com")
+	if err != nil {
+		t.Fatalf("IssueFreeDNSToken() error = %v", err)
+	}
+	if first == second || len(second) != 2*freeDNSTokenBytes {
+		t.Fatalf("unexpected tokens first=%q second=%q", first, second)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("state file not written: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("state file mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	// Reload from disk to check the tokens were persisted.
+	reloaded, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if _, ok := reloaded.LookupFreeDNSToken(first); ok {
+		t.Fatal("reissued host should invalidate its previous token")
+	}
+	if entry, ok := reloaded.LookupFreeDNSToken(second); !ok || entry.Username != "alice" || entry.Host != "home.example.com" {
+		t.Fatalf("LookupFreeDNSToken(second) = %+v, %t", entry, ok)
+	}
+	if entry, ok := reloaded.LookupFreeDNSToken(other); !ok || entry.Host != "nas.example.com" {
+		t.Fatalf("LookupFreeDNSToken(other) = %+v, %t", entry, ok)
+	}
+	if got := len(reloaded.FreeDNSTokens()); got != 2 {
+		t.Fatalf("FreeDNSTokens() returned %d entries, want 2", got)
+	}
+}
+
+func TestRevokeFreeDNSToken(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	home, err := s.IssueFreeDNSToken("alice", "home.example.com")
+	if err != nil {
+		t.Fatalf("IssueFreeDNSToken() error = %v", err)
+	}
+	nas, err := s.IssueFreeDNSToken("alice", "nas.example.com")
+	if err != nil {
+		t.Fatalf("IssueFreeDNSToken() error = %v", err)
+	}
+
+	if revoked, err := s.RevokeFreeDNSToken("alice", "home.example.com"); err != nil || !revoked {
+		t.Fatalf("RevokeFreeDNSToken() = %t, %v, want true", revoked, err)
+	}
+	if revoked, err := s.RevokeFreeDNSToken("alice", "home.example.com"); err != nil || revoked {
+		t.Fatalf("second RevokeFreeDNSToken() = %t, %v, want false", revoked, err)
+	}
+
+	reloaded, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if _, ok := reloaded.LookupFreeDNSToken(home); ok {
+		t.Fatal("revoked token should be removed from the state file")
+	}
+	if _, ok := reloaded.LookupFreeDNSToken(nas); !ok {
+		t.Fatal("revoking one host should keep the tokens of other hosts")
+	}
+}
+
+func TestStoreReloadsChangedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	server, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	// A second store stands in for the freedns-token command run while the
+	// server is up.
+	cli, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	first, err := cli.IssueFreeDNSToken("alice", "home.example.com")
+	if err != nil {
+		t.Fatalf("IssueFreeDNSToken() error = %v", err)
+	}
+	if _, ok := server.LookupFreeDNSToken(first); !ok {
+		t.Fatal("token issued by another process should be visible without reopening")
+	}
+
+	cli, err = Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	second, err := cli.IssueFreeDNSToken("alice", "home.example.com")
+	if err != nil {
+		t.Fatalf("IssueFreeDNSToken() error = %v", err)
+	}
+	if _, ok := server.LookupFreeDNSToken(first); ok {
+		t.Fatal("revoked token should stop working once the file changes")
+	}
+	if _, ok := server.LookupFreeDNSToken(second); !ok {
+		t.Fatal("reissued token should be visible")
+	}
+
+	if err := os.WriteFile(path, []byte("{broken"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := server.LookupFreeDNSToken(second); !ok {
+		t.Fatal("unreadable state file should keep the tokens already loaded")
+	}
+}